@@ -13,7 +13,7 @@ for target in "clean" "install" ; do
   done
 done
 
-for d in fuse zipfs unionfs
+for d in fuse zipfs unionfs metrics
 do
   (cd $d && go test go-fuse/$d && go test -race go-fuse/$d)
 done
@@ -1,52 +1,264 @@
 package benchmark
 
 import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
-type latencyMapEntry struct {
-	count int
-	dur   time.Duration
+// Latencies are counted in buckets whose bounds grow exponentially
+// from minLatency, so percentiles are accurate to within a factor of
+// 2^(1/bucketsPerDoubling), about 19%.
+const (
+	minLatency         = time.Microsecond
+	bucketsPerDoubling = 4
+
+	// Up to 2^34 us, which is about 4.8 hours.
+	bucketCount = 34*bucketsPerDoubling + 1
+)
+
+func bucketIndex(dt time.Duration) int {
+	if dt <= minLatency {
+		return 0
+	}
+	i := int(math.Ceil(math.Log2(float64(dt)/float64(minLatency)) * bucketsPerDoubling))
+	if i >= bucketCount {
+		i = bucketCount - 1
+	}
+	return i
+}
+
+// bucketBound returns the upper bound of bucket i.
+func bucketBound(i int) time.Duration {
+	return time.Duration(float64(minLatency) * math.Exp2(float64(i)/bucketsPerDoubling))
+}
+
+// Histogram holds the latencies recorded for one key.
+type Histogram struct {
+	Count int
+	Total time.Duration
+
+	buckets [bucketCount]int
+}
+
+func (h *Histogram) add(dt time.Duration) {
+	h.Count++
+	h.Total += dt
+	h.buckets[bucketIndex(dt)]++
+}
+
+// Mean returns the average latency.
+func (h *Histogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Total / time.Duration(h.Count)
+}
+
+// Percentile returns the latency below which p percent of the
+// recorded latencies fall, rounded up to a bucket bound.
+func (h *Histogram) Percentile(p float64) time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(h.Count)))
+	if rank < 1 {
+		rank = 1
+	}
+	seen := 0
+	for i, n := range h.buckets {
+		seen += n
+		if seen >= rank {
+			return bucketBound(i)
+		}
+	}
+	return bucketBound(bucketCount - 1)
+}
+
+// Sub returns the latencies recorded in h but not in old, where old
+// is an earlier copy of the same histogram.
+func (h *Histogram) Sub(old *Histogram) *Histogram {
+	r := *h
+	if old == nil {
+		return &r
+	}
+	r.Count -= old.Count
+	r.Total -= old.Total
+	for i := range r.buckets {
+		r.buckets[i] -= old.buckets[i]
+	}
+	return &r
+}
+
+func (h *Histogram) String() string {
+	return fmt.Sprintf("n=%d mean=%v p50=%v p90=%v p99=%v",
+		h.Count, h.Mean(), h.Percentile(50), h.Percentile(90), h.Percentile(99))
+}
+
+// LatencyKey identifies a histogram in a LatencyMap. Prefix is empty
+// for the totals of an operation, and set for the per-path-prefix
+// breakdown recorded by AddPath.
+type LatencyKey struct {
+	Name   string
+	Prefix string
+}
+
+// Snapshot is a copy of the histograms of a LatencyMap.
+type Snapshot map[LatencyKey]*Histogram
+
+// Diff returns the latencies recorded after old was taken.
+func (s Snapshot) Diff(old Snapshot) Snapshot {
+	r := Snapshot{}
+	for k, h := range s {
+		d := h.Sub(old[k])
+		if d.Count > 0 {
+			r[k] = d
+		}
+	}
+	return r
+}
+
+// String formats the snapshot as a table, sorted by key.
+func (s Snapshot) String() string {
+	var keys []LatencyKey
+	for k := range s {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Name != keys[j].Name {
+			return keys[i].Name < keys[j].Name
+		}
+		return keys[i].Prefix < keys[j].Prefix
+	})
+
+	var lines []string
+	for _, k := range keys {
+		name := k.Name
+		if k.Prefix != "" {
+			name += " " + k.Prefix
+		}
+		lines = append(lines, fmt.Sprintf("%s: %v", name, s[k]))
+	}
+	return strings.Join(lines, "\n")
 }
 
 type LatencyMap struct {
 	sync.Mutex
-	stats map[string]*latencyMapEntry
+	stats map[LatencyKey]*Histogram
+
+	// Number of path components used for the breakdown in
+	// AddPath. 0 disables the breakdown.
+	prefixDepth int
 }
 
 func NewLatencyMap() *LatencyMap {
 	m := &LatencyMap{}
-	m.stats = make(map[string]*latencyMapEntry)
+	m.stats = make(map[LatencyKey]*Histogram)
 	return m
 }
 
-func (m *LatencyMap) Get(name string) (count int, dt time.Duration) {
+// SetPrefixDepth makes AddPath also record latencies per path
+// prefix of the given number of components, eg. "sub/dir" for
+// "/sub/dir/file.txt" with depth 2.
+func (m *LatencyMap) SetPrefixDepth(depth int) {
 	m.Mutex.Lock()
-	l := m.stats[name]
+	m.prefixDepth = depth
 	m.Mutex.Unlock()
-	return l.count, l.dur
 }
 
-func (m *LatencyMap) Add(name string, dt time.Duration) {
+func (m *LatencyMap) Get(name string) (count int, dt time.Duration) {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	l := m.stats[LatencyKey{Name: name}]
+	if l == nil {
+		return 0, 0
+	}
+	return l.Count, l.Total
+}
+
+// Percentile returns the given percentile of the latencies of name.
+func (m *LatencyMap) Percentile(name string, p float64) time.Duration {
 	m.Mutex.Lock()
-	e := m.stats[name]
+	defer m.Mutex.Unlock()
+	l := m.stats[LatencyKey{Name: name}]
+	if l == nil {
+		return 0
+	}
+	return l.Percentile(p)
+}
+
+func (m *LatencyMap) add(k LatencyKey, dt time.Duration) {
+	e := m.stats[k]
 	if e == nil {
-		e = new(latencyMapEntry)
-		m.stats[name] = e
+		e = new(Histogram)
+		m.stats[k] = e
+	}
+	e.add(dt)
+}
+
+func (m *LatencyMap) Add(name string, dt time.Duration) {
+	m.Mutex.Lock()
+	m.add(LatencyKey{Name: name}, dt)
+	m.Mutex.Unlock()
+}
+
+// AddPath records a latency for an operation on the given path. It
+// counts towards the totals of name, and if a prefix depth is set,
+// towards the path prefix. Wrap a pathfs.FileSystem with
+// pathfs.NewLatencyFileSystem to record its operations this way.
+func (m *LatencyMap) AddPath(name, path string, dt time.Duration) {
+	m.Mutex.Lock()
+	m.add(LatencyKey{Name: name}, dt)
+	if m.prefixDepth > 0 {
+		m.add(LatencyKey{name, pathPrefix(path, m.prefixDepth)}, dt)
 	}
-	e.count++
-	e.dur += dt
 	m.Mutex.Unlock()
 }
 
+// pathPrefix returns the first depth components of path, or "/" for
+// the root.
+func pathPrefix(path string, depth int) string {
+	comps := strings.FieldsFunc(path, func(r rune) bool { return r == '/' })
+	if len(comps) == 0 {
+		return "/"
+	}
+	if len(comps) > depth {
+		comps = comps[:depth]
+	}
+	return strings.Join(comps, "/")
+}
+
 func (m *LatencyMap) Counts() map[string]int {
 	r := make(map[string]int)
 	m.Mutex.Lock()
 	for k, v := range m.stats {
-		r[k] = v.count
+		if k.Prefix == "" {
+			r[k.Name] = v.Count
+		}
 	}
 	m.Mutex.Unlock()
 
 	return r
 }
+
+// Snapshot returns a copy of the histograms recorded so far.
+func (m *LatencyMap) Snapshot() Snapshot {
+	r := Snapshot{}
+	m.Mutex.Lock()
+	for k, v := range m.stats {
+		c := *v
+		r[k] = &c
+	}
+	m.Mutex.Unlock()
+	return r
+}
+
+// Reset discards all recorded latencies.
+func (m *LatencyMap) Reset() {
+	m.Mutex.Lock()
+	m.stats = make(map[LatencyKey]*Histogram)
+	m.Mutex.Unlock()
+}
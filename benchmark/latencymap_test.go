@@ -14,3 +14,65 @@ func TestLatencyMap(t *testing.T) {
 		t.Errorf("got %v, %d, want 2, 150ms", c, d)
 	}
 }
+
+func TestLatencyMapPercentile(t *testing.T) {
+	m := NewLatencyMap()
+	for i := 1; i <= 100; i++ {
+		m.Add("foo", time.Duration(i)*time.Millisecond)
+	}
+	for _, tc := range []struct {
+		p    float64
+		want time.Duration
+	}{{50, 50 * time.Millisecond}, {99, 99 * time.Millisecond}, {100, 100 * time.Millisecond}} {
+		got := m.Percentile("foo", tc.p)
+		// Buckets are 19% wide, and percentiles are rounded up.
+		if got < tc.want || float64(got) > 1.2*float64(tc.want) {
+			t.Errorf("p%v: got %v, want about %v", tc.p, got, tc.want)
+		}
+	}
+	if got := m.Percentile("bar", 50); got != 0 {
+		t.Errorf("got %v for unknown name", got)
+	}
+}
+
+func TestLatencyMapSnapshot(t *testing.T) {
+	m := NewLatencyMap()
+	m.SetPrefixDepth(1)
+	m.AddPath("LOOKUP", "/sub/dir/foo.txt", time.Millisecond)
+	m.AddPath("LOOKUP", "file.txt", time.Millisecond)
+	before := m.Snapshot()
+
+	m.AddPath("LOOKUP", "sub/marine.txt", time.Second)
+	m.Add("GETATTR", time.Millisecond)
+	after := m.Snapshot()
+
+	if h := after[LatencyKey{"LOOKUP", "sub"}]; h == nil || h.Count != 2 {
+		t.Errorf("got %v for prefix sub", h)
+	}
+	if c, _ := m.Get("LOOKUP"); c != 3 {
+		t.Errorf("got count %d, want 3", c)
+	}
+	if counts := m.Counts(); len(counts) != 2 {
+		t.Errorf("got counts %v", counts)
+	}
+
+	diff := after.Diff(before)
+	if len(diff) != 3 {
+		t.Fatalf("got diff %v", diff)
+	}
+	h := diff[LatencyKey{"LOOKUP", "sub"}]
+	if h.Count != 1 || h.Total != time.Second || h.Percentile(50) < time.Second {
+		t.Errorf("got diff for prefix sub %v", h)
+	}
+	if _, ok := diff[LatencyKey{"LOOKUP", "file.txt"}]; ok {
+		t.Errorf("unchanged histogram in diff %v", diff)
+	}
+
+	m.Reset()
+	if c, _ := m.Get("LOOKUP"); c != 0 {
+		t.Errorf("got count %d after Reset", c)
+	}
+	if h := before[LatencyKey{Name: "LOOKUP"}]; h.Count != 2 {
+		t.Errorf("Reset changed snapshot: %v", h)
+	}
+}
@@ -100,6 +100,36 @@ func TestNewStatFs(t *testing.T) {
 	}
 }
 
+func TestLatencyMapPaths(t *testing.T) {
+	fs := NewStatFs()
+	for _, n := range []string{"file.txt", "sub/dir/foo.txt", "sub/marine.txt"} {
+		fs.AddFile(n)
+	}
+	lmap := NewLatencyMap()
+	lmap.SetPrefixDepth(1)
+
+	wd, clean := setupFs(pathfs.NewLatencyFileSystem(fs, lmap))
+	defer clean()
+
+	for _, n := range []string{"file.txt", "sub/dir/foo.txt", "sub/marine.txt"} {
+		if _, err := os.Lstat(filepath.Join(wd, n)); err != nil {
+			t.Fatalf("Lstat(%q): %v", n, err)
+		}
+	}
+
+	s := lmap.Snapshot()
+	if h := s[LatencyKey{"GetAttr", "sub"}]; h == nil || h.Count < 3 {
+		// sub, sub/dir, sub/dir/foo.txt, sub/marine.txt
+		t.Errorf("got %v for prefix sub, want at least 3 calls", h)
+	}
+	if h := s[LatencyKey{"GetAttr", "file.txt"}]; h == nil || h.Count < 1 {
+		t.Errorf("got %v for file.txt", h)
+	}
+	if c, _ := lmap.Get("GetAttr"); c < 4 {
+		t.Errorf("got %d GetAttr calls, want at least 4", c)
+	}
+}
+
 func BenchmarkGoFuseThreadedStat(b *testing.B) {
 	b.StopTimer()
 	fs := NewStatFs()
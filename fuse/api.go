@@ -4,6 +4,10 @@
 
 package fuse
 
+import (
+	"time"
+)
+
 // Types for users to implement.
 
 // The result of Read is an array of bytes, but for performance
@@ -27,16 +31,49 @@ type ReadResult interface {
 type MountOptions struct {
 	AllowOther bool
 
-	// Options are passed as -o string to fusermount.
+	// Options are passed as -o string to fusermount. An entry
+	// may hold several options separated by commas. With
+	// DirectMount, they are translated to mount(2) flags and
+	// data; options that only fusermount knows make the direct
+	// mount fail. Prefer the typed fields below where they
+	// exist. ParseMountOptions fills these from an -o string.
 	Options []string
 
+	// Mount read-only ("ro").
+	ReadOnly bool
+
+	// Have the kernel check permissions based on the file mode,
+	// rather than leaving it to the file system
+	// ("default_permissions").
+	DefaultPermissions bool
+
+	// Have fusermount unmount the file system when the process
+	// exits, even if it crashes ("auto_unmount"). Needs
+	// fusermount, so it cannot be used with DirectMountStrict.
+	AutoUnmount bool
+
+	// The source of the mount, as shown in /proc/mounts and df
+	// ("fsname"). Must not contain commas.
+	FsName string
+
+	// Maximum size of READ requests ("max_read"). 0 leaves the
+	// kernel default.
+	MaxRead int
+
+	// Block size, only used for block device mounts ("blksize").
+	// go-fuse cannot make fuseblk mounts yet, so this must be 0;
+	// mounting fails otherwise.
+	BlockSize int
+
 	// Default is _DEFAULT_BACKGROUND_TASKS, 12.  This numbers
 	// controls the allowed number of requests that relate to
 	// async I/O.  Concurrency for synchronous I/O is not limited.
 	MaxBackground int
 
 	// Write size to use.  If 0, use default. This number is
-	// capped at the kernel maximum.
+	// capped at MAX_KERNEL_WRITE_MAX_PAGES. Sizes above
+	// MAX_KERNEL_WRITE are only used if the kernel supports
+	// CAP_MAX_PAGES; otherwise MaxWrite is lowered at INIT.
 	MaxWrite int
 
 	// If IgnoreSecurityLabels is set, all security related xattr
@@ -53,12 +90,124 @@ type MountOptions struct {
 	// This may be useful for NFS.
 	RememberInodes bool
 
-	// The name will show up on the output of the mount. Keep this string
-	// small.
+	// The name will show up on the output of the mount, as the
+	// file system type "fuse.<name>" ("subtype"). Keep this string
+	// small. Default is a prefix of the file system's String().
 	Name string
 
-	// If set, wrap the file system in a single-threaded locking wrapper.
+	// If set, wrap the file system in a single-threaded locking
+	// wrapper. To bound concurrency without serializing all
+	// calls, use MaxHandlers instead.
 	SingleThreaded bool
+
+	// Maximum number of requests that are handled concurrently.
+	// Further requests are queued until a handler finishes;
+	// queued metadata requests go before queued data requests.
+	// FORGET, INTERRUPT and a few other cheap requests are never
+	// queued, nor is SETLKW, which may wait for the release of a
+	// lock. Default is 0, no limit.
+	MaxHandlers int
+
+	// Maximum number of data requests (READ, WRITE, FLUSH, FSYNC,
+	// FALLOCATE, LSEEK and COPY_FILE_RANGE) that are handled
+	// concurrently. Setting this below MaxHandlers keeps
+	// handlers available for LOOKUP, GETATTR and the like when
+	// slow reads pile up. Default is 0, no separate limit.
+	MaxDataHandlers int
+
+	// Maximum number of concurrent requests per opcode, keyed by
+	// the opcode names used in debug output, eg. "READDIR".
+	OpcodeLimits map[string]int
+
+	// Maximum number of requests that wait for a handler. When
+	// the queue is full, the Server stops reading requests until
+	// a handler picks up a queued request, so INTERRUPT and
+	// NOTIFY_REPLY are not read either in the meantime. Default
+	// is 256.
+	//
+	// A queued request keeps a copy of its message, which for a
+	// WRITE includes the data, so a queue of writes can hold up
+	// to MaxQueued times MaxWrite bytes.
+	MaxQueued int
+
+	// If set, requests that take longer than this are reported
+	// to OnSlowRequest, once per request, and listed by
+	// Server.DebugData, with the stack of the goroutine handling
+	// them. Requests that wait for a handler are included. Useful
+	// to find out where a stalled backend hangs.
+	SlowRequestThreshold time.Duration
+
+	// Called from a separate goroutine for each request that
+	// exceeds SlowRequestThreshold.
+	OnSlowRequest func(SlowRequest)
+
+	// If set, requests are spliced from the FUSE device into a
+	// pipe, and the payload of a WRITE is left there, so the file
+	// system can move it to its destination with SpliceWrite
+	// rather than copying it. Needs a kernel with splice support.
+	EnableSpliceWrites bool
+
+	// Number of channels to read requests from. If larger than 1,
+	// the FUSE device is cloned (FUSE_DEV_IOC_CLONE, Linux 4.2 and
+	// later), and each clone gets its own readers, which reduces
+	// contention on machines with many cores. Default is 1.
+	Queues int
+
+	// Maximum number of goroutines per queue that wait for
+	// requests. Requests are handled by the goroutine that read
+	// them, so this does not limit concurrency; see MaxHandlers
+	// for that. Default is 2.
+	MaxReaders int
+
+	// If set, ask the kernel to forward POSIX and flock locks to
+	// the file system. If unset, the kernel handles locks locally,
+	// which means they are invisible to other clients of the
+	// backing store. If you set this, the file system must
+	// implement GetLk, SetLk and SetLkw.
+	EnableLocks bool
+
+	// If set, let the kernel issue lookups and readdirs in the
+	// same directory concurrently. The file system must be safe
+	// for that.
+	EnableParallelDirOps bool
+
+	// If set, mark opened directories with FOPEN_CACHE_DIR and
+	// FOPEN_KEEP_CACHE, so the kernel caches directory listings
+	// across opens. Use InodeNotify to invalidate them.
+	EnableDirCache bool
+
+	// If set, let the kernel cache symlink targets. Use
+	// InodeNotify to invalidate them.
+	EnableSymlinkCache bool
+
+	// If set, tell the kernel that Open and OpenDir may return
+	// ENOSYS, in which case it will stop sending them, and send
+	// further requests with a zero file handle. The file system
+	// must support the latter.
+	EnableNoOpen bool
+
+	// If set, let the kernel cache writes, and flush them to the
+	// file system in larger chunks. The kernel then owns the
+	// size and mtime of files: it computes O_APPEND offsets
+	// itself, sends updated mtimes through SetAttr, and may read
+	// from files that were opened write-only.
+	EnableWritebackCache bool
+
+	// If set, mount with mount(2) rather than the fusermount
+	// helper, and unmount with umount2(2). This needs
+	// CAP_SYS_ADMIN, eg. running as root, possibly in a user
+	// namespace, but no fusermount binary. If the direct mount
+	// fails, fusermount is tried instead.
+	DirectMount bool
+
+	// If set along with DirectMount, do not fall back to
+	// fusermount.
+	DirectMountStrict bool
+
+	// If set, detach a stale FUSE mount, left behind by a server
+	// that crashed, from the mount point before mounting. See
+	// CleanupStaleMount.
+	CleanupStaleMount bool
 }
 
 // RawFileSystem is an interface close to the FUSE wire protocol.
@@ -108,10 +257,45 @@ type RawFileSystem interface {
 
 	Release(input *ReleaseIn)
 	Write(input *WriteIn, data []byte) (written uint32, code Status)
+
+	// SpliceWrite is called instead of Write if the payload was
+	// spliced from the device (see
+	// MountOptions.EnableSpliceWrites). Return ENOSYS without
+	// touching data to have the Server copy the payload and call
+	// Write.
+	SpliceWrite(input *WriteIn, data *WritePipe) (written uint32, code Status)
 	Flush(input *FlushIn) Status
 	Fsync(input *FsyncIn) (code Status)
 	Fallocate(input *FallocateIn) (code Status)
 
+	// Lseek is only called for SEEK_DATA and SEEK_HOLE; the kernel
+	// handles the other whence values itself. Returning ENOSYS
+	// makes the kernel treat files as having no holes.
+	Lseek(input *LseekIn, out *LseekOut) (code Status)
+
+	// CopyFileRange copies data between two open files without
+	// passing it through the kernel. If it returns ENOSYS, the
+	// kernel falls back to reading and writing.
+	CopyFileRange(input *CopyFileRangeIn) (written uint32, code Status)
+
+	// File locking. These are only called if
+	// MountOptions.EnableLocks is set. SetLkw should block until
+	// the lock can be acquired.
+	GetLk(input *LkIn, out *LkOut) (code Status)
+	SetLk(input *LkIn) (code Status)
+	SetLkw(input *LkIn) (code Status)
+
+	// Ioctl is only called for restricted ioctls, whose argument
+	// sizes are encoded in the command. inData holds the input
+	// argument; outData has room for OutSize bytes of output, and
+	// is returned to the caller as is if the call succeeds.
+	Ioctl(input *IoctlIn, inData []byte, out *IoctlOut, outData []byte) (code Status)
+
+	// Poll returns the ready events for the file in out.Revents.
+	// Returning ENOSYS makes the kernel stop sending Poll, and
+	// treat all files on the mount as always ready.
+	Poll(input *PollIn, out *PollOut) (code Status)
+
 	// Directory handling
 	OpenDir(input *OpenIn, out *OpenOut) (status Status)
 	ReadDir(input *ReadIn, out *DirEntryList) Status
@@ -25,6 +25,31 @@ type BufferPool interface {
 	String() string
 }
 
+// BufferPoolStats describes the buffers of a BufferPool.
+type BufferPoolStats struct {
+	// Buffers allocated over the lifetime of the pool.
+	Created int
+
+	// Buffers handed out and not yet returned.
+	Outstanding int
+
+	// Buffers kept for reuse, and their total size.
+	Free      int
+	FreeBytes int
+}
+
+// BufferPoolStats returns the usage of MountOptions.Buffers. It
+// returns false if the pool does not keep statistics.
+func (ms *Server) BufferPoolStats() (BufferPoolStats, bool) {
+	p, ok := ms.opts.Buffers.(interface {
+		Stats() BufferPoolStats
+	})
+	if !ok {
+		return BufferPoolStats{}, false
+	}
+	return p.Stats(), true
+}
+
 type gcBufferPool struct {
 }
 
@@ -85,6 +110,21 @@ func (p *bufferPoolImpl) String() string {
 		strings.Join(result, ", "))
 }
 
+func (p *bufferPoolImpl) Stats() BufferPoolStats {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	s := BufferPoolStats{
+		Created:     p.createdBuffers,
+		Outstanding: len(p.outstandingBuffers),
+	}
+	for pages, bufs := range p.buffersBySize {
+		s.Free += len(bufs)
+		s.FreeBytes += len(bufs) * pages * PAGESIZE
+	}
+	return s
+}
+
 func (p *bufferPoolImpl) getBuffer(pageCount int) []byte {
 	for ; pageCount < len(p.buffersBySize); pageCount++ {
 		bufferList := p.buffersBySize[pageCount]
@@ -23,3 +23,15 @@ func TestFreeBufferEmpty(t *testing.T) {
 	c := make([]byte, 0, 2*PAGESIZE)
 	bp.FreeBuffer(c)
 }
+
+func TestBufferPoolStats(t *testing.T) {
+	bp := NewBufferPool().(*bufferPoolImpl)
+	b1 := bp.AllocBuffer(PAGESIZE)
+	bp.AllocBuffer(2 * PAGESIZE)
+	bp.FreeBuffer(b1)
+
+	want := BufferPoolStats{Created: 2, Outstanding: 1, Free: 1, FreeBytes: PAGESIZE}
+	if got := bp.Stats(); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,7 @@
+package fuse
+
+// mountDevice returns the device number of the mount, which is only
+// used for the fusectl file system of Linux.
+func mountDevice(mountPoint string) uint64 {
+	return 0
+}
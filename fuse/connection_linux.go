@@ -0,0 +1,125 @@
+package fuse
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Where the fusectl file system is mounted. It has a directory for
+// each FUSE connection, named after the device number of the mount.
+const fusectlDir = "/sys/fs/fuse/connections"
+
+// ConnectionDir returns the directory in /sys/fs/fuse/connections
+// that controls the kernel side of the mount. It needs the fusectl
+// file system to be mounted there, and only works for servers that
+// were created with NewServer.
+func (ms *Server) ConnectionDir() (string, error) {
+	if ms.mountPoint == "" || ms.mountDev == 0 {
+		return "", fmt.Errorf("server has no mount")
+	}
+	dir := filepath.Join(fusectlDir, strconv.FormatUint(ms.mountDev, 10))
+	if _, err := os.Stat(dir); err != nil {
+		return "", fmt.Errorf("connection directory: %v (is fusectl mounted on %s?)", err, fusectlDir)
+	}
+	return dir, nil
+}
+
+// mountDevice returns the device number of the topmost mount on
+// mountPoint, in the kernel's own encoding, which names the fusectl
+// directory of a FUSE mount. It returns 0 if it cannot be found.
+func mountDevice(mountPoint string) uint64 {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	dev, _ := parseMountDevice(f, mountPoint)
+	return dev
+}
+
+// parseMountDevice finds the device number of the topmost mount on
+// mountPoint in a table in the format of /proc/self/mountinfo.
+func parseMountDevice(r io.Reader, mountPoint string) (uint64, error) {
+	var dev uint64
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || unescapeMountInfo(fields[4]) != mountPoint {
+			continue
+		}
+		i := strings.Index(fields[2], ":")
+		if i < 0 {
+			continue
+		}
+		major, _ := strconv.ParseUint(fields[2][:i], 10, 32)
+		minor, _ := strconv.ParseUint(fields[2][i+1:], 10, 32)
+		dev = major<<20 | minor
+	}
+	return dev, scanner.Err()
+}
+
+func (ms *Server) readConnectionFile(name string) (int, error) {
+	dir, err := ms.ConnectionDir()
+	if err != nil {
+		return 0, err
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(content)))
+}
+
+func (ms *Server) writeConnectionFile(name string, val int) error {
+	dir, err := ms.ConnectionDir()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, name), []byte(strconv.Itoa(val)), 0)
+}
+
+// Waiting returns the number of requests that the kernel has queued
+// for the server, or sent and not seen answered yet.
+func (ms *Server) Waiting() (int, error) {
+	return ms.readConnectionFile("waiting")
+}
+
+// Abort aborts the connection: all pending and further requests fail
+// with ENOTCONN, and Serve returns. The mount stays in place, stale,
+// until it is unmounted; see CleanupStaleMount.
+func (ms *Server) Abort() error {
+	return ms.writeConnectionFile("abort", 1)
+}
+
+// MaxBackground returns the number of background requests, such as
+// readahead and asynchronous writes, that the kernel sends
+// concurrently. It starts out as MountOptions.MaxBackground.
+func (ms *Server) MaxBackground() (int, error) {
+	return ms.readConnectionFile("max_background")
+}
+
+// SetMaxBackground changes the limit on concurrent background
+// requests. Changing it needs CAP_SYS_ADMIN.
+func (ms *Server) SetMaxBackground(n int) error {
+	return ms.writeConnectionFile("max_background", n)
+}
+
+// CongestionThreshold returns the number of background requests
+// above which the kernel considers the connection congested, and
+// holds back further readahead and writeback.
+func (ms *Server) CongestionThreshold() (int, error) {
+	return ms.readConnectionFile("congestion_threshold")
+}
+
+// SetCongestionThreshold changes the congestion threshold. Changing
+// it needs CAP_SYS_ADMIN.
+func (ms *Server) SetCongestionThreshold(n int) error {
+	return ms.writeConnectionFile("congestion_threshold", n)
+}
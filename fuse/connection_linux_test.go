@@ -0,0 +1,94 @@
+package fuse
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseMountDevice(t *testing.T) {
+	table := `22 1 0:21 / /proc rw,nosuid - proc proc rw
+36 22 0:40 / /mnt/my\040dir rw,nosuid,nodev shared:5 - fuse.myfs myfs rw,user_id=0
+38 22 0:42 / /mnt/other rw - tmpfs tmpfs rw
+39 38 8:1 / /mnt/other rw - fuseblk /dev/sda1 rw,user_id=0
+`
+	for path, want := range map[string]uint64{
+		"/mnt/my dir": 40,
+		"/mnt/other":  8<<20 | 1,
+		"/mnt":        0,
+	} {
+		got, err := parseMountDevice(strings.NewReader(table), path)
+		if err != nil || got != want {
+			t.Errorf("parseMountDevice(%q): got %d, %v, want %d", path, got, err, want)
+		}
+	}
+}
+
+func TestConnectionControl(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("needs root for direct mounts")
+	}
+	if _, err := os.Stat(fusectlDir); err != nil {
+		t.Skipf("fusectl is not mounted: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "TestConnectionControl")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ms, err := NewServer(&attrFS{NewDefaultRawFileSystem()}, dir, &MountOptions{
+		DirectMount:   true,
+		MaxBackground: 12,
+	})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		ms.Serve()
+		close(done)
+	}()
+	ms.WaitMount()
+
+	if _, err := ms.ConnectionDir(); err != nil {
+		t.Fatalf("ConnectionDir: %v", err)
+	}
+	if n, err := ms.Waiting(); err != nil || n != 0 {
+		t.Errorf("Waiting: got %d, %v", n, err)
+	}
+	if n, err := ms.MaxBackground(); err != nil || n != 12 {
+		t.Errorf("MaxBackground: got %d, %v, want 12", n, err)
+	}
+	if err := ms.SetMaxBackground(20); err != nil {
+		t.Errorf("SetMaxBackground: %v", err)
+	}
+	if n, err := ms.MaxBackground(); err != nil || n != 20 {
+		t.Errorf("MaxBackground after set: got %d, %v, want 20", n, err)
+	}
+	if err := ms.SetCongestionThreshold(15); err != nil {
+		t.Errorf("SetCongestionThreshold: %v", err)
+	}
+	if n, err := ms.CongestionThreshold(); err != nil || n != 15 {
+		t.Errorf("CongestionThreshold: got %d, %v, want 15", n, err)
+	}
+
+	if err := ms.Abort(); err != nil {
+		t.Fatalf("Abort: %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return after Abort")
+	}
+	var st syscall.Stat_t
+	if err := syscall.Stat(dir, &st); err != syscall.ENOTCONN {
+		t.Errorf("Stat after Abort: got %v, want ENOTCONN", err)
+	}
+	if cleaned, err := CleanupStaleMount(dir); err != nil || !cleaned {
+		t.Errorf("CleanupStaleMount: %v, %v", cleaned, err)
+	}
+}
@@ -14,10 +14,18 @@ const (
 
 	FUSE_LK_FLOCK = (1 << 0)
 
+	// End of a FileLock that extends to the end of the file.
+	OFFSET_MAX = (1 << 63) - 1
+
 	FUSE_IOCTL_MAX_IOV = 256
 
 	FUSE_POLL_SCHEDULE_NOTIFY = (1 << 0)
 
+	// Flags for RenameIn, as for renameat2(2).
+	RENAME_NOREPLACE = (1 << 0)
+	RENAME_EXCHANGE  = (1 << 1)
+	RENAME_WHITEOUT  = (1 << 2)
+
 	CUSE_INIT_INFO_MAX = 4096
 
 	S_IFDIR = syscall.S_IFDIR
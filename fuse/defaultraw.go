@@ -120,6 +120,10 @@ func (fs *defaultRawFileSystem) Write(input *WriteIn, data []byte) (written uint
 	return 0, ENOSYS
 }
 
+func (fs *defaultRawFileSystem) SpliceWrite(input *WriteIn, data *WritePipe) (written uint32, code Status) {
+	return 0, ENOSYS
+}
+
 func (fs *defaultRawFileSystem) Flush(input *FlushIn) Status {
 	return OK
 }
@@ -146,3 +150,31 @@ func (fs *defaultRawFileSystem) FsyncDir(input *FsyncIn) (code Status) {
 func (fs *defaultRawFileSystem) Fallocate(in *FallocateIn) (code Status) {
 	return ENOSYS
 }
+
+func (fs *defaultRawFileSystem) Lseek(in *LseekIn, out *LseekOut) (code Status) {
+	return ENOSYS
+}
+
+func (fs *defaultRawFileSystem) CopyFileRange(input *CopyFileRangeIn) (written uint32, code Status) {
+	return 0, ENOSYS
+}
+
+func (fs *defaultRawFileSystem) GetLk(in *LkIn, out *LkOut) (code Status) {
+	return ENOSYS
+}
+
+func (fs *defaultRawFileSystem) SetLk(in *LkIn) (code Status) {
+	return ENOSYS
+}
+
+func (fs *defaultRawFileSystem) SetLkw(in *LkIn) (code Status) {
+	return ENOSYS
+}
+
+func (fs *defaultRawFileSystem) Ioctl(in *IoctlIn, inData []byte, out *IoctlOut, outData []byte) (code Status) {
+	return ENOSYS
+}
+
+func (fs *defaultRawFileSystem) Poll(in *PollIn, out *PollOut) (code Status) {
+	return ENOSYS
+}
@@ -0,0 +1,17 @@
+// Package fuse provides the kernel protocol of FUSE: the Server reads
+// requests from the kernel and passes them to a RawFileSystem. The
+// nodefs and pathfs packages build friendlier APIs on top of it.
+//
+// The caller data in the request header, InHeader.Caller, is a
+// Caller. It used to be an embedded Context, which RawFileSystem
+// implementations passed on as (*Context)(&input.Context). Context is
+// now a separate struct that also carries the cancellation of the
+// request, so such code has to change:
+//
+//	input.Context                   -> input.Caller
+//	(*fuse.Context)(&input.Context) -> server.Context(&input.InHeader)
+//
+// where server is the *Server passed to RawFileSystem.Init. Literals
+// like fuse.Context{Owner: o, Pid: p} still work, and make a Context
+// that is never cancelled.
+package fuse
@@ -0,0 +1,341 @@
+// Package fakekernel drives a fuse.RawFileSystem in-process, issuing
+// the calls that the kernel would issue for common operations. This
+// allows testing file systems without /dev/fuse, fusermount or
+// privileges.
+//
+// The Kernel keeps track of lookup counts like the kernel does, so
+// tests can check that a file system handles Forget correctly.
+// Notifications from the file system to the kernel are not
+// supported.
+package fakekernel
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// Kernel issues requests to a RawFileSystem. All methods take node
+// IDs as returned by Lookup and friends; the root is
+// fuse.FUSE_ROOT_ID.
+type Kernel struct {
+	fs fuse.RawFileSystem
+
+	// Caller is passed with each request. It defaults to the
+	// identity of the current process.
+	Caller fuse.Caller
+
+	mu      sync.Mutex
+	unique  uint64
+	lookups map[uint64]uint64
+}
+
+// New returns a Kernel for the given file system, eg. the result
+// of nodefs.FileSystemConnector.RawFS.
+func New(fs fuse.RawFileSystem) *Kernel {
+	return &Kernel{
+		fs: fs,
+		Caller: fuse.Caller{
+			Owner: fuse.Owner{
+				Uid: uint32(os.Getuid()),
+				Gid: uint32(os.Getgid()),
+			},
+			Pid: uint32(os.Getpid()),
+		},
+		lookups: map[uint64]uint64{},
+	}
+}
+
+func (k *Kernel) header(nodeid uint64) fuse.InHeader {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.unique++
+	return fuse.InHeader{
+		Unique: k.unique,
+		NodeId: nodeid,
+		Caller: k.Caller,
+	}
+}
+
+// addLookup records the reference that a successful entry reply
+// gives the kernel.
+func (k *Kernel) addLookup(out *fuse.EntryOut, code fuse.Status) {
+	if !code.Ok() || out.NodeId == 0 {
+		return
+	}
+	k.mu.Lock()
+	k.lookups[out.NodeId]++
+	k.mu.Unlock()
+}
+
+// Lookups returns the number of outstanding lookups for a node.
+func (k *Kernel) Lookups(nodeid uint64) uint64 {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.lookups[nodeid]
+}
+
+// Lookup looks up name in the directory parent.
+func (k *Kernel) Lookup(parent uint64, name string) (*fuse.EntryOut, fuse.Status) {
+	h := k.header(parent)
+	out := &fuse.EntryOut{}
+	code := k.fs.Lookup(&h, name, out)
+	k.addLookup(out, code)
+	return out, code
+}
+
+// LookupPath looks up each component of a slash separated path,
+// starting at the root.
+func (k *Kernel) LookupPath(path string) (uint64, fuse.Status) {
+	nodeid := uint64(fuse.FUSE_ROOT_ID)
+	for _, c := range strings.Split(path, "/") {
+		if c == "" {
+			continue
+		}
+		out, code := k.Lookup(nodeid, c)
+		if !code.Ok() {
+			return 0, code
+		}
+		nodeid = out.NodeId
+	}
+	return nodeid, fuse.OK
+}
+
+// Forget drops nlookup references to the node.
+func (k *Kernel) Forget(nodeid, nlookup uint64) {
+	k.mu.Lock()
+	if k.lookups[nodeid] <= nlookup {
+		delete(k.lookups, nodeid)
+	} else {
+		k.lookups[nodeid] -= nlookup
+	}
+	k.mu.Unlock()
+	k.fs.Forget(nodeid, nlookup)
+}
+
+// ForgetAll forgets all outstanding lookups, as the kernel does when
+// the file system is unmounted.
+func (k *Kernel) ForgetAll() {
+	k.mu.Lock()
+	lookups := k.lookups
+	k.lookups = map[uint64]uint64{}
+	k.mu.Unlock()
+
+	for nodeid, n := range lookups {
+		k.fs.Forget(nodeid, n)
+	}
+}
+
+func (k *Kernel) GetAttr(nodeid uint64) (*fuse.Attr, fuse.Status) {
+	in := fuse.GetAttrIn{InHeader: k.header(nodeid)}
+	out := &fuse.AttrOut{}
+	code := k.fs.GetAttr(&in, out)
+	return &out.Attr, code
+}
+
+// SetAttr changes the attributes selected by in.Valid.
+func (k *Kernel) SetAttr(nodeid uint64, in *fuse.SetAttrIn) (*fuse.Attr, fuse.Status) {
+	in.InHeader = k.header(nodeid)
+	out := &fuse.AttrOut{}
+	code := k.fs.SetAttr(in, out)
+	return &out.Attr, code
+}
+
+func (k *Kernel) Mkdir(parent uint64, name string, mode uint32) (*fuse.EntryOut, fuse.Status) {
+	in := fuse.MkdirIn{InHeader: k.header(parent), Mode: mode}
+	out := &fuse.EntryOut{}
+	code := k.fs.Mkdir(&in, name, out)
+	k.addLookup(out, code)
+	return out, code
+}
+
+func (k *Kernel) Symlink(parent uint64, name string, target string) (*fuse.EntryOut, fuse.Status) {
+	h := k.header(parent)
+	out := &fuse.EntryOut{}
+	code := k.fs.Symlink(&h, target, name, out)
+	k.addLookup(out, code)
+	return out, code
+}
+
+func (k *Kernel) Readlink(nodeid uint64) (string, fuse.Status) {
+	h := k.header(nodeid)
+	target, code := k.fs.Readlink(&h)
+	return string(target), code
+}
+
+func (k *Kernel) Unlink(parent uint64, name string) fuse.Status {
+	h := k.header(parent)
+	return k.fs.Unlink(&h, name)
+}
+
+func (k *Kernel) Rmdir(parent uint64, name string) fuse.Status {
+	h := k.header(parent)
+	return k.fs.Rmdir(&h, name)
+}
+
+func (k *Kernel) Rename(olddir uint64, oldName string, newdir uint64, newName string, flags uint32) fuse.Status {
+	in := fuse.RenameIn{InHeader: k.header(olddir), Newdir: newdir, Flags: flags}
+	return k.fs.Rename(&in, oldName, newName)
+}
+
+// Create creates and opens a file. It returns the entry and the
+// file handle.
+func (k *Kernel) Create(parent uint64, name string, flags uint32, mode uint32) (*fuse.EntryOut, uint64, fuse.Status) {
+	in := fuse.CreateIn{InHeader: k.header(parent), Flags: flags, Mode: mode}
+	out := &fuse.CreateOut{}
+	code := k.fs.Create(&in, name, out)
+	k.addLookup(&out.EntryOut, code)
+	return &out.EntryOut, out.Fh, code
+}
+
+// Open opens a file, and returns its file handle.
+func (k *Kernel) Open(nodeid uint64, flags uint32) (uint64, fuse.Status) {
+	in := fuse.OpenIn{InHeader: k.header(nodeid), Flags: flags}
+	out := &fuse.OpenOut{}
+	code := k.fs.Open(&in, out)
+	return out.Fh, code
+}
+
+// Read reads up to size bytes at the given offset.
+func (k *Kernel) Read(nodeid, fh uint64, off int64, size int) ([]byte, fuse.Status) {
+	in := fuse.ReadIn{
+		InHeader: k.header(nodeid),
+		Fh:       fh,
+		Offset:   uint64(off),
+		Size:     uint32(size),
+	}
+	buf := make([]byte, size)
+	res, code := k.fs.Read(&in, buf)
+	if !code.Ok() {
+		return nil, code
+	}
+	data, code := res.Bytes(buf)
+	res.Done()
+	return data, code
+}
+
+func (k *Kernel) Write(nodeid, fh uint64, off int64, data []byte) (uint32, fuse.Status) {
+	in := fuse.WriteIn{
+		InHeader: k.header(nodeid),
+		Fh:       fh,
+		Offset:   uint64(off),
+		Size:     uint32(len(data)),
+	}
+	return k.fs.Write(&in, data)
+}
+
+// Lseek is sent for lseek(2) with SEEK_DATA or SEEK_HOLE. It
+// returns the new offset.
+func (k *Kernel) Lseek(nodeid, fh uint64, off int64, whence uint32) (int64, fuse.Status) {
+	in := fuse.LseekIn{
+		InHeader: k.header(nodeid),
+		Fh:       fh,
+		Offset:   uint64(off),
+		Whence:   whence,
+	}
+	out := &fuse.LseekOut{}
+	code := k.fs.Lseek(&in, out)
+	return int64(out.Offset), code
+}
+
+// CopyFileRange copies size bytes between two open files, and
+// returns the number of bytes copied.
+func (k *Kernel) CopyFileRange(nodeIn, fhIn uint64, offIn int64, nodeOut, fhOut uint64, offOut int64, size uint64) (uint32, fuse.Status) {
+	in := fuse.CopyFileRangeIn{
+		InHeader:  k.header(nodeIn),
+		FhIn:      fhIn,
+		OffIn:     uint64(offIn),
+		NodeIdOut: nodeOut,
+		FhOut:     fhOut,
+		OffOut:    uint64(offOut),
+		Len:       size,
+	}
+	return k.fs.CopyFileRange(&in)
+}
+
+// Flush is sent on each close(2) of a file descriptor.
+func (k *Kernel) Flush(nodeid, fh uint64) fuse.Status {
+	in := fuse.FlushIn{InHeader: k.header(nodeid), Fh: fh}
+	return k.fs.Flush(&in)
+}
+
+// Release is sent when the last reference to the file handle is
+// closed.
+func (k *Kernel) Release(nodeid, fh uint64) {
+	in := fuse.ReleaseIn{InHeader: k.header(nodeid), Fh: fh}
+	k.fs.Release(&in)
+}
+
+func (k *Kernel) StatFs(nodeid uint64) (*fuse.StatfsOut, fuse.Status) {
+	h := k.header(nodeid)
+	out := &fuse.StatfsOut{}
+	code := k.fs.StatFs(&h, out)
+	return out, code
+}
+
+// dirent mirrors the layout of a directory entry in a READDIR reply.
+type dirent struct {
+	Ino     uint64
+	Off     uint64
+	NameLen uint32
+	Typ     uint32
+}
+
+const direntSize = int(unsafe.Sizeof(dirent{}))
+
+// ReadDir opens a directory, reads all of its entries, and closes it
+// again.
+func (k *Kernel) ReadDir(nodeid uint64) ([]fuse.DirEntry, fuse.Status) {
+	in := fuse.OpenIn{InHeader: k.header(nodeid)}
+	out := fuse.OpenOut{}
+	if code := k.fs.OpenDir(&in, &out); !code.Ok() {
+		return nil, code
+	}
+	defer func() {
+		rel := fuse.ReleaseIn{InHeader: k.header(nodeid), Fh: out.Fh}
+		k.fs.ReleaseDir(&rel)
+	}()
+
+	var result []fuse.DirEntry
+	var off uint64
+	for {
+		in := fuse.ReadIn{
+			InHeader: k.header(nodeid),
+			Fh:       out.Fh,
+			Offset:   off,
+			Size:     4096,
+		}
+		// The buffer is zeroed, so an entry with an empty
+		// name marks the end of the data.
+		buf := make([]byte, in.Size)
+		if code := k.fs.ReadDir(&in, fuse.NewDirEntryList(buf, off)); !code.Ok() {
+			return nil, code
+		}
+
+		n := 0
+		for len(buf) >= direntSize {
+			d := (*dirent)(unsafe.Pointer(&buf[0]))
+			if d.NameLen == 0 || len(buf) < direntSize+int(d.NameLen) {
+				break
+			}
+			result = append(result, fuse.DirEntry{
+				Name: string(buf[direntSize : direntSize+int(d.NameLen)]),
+				Mode: d.Typ << 12,
+			})
+			off = d.Off
+			n++
+
+			sz := (direntSize + int(d.NameLen) + 7) &^ 7
+			if sz > len(buf) {
+				break
+			}
+			buf = buf[sz:]
+		}
+		if n == 0 {
+			return result, fuse.OK
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package fakekernel
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+	"github.com/hanwen/go-fuse/fuse/pathfs"
+)
+
+// exercise runs a sequence of common operations on an empty root.
+func exercise(t *testing.T, k *Kernel) {
+	dir, code := k.Mkdir(fuse.FUSE_ROOT_ID, "dir", 0755)
+	if !code.Ok() {
+		t.Fatalf("Mkdir failed: %v", code)
+	}
+	file, fh, code := k.Create(dir.NodeId, "file", uint32(os.O_RDWR), 0644)
+	if !code.Ok() {
+		t.Fatalf("Create failed: %v", code)
+	}
+	if n, code := k.Write(file.NodeId, fh, 0, []byte("hello")); !code.Ok() || n != 5 {
+		t.Fatalf("Write: got %d, %v", n, code)
+	}
+	k.Flush(file.NodeId, fh)
+	k.Release(file.NodeId, fh)
+
+	nodeid, code := k.LookupPath("dir/file")
+	if !code.Ok() {
+		t.Fatalf("LookupPath failed: %v", code)
+	}
+	if nodeid != file.NodeId {
+		t.Errorf("got node %d, want %d", nodeid, file.NodeId)
+	}
+	if got := k.Lookups(file.NodeId); got != 2 {
+		t.Errorf("got %d lookups, want 2", got)
+	}
+	a, code := k.GetAttr(nodeid)
+	if !code.Ok() || a.Size != 5 {
+		t.Errorf("GetAttr: got size %d, %v", a.Size, code)
+	}
+
+	fh, code = k.Open(nodeid, uint32(os.O_RDONLY))
+	if !code.Ok() {
+		t.Fatalf("Open failed: %v", code)
+	}
+	data, code := k.Read(nodeid, fh, 1, 100)
+	if !code.Ok() || string(data) != "ello" {
+		t.Errorf("Read: got %q, %v", data, code)
+	}
+	k.Release(nodeid, fh)
+
+	if _, code := k.Symlink(dir.NodeId, "link", "file"); !code.Ok() {
+		t.Fatalf("Symlink failed: %v", code)
+	}
+	link, _ := k.LookupPath("dir/link")
+	if target, code := k.Readlink(link); !code.Ok() || target != "file" {
+		t.Errorf("Readlink: got %q, %v", target, code)
+	}
+
+	entries, code := k.ReadDir(dir.NodeId)
+	if !code.Ok() {
+		t.Fatalf("ReadDir failed: %v", code)
+	}
+	var names []string
+	for _, e := range entries {
+		if e.Name == "." || e.Name == ".." {
+			continue
+		}
+		names = append(names, e.Name)
+	}
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "file" || names[1] != "link" {
+		t.Errorf("ReadDir: got %v, want [file link]", names)
+	}
+
+	if code := k.Rename(dir.NodeId, "file", fuse.FUSE_ROOT_ID, "moved", 0); !code.Ok() {
+		t.Fatalf("Rename failed: %v", code)
+	}
+	if _, code := k.Lookup(dir.NodeId, "file"); code != fuse.ENOENT {
+		t.Errorf("Lookup after rename: got %v, want ENOENT", code)
+	}
+	if code := k.Unlink(fuse.FUSE_ROOT_ID, "moved"); !code.Ok() {
+		t.Errorf("Unlink failed: %v", code)
+	}
+	if code := k.Unlink(dir.NodeId, "link"); !code.Ok() {
+		t.Errorf("Unlink failed: %v", code)
+	}
+	if code := k.Rmdir(fuse.FUSE_ROOT_ID, "dir"); !code.Ok() {
+		t.Errorf("Rmdir failed: %v", code)
+	}
+
+	k.ForgetAll()
+	if got := k.Lookups(file.NodeId); got != 0 {
+		t.Errorf("got %d lookups after ForgetAll", got)
+	}
+}
+
+// exerciseRename2 checks RENAME_NOREPLACE and RENAME_EXCHANGE.
+func exerciseRename2(t *testing.T, k *Kernel) {
+	for name, content := range map[string]string{"a": "a", "b": "bb"} {
+		e, fh, code := k.Create(fuse.FUSE_ROOT_ID, name, uint32(os.O_RDWR), 0644)
+		if !code.Ok() {
+			t.Fatalf("Create failed: %v", code)
+		}
+		k.Write(e.NodeId, fh, 0, []byte(content))
+		k.Flush(e.NodeId, fh)
+		k.Release(e.NodeId, fh)
+	}
+
+	if code := k.Rename(fuse.FUSE_ROOT_ID, "a", fuse.FUSE_ROOT_ID, "b", fuse.RENAME_NOREPLACE); code != fuse.Status(syscall.EEXIST) {
+		t.Errorf("Rename NOREPLACE: got %v, want EEXIST", code)
+	}
+	if code := k.Rename(fuse.FUSE_ROOT_ID, "a", fuse.FUSE_ROOT_ID, "b", fuse.RENAME_NOREPLACE|fuse.RENAME_EXCHANGE); code != fuse.EINVAL {
+		t.Errorf("Rename NOREPLACE|EXCHANGE: got %v, want EINVAL", code)
+	}
+	if code := k.Rename(fuse.FUSE_ROOT_ID, "a", fuse.FUSE_ROOT_ID, "c", fuse.RENAME_EXCHANGE); code != fuse.ENOENT {
+		t.Errorf("Rename EXCHANGE to missing: got %v, want ENOENT", code)
+	}
+	if code := k.Rename(fuse.FUSE_ROOT_ID, "a", fuse.FUSE_ROOT_ID, "b", fuse.RENAME_EXCHANGE); !code.Ok() {
+		t.Fatalf("Rename EXCHANGE: %v", code)
+	}
+	for name, size := range map[string]uint64{"a": 2, "b": 1} {
+		e, code := k.Lookup(fuse.FUSE_ROOT_ID, name)
+		if !code.Ok() {
+			t.Fatalf("Lookup(%q): %v", name, code)
+		}
+		if e.Attr.Size != size {
+			t.Errorf("%q: got size %d, want %d", name, e.Attr.Size, size)
+		}
+	}
+
+	if code := k.Rename(fuse.FUSE_ROOT_ID, "a", fuse.FUSE_ROOT_ID, "c", fuse.RENAME_NOREPLACE); !code.Ok() {
+		t.Errorf("Rename NOREPLACE: %v", code)
+	}
+	if _, code := k.Lookup(fuse.FUSE_ROOT_ID, "c"); !code.Ok() {
+		t.Errorf("Lookup after rename: %v", code)
+	}
+}
+
+func TestLoopback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-fuse-fakekernel")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	pfs := pathfs.NewPathNodeFs(pathfs.NewLoopbackFileSystem(dir), nil)
+	conn := nodefs.NewFileSystemConnector(pfs, nil)
+	k := New(conn.RawFS())
+	exercise(t, k)
+	exerciseRename2(t, k)
+
+	if _, err := os.Lstat(filepath.Join(dir, "dir")); err == nil {
+		t.Errorf("dir still exists in backing store")
+	}
+}
+
+func TestMemNodeFs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-fuse-fakekernel")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	conn := nodefs.NewFileSystemConnector(nodefs.NewMemNodeFs(dir+"/backing"), nil)
+	k := New(conn.RawFS())
+	exercise(t, k)
+	exerciseRename2(t, k)
+}
+
+func TestLookupMissing(t *testing.T) {
+	k := New(fuse.NewDefaultRawFileSystem())
+	if _, code := k.Lookup(fuse.FUSE_ROOT_ID, "x"); code != fuse.ENOSYS {
+		t.Errorf("got %v, want ENOSYS", code)
+	}
+	if got := k.Lookups(fuse.FUSE_ROOT_ID); got != 0 {
+		t.Errorf("failed lookup was counted")
+	}
+}
+
+// pathSeekFile hides Lseek and CopyFileRange of the loopback file, so
+// the calls fall through to the pathfs.FileSystem.
+type pathSeekFile struct {
+	nodefs.File
+}
+
+func (f *pathSeekFile) Lseek(off uint64, whence uint32) (uint64, fuse.Status) {
+	return 0, fuse.ENOSYS
+}
+
+func (f *pathSeekFile) CopyFileRange(offIn uint64, out nodefs.File, offOut uint64, size uint64, flags uint64) (uint32, fuse.Status) {
+	return 0, fuse.ENOSYS
+}
+
+type pathSeekFS struct {
+	pathfs.FileSystem
+	seeks  int
+	copies int
+}
+
+func (fs *pathSeekFS) Open(name string, flags uint32, context *fuse.Context) (nodefs.File, fuse.Status) {
+	f, code := fs.FileSystem.Open(name, flags, context)
+	if !code.Ok() {
+		return nil, code
+	}
+	return &pathSeekFile{f}, code
+}
+
+func (fs *pathSeekFS) Lseek(name string, off uint64, whence uint32, context *fuse.Context) (uint64, fuse.Status) {
+	fs.seeks++
+	return fs.FileSystem.Lseek(name, off, whence, context)
+}
+
+func (fs *pathSeekFS) CopyFileRange(nameIn string, offIn uint64, nameOut string, offOut uint64, size uint64, flags uint64, context *fuse.Context) (uint32, fuse.Status) {
+	fs.copies++
+	return fs.FileSystem.CopyFileRange(nameIn, offIn, nameOut, offOut, size, flags, context)
+}
+
+func TestPathFsLseekCopyFileRange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-fuse-fakekernel")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := []byte("hello world")
+	if err := ioutil.WriteFile(dir+"/src", content, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := ioutil.WriteFile(dir+"/dst", nil, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	fs := &pathSeekFS{FileSystem: pathfs.NewLoopbackFileSystem(dir)}
+	conn := nodefs.NewFileSystemConnector(pathfs.NewPathNodeFs(fs, nil), nil)
+	k := New(conn.RawFS())
+
+	src, code := k.LookupPath("src")
+	if !code.Ok() {
+		t.Fatalf("Lookup failed: %v", code)
+	}
+	dst, code := k.LookupPath("dst")
+	if !code.Ok() {
+		t.Fatalf("Lookup failed: %v", code)
+	}
+	fhIn, code := k.Open(src, uint32(os.O_RDONLY))
+	if !code.Ok() {
+		t.Fatalf("Open failed: %v", code)
+	}
+	defer k.Release(src, fhIn)
+	fhOut, code := k.Open(dst, uint32(os.O_WRONLY))
+	if !code.Ok() {
+		t.Fatalf("Open failed: %v", code)
+	}
+	defer k.Release(dst, fhOut)
+
+	const seekEnd = 2
+	if off, code := k.Lseek(src, fhIn, 0, seekEnd); !code.Ok() || off != int64(len(content)) {
+		t.Errorf("Lseek: got %d, %v, want %d", off, code, len(content))
+	}
+	if fs.seeks != 1 {
+		t.Errorf("FileSystem.Lseek called %d times, want 1", fs.seeks)
+	}
+
+	n, code := k.CopyFileRange(src, fhIn, 6, dst, fhOut, 0, 5)
+	if code == fuse.ENOSYS {
+		t.Skip("copy_file_range not supported")
+	}
+	if !code.Ok() || n != 5 {
+		t.Fatalf("CopyFileRange: got %d, %v", n, code)
+	}
+	if fs.copies != 1 {
+		t.Errorf("FileSystem.CopyFileRange called %d times, want 1", fs.copies)
+	}
+	if got, _ := ioutil.ReadFile(dir + "/dst"); string(got) != "world" {
+		t.Errorf("got %q, want %q", got, "world")
+	}
+}
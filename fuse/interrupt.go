@@ -0,0 +1,124 @@
+package fuse
+
+import (
+	"sync"
+)
+
+// The kernel sends INTERRUPT when the process waiting for a request
+// receives a signal. The Server tracks the requests that are being
+// handled, so it can find the request an INTERRUPT refers to.
+type inflightTable struct {
+	sync.Mutex
+	byUnique map[uint64]*request
+}
+
+// Context is passed to file systems with each call. It describes the
+// process making the call, and carries a channel that is closed when
+// the kernel interrupts the call.
+type Context struct {
+	Owner
+	Pid uint32
+
+	// Closed if the kernel interrupts the request, typically
+	// because the calling process received a signal. May be nil.
+	Cancel <-chan struct{}
+}
+
+// Done returns a channel that is closed if the kernel interrupts the
+// request this Context belongs to. File systems that do slow
+// operations can select on it and return EINTR early. For a Context
+// that does not belong to a request, Done returns nil, which is
+// never closed.
+func (c *Context) Done() <-chan struct{} {
+	if c == nil {
+		return nil
+	}
+	return c.Cancel
+}
+
+// Interrupted returns whether the request this Context belongs to
+// was interrupted.
+func (c *Context) Interrupted() bool {
+	select {
+	case <-c.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+// Context returns the Context for the request with the given header,
+// which must be in flight. RawFileSystem implementations use it to
+// pass the caller and the cancellation of a request on.
+func (ms *Server) Context(header *InHeader) *Context {
+	return &Context{
+		Owner:  header.Owner,
+		Pid:    header.Pid,
+		Cancel: ms.cancelChan(header.Unique),
+	}
+}
+
+// cancelChan returns the channel that is closed when the request
+// with the given unique ID is interrupted, creating it on demand.
+func (ms *Server) cancelChan(unique uint64) <-chan struct{} {
+	ms.inflight.Lock()
+	defer ms.inflight.Unlock()
+	req := ms.inflight.byUnique[unique]
+	if req == nil {
+		return nil
+	}
+	if req.cancel == nil {
+		req.cancel = make(chan struct{})
+		if req.interrupted {
+			close(req.cancel)
+		}
+	}
+	return req.cancel
+}
+
+// registerInflight makes the request available for interrupts and
+// the watchdog. The goroutine handling it is 0 while the request is
+// queued.
+func (ms *Server) registerInflight(req *request, goroutine uint64) {
+	ms.inflight.Lock()
+	if ms.inflight.byUnique == nil {
+		ms.inflight.byUnique = map[uint64]*request{}
+	}
+	ms.inflight.byUnique[req.inHeader.Unique] = req
+	req.goroutine = goroutine
+	ms.inflight.Unlock()
+}
+
+func (ms *Server) unregisterInflight(req *request) {
+	ms.inflight.Lock()
+	delete(ms.inflight.byUnique, req.inHeader.Unique)
+	req.cancel = nil
+	req.interrupted = false
+	req.slowReported = false
+	ms.inflight.Unlock()
+}
+
+// interrupted returns whether the kernel interrupted req.
+func (ms *Server) interrupted(req *request) bool {
+	ms.inflight.Lock()
+	defer ms.inflight.Unlock()
+	return req.interrupted
+}
+
+// interrupt marks the request with the given unique ID as
+// interrupted. It returns false if no such request is being handled.
+func (ms *Server) interrupt(unique uint64) bool {
+	ms.inflight.Lock()
+	defer ms.inflight.Unlock()
+	req := ms.inflight.byUnique[unique]
+	if req == nil {
+		return false
+	}
+	if !req.interrupted {
+		req.interrupted = true
+		if req.cancel != nil {
+			close(req.cancel)
+		}
+	}
+	return true
+}
@@ -0,0 +1,79 @@
+package fuse
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func TestInterruptDone(t *testing.T) {
+	ms := &Server{}
+	req := &request{}
+	req.setInput(make([]byte, unsafe.Sizeof(InHeader{})))
+	req.inHeader = (*InHeader)(unsafe.Pointer(&req.inputBuf[0]))
+	req.inHeader.Unique = 42
+	req.inHeader.Pid = 1234
+
+	var c Context
+	if c.Done() != nil {
+		t.Fatalf("Context without a request should return nil Done channel")
+	}
+	if ms.Context(req.inHeader).Done() != nil {
+		t.Fatalf("Context of unregistered request should return nil Done channel")
+	}
+
+	ms.registerInflight(req, 0)
+	ctx := ms.Context(req.inHeader)
+	if ctx.Pid != 1234 {
+		t.Errorf("got pid %d, want 1234", ctx.Pid)
+	}
+	done := ctx.Done()
+	if done == nil {
+		t.Fatalf("registered Context should have a Done channel")
+	}
+	if ctx.Interrupted() {
+		t.Fatalf("request should not be interrupted yet")
+	}
+
+	if ms.interrupt(43) {
+		t.Errorf("interrupt of unknown request should fail")
+	}
+	if !ms.interrupt(42) {
+		t.Errorf("interrupt of known request failed")
+	}
+	select {
+	case <-done:
+	default:
+		t.Errorf("Done channel not closed after interrupt")
+	}
+	if !ctx.Interrupted() {
+		t.Errorf("Interrupted should return true")
+	}
+	if !ms.Context(req.inHeader).Interrupted() {
+		t.Errorf("Context created after the interrupt should be interrupted")
+	}
+
+	ms.unregisterInflight(req)
+	if ms.interrupt(42) {
+		t.Errorf("interrupt after completion should fail")
+	}
+	if ms.Context(req.inHeader).Done() != nil {
+		t.Errorf("Done should be nil after request completion")
+	}
+}
+
+func TestInterruptPerServer(t *testing.T) {
+	ms1, ms2 := &Server{}, &Server{}
+	req := &request{}
+	req.setInput(make([]byte, unsafe.Sizeof(InHeader{})))
+	req.inHeader = (*InHeader)(unsafe.Pointer(&req.inputBuf[0]))
+	req.inHeader.Unique = 7
+
+	ms1.registerInflight(req, 0)
+	defer ms1.unregisterInflight(req)
+	if ms2.interrupt(7) {
+		t.Errorf("interrupt reached a request of another server")
+	}
+	if ms2.Context(req.inHeader).Done() != nil {
+		t.Errorf("got a Done channel from another server")
+	}
+}
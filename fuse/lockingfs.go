@@ -160,6 +160,11 @@ func (fs *lockingRawFileSystem) Write(input *WriteIn, data []byte) (written uint
 	return fs.RawFS.Write(input, data)
 }
 
+func (fs *lockingRawFileSystem) SpliceWrite(input *WriteIn, data *WritePipe) (written uint32, code Status) {
+	defer fs.locked()()
+	return fs.RawFS.SpliceWrite(input, data)
+}
+
 func (fs *lockingRawFileSystem) Flush(input *FlushIn) Status {
 	defer fs.locked()()
 	return fs.RawFS.Flush(input)
@@ -200,6 +205,43 @@ func (fs *lockingRawFileSystem) Fallocate(in *FallocateIn) (code Status) {
 	return fs.RawFS.Fallocate(in)
 }
 
+func (fs *lockingRawFileSystem) Lseek(in *LseekIn, out *LseekOut) (code Status) {
+	defer fs.locked()()
+	return fs.RawFS.Lseek(in, out)
+}
+
+func (fs *lockingRawFileSystem) CopyFileRange(input *CopyFileRangeIn) (written uint32, code Status) {
+	defer fs.locked()()
+	return fs.RawFS.CopyFileRange(input)
+}
+
+func (fs *lockingRawFileSystem) GetLk(in *LkIn, out *LkOut) (code Status) {
+	defer fs.locked()()
+	return fs.RawFS.GetLk(in, out)
+}
+
+func (fs *lockingRawFileSystem) SetLk(in *LkIn) (code Status) {
+	defer fs.locked()()
+	return fs.RawFS.SetLk(in)
+}
+
+// SetLkw is not serialized, since it may block until another
+// client releases its lock, which it could not do while we hold the
+// lock.
+func (fs *lockingRawFileSystem) SetLkw(in *LkIn) (code Status) {
+	return fs.RawFS.SetLkw(in)
+}
+
+func (fs *lockingRawFileSystem) Ioctl(in *IoctlIn, inData []byte, out *IoctlOut, outData []byte) (code Status) {
+	defer fs.locked()()
+	return fs.RawFS.Ioctl(in, inData, out, outData)
+}
+
+func (fs *lockingRawFileSystem) Poll(in *PollIn, out *PollOut) (code Status) {
+	defer fs.locked()()
+	return fs.RawFS.Poll(in, out)
+}
+
 func (fs *lockingRawFileSystem) String() string {
 	defer fs.locked()()
 	return fmt.Sprintf("Locked(%s)", fs.RawFS.String())
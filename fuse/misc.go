@@ -65,6 +65,34 @@ func toSlice(dest *[]byte, ptr unsafe.Pointer, byteCount uintptr) {
 	*h = reflect.SliceHeader{uintptr(ptr), int(byteCount), int(byteCount)}
 }
 
+// FromFlockT fills the lock from a syscall.Flock_t, as returned by
+// fcntl(F_GETLK).
+func (lk *FileLock) FromFlockT(flockT *syscall.Flock_t) {
+	lk.Typ = uint32(flockT.Type)
+	if flockT.Type != syscall.F_UNLCK {
+		lk.Start = uint64(flockT.Start)
+		if flockT.Len == 0 {
+			lk.End = OFFSET_MAX
+		} else {
+			lk.End = uint64(flockT.Start + flockT.Len - 1)
+		}
+	}
+	lk.Pid = uint32(flockT.Pid)
+}
+
+// ToFlockT converts the lock into a syscall.Flock_t for passing to
+// fcntl(2).
+func (lk *FileLock) ToFlockT(flockT *syscall.Flock_t) {
+	flockT.Start = int64(lk.Start)
+	if lk.End == OFFSET_MAX {
+		flockT.Len = 0
+	} else {
+		flockT.Len = int64(lk.End - lk.Start + 1)
+	}
+	flockT.Whence = int16(os.SEEK_SET)
+	flockT.Type = int16(lk.Typ)
+}
+
 func Version() string {
 	if version != nil {
 		return *version
@@ -113,7 +113,7 @@ import (
 	"unsafe"
 )
 
-func mount(dir string, options string) (int, error) {
+func mount(dir string, opts *MountOptions, options string) (int, error) {
 	errp := (**C.char)(C.malloc(16))
 	*errp = nil
 	defer C.free(unsafe.Pointer(errp))
@@ -132,7 +132,7 @@ func (m mountError) Error() string {
 	return string(m)
 }
 
-func unmount(mountPoint string) error {
+func unmount(mountPoint string, opts *MountOptions) error {
 	dir, _ := filepath.Split(mountPoint)
 	proc, err := os.StartProcess(umountBinary,
 		[]string{umountBinary, mountPoint},
@@ -147,6 +147,10 @@ func unmount(mountPoint string) error {
 	return err
 }
 
+func unmountLazy(mountPoint string, opts *MountOptions) error {
+	return fmt.Errorf("lazy unmount is not supported")
+}
+
 var umountBinary string
 
 func init() {
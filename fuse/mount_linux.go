@@ -2,17 +2,16 @@ package fuse
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
-	"log"
 	"os"
 	"os/exec"
-	"path/filepath"
+	"strings"
 	"syscall"
 	"unsafe"
 )
 
 var fusermountBinary string
-var umountBinary string
 
 func unixgramSocketpair() (l, r *os.File, err error) {
 	fd, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_SEQPACKET, 0)
@@ -27,7 +26,119 @@ func unixgramSocketpair() (l, r *os.File, err error) {
 
 // Create a FUSE FS on the specified mount point.  The returned
 // mount point is always absolute.
-func mount(mountPoint string, options string) (fd int, err error) {
+func mount(mountPoint string, opts *MountOptions, options string) (fd int, err error) {
+	if opts.DirectMount {
+		fd, err := mountDirect(mountPoint, options)
+		if err == nil || opts.DirectMountStrict {
+			return fd, err
+		}
+		fd, fmErr := mountFusermount(mountPoint, options)
+		if fmErr != nil {
+			return -1, fmt.Errorf("direct mount: %v; fusermount: %v", err, fmErr)
+		}
+		return fd, nil
+	}
+	return mountFusermount(mountPoint, options)
+}
+
+// Mount flags that can be given as options. The first set switches
+// a flag on, the second one switches it off.
+var (
+	mountFlagsOn = map[string]uintptr{
+		"ro":          syscall.MS_RDONLY,
+		"nosuid":      syscall.MS_NOSUID,
+		"nodev":       syscall.MS_NODEV,
+		"noexec":      syscall.MS_NOEXEC,
+		"sync":        syscall.MS_SYNCHRONOUS,
+		"dirsync":     syscall.MS_DIRSYNC,
+		"noatime":     syscall.MS_NOATIME,
+		"nodiratime":  syscall.MS_NODIRATIME,
+		"relatime":    syscall.MS_RELATIME,
+		"strictatime": syscall.MS_STRICTATIME,
+	}
+	mountFlagsOff = map[string]uintptr{
+		"rw":    syscall.MS_RDONLY,
+		"suid":  syscall.MS_NOSUID,
+		"dev":   syscall.MS_NODEV,
+		"exec":  syscall.MS_NOEXEC,
+		"async": syscall.MS_SYNCHRONOUS,
+		"atime": syscall.MS_NOATIME,
+	}
+)
+
+// directMountArgs translates fusermount style options into the
+// arguments of mount(2). Options that only fusermount understands,
+// like auto_unmount, are an error.
+func directMountArgs(options string) (source, fstype string, flags uintptr, data []string, err error) {
+	source = "fuse"
+	fstype = "fuse"
+	flags = syscall.MS_NOSUID | syscall.MS_NODEV
+	if options == "" {
+		return
+	}
+	for _, o := range strings.Split(options, ",") {
+		key := o
+		val := ""
+		if i := strings.Index(o, "="); i >= 0 {
+			key, val = o[:i], o[i+1:]
+		}
+		switch {
+		case mountFlagsOn[o] != 0:
+			flags |= mountFlagsOn[o]
+		case mountFlagsOff[o] != 0:
+			flags &^= mountFlagsOff[o]
+		case key == "fsname":
+			source = val
+		case key == "subtype":
+			fstype = "fuse." + val
+		case o == "allow_other" || o == "default_permissions" ||
+			key == "max_read":
+			data = append(data, o)
+		default:
+			return "", "", 0, nil, fmt.Errorf("option %q is not supported for direct mounts", o)
+		}
+	}
+	if source == "fuse" && fstype != "fuse" {
+		source = strings.TrimPrefix(fstype, "fuse.")
+	}
+	return
+}
+
+// mountDirect opens /dev/fuse and mounts it with mount(2). This needs
+// CAP_SYS_ADMIN in the user namespace that owns the mount namespace,
+// so it works for root, and for root in a user namespace.
+func mountDirect(mountPoint string, options string) (int, error) {
+	source, fstype, flags, data, err := directMountArgs(options)
+	if err != nil {
+		return -1, err
+	}
+	var st syscall.Stat_t
+	if err := syscall.Stat(mountPoint, &st); err != nil {
+		return -1, os.NewSyscallError("stat", err)
+	}
+
+	fd, err := syscall.Open("/dev/fuse", syscall.O_RDWR|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, os.NewSyscallError("open /dev/fuse", err)
+	}
+	data = append(data,
+		fmt.Sprintf("fd=%d", fd),
+		fmt.Sprintf("rootmode=%o", st.Mode&syscall.S_IFMT),
+		fmt.Sprintf("user_id=%d", os.Geteuid()),
+		fmt.Sprintf("group_id=%d", os.Getegid()))
+	if err := syscall.Mount(source, mountPoint, fstype, flags, strings.Join(data, ",")); err != nil {
+		syscall.Close(fd)
+		return -1, os.NewSyscallError("mount", err)
+	}
+	return fd, nil
+}
+
+// mountFusermount has the fusermount setuid helper do the mount, and
+// receives the /dev/fuse descriptor from it.
+func mountFusermount(mountPoint string, options string) (fd int, err error) {
+	if fusermountBinary == "" {
+		return -1, fmt.Errorf("could not find fusermount binary")
+	}
 	local, remote, err := unixgramSocketpair()
 	if err != nil {
 		return
@@ -63,36 +174,61 @@ func mount(mountPoint string, options string) (fd int, err error) {
 	return getConnection(local)
 }
 
-func privilegedUnmount(mountPoint string) error {
-	dir, _ := filepath.Split(mountPoint)
-	proc, err := os.StartProcess(umountBinary,
-		[]string{umountBinary, mountPoint},
-		&os.ProcAttr{Dir: dir, Files: []*os.File{nil, nil, os.Stderr}})
-	if err != nil {
-		return err
+func unmount(mountPoint string, opts *MountOptions) (err error) {
+	if opts.DirectMount || os.Geteuid() == 0 {
+		err = syscall.Unmount(mountPoint, 0)
+		if err == syscall.EBUSY {
+			return fmt.Errorf("%w: umount2: %v", ErrBusy, err)
+		}
+		if err == nil || opts.DirectMountStrict {
+			return err
+		}
 	}
-	w, err := proc.Wait()
-	if !w.Success() {
-		return fmt.Errorf("umount exited with code %v\n", w.Sys())
-	}
-	return err
+	return fusermountUnmount(mountPoint)
 }
 
-func unmount(mountPoint string) (err error) {
-	if os.Geteuid() == 0 {
-		return privilegedUnmount(mountPoint)
+func fusermountUnmount(mountPoint string, flags ...string) error {
+	if fusermountBinary == "" {
+		return fmt.Errorf("could not find fusermount binary")
 	}
 	errBuf := bytes.Buffer{}
-	cmd := exec.Command(fusermountBinary, "-u", mountPoint)
+	cmd := exec.Command(fusermountBinary, append(append([]string{"-u"}, flags...), mountPoint)...)
 	cmd.Stderr = &errBuf
-	err = cmd.Run()
-	if errBuf.Len() > 0 {
-		return fmt.Errorf("%s (code %v)\n",
-			errBuf.String(), err)
+	return unmountError(cmd.Run(), errBuf.String())
+}
+
+// unmountError turns the result of running fusermount into an
+// error. fusermount exits with status 1 for any failure, and reports
+// the errno of umount2(2) only as its strerror text, so a busy mount
+// is recognized by the message for EBUSY.
+func unmountError(err error, stderr string) error {
+	if err == nil {
+		return nil
+	}
+	msg := strings.TrimSpace(stderr)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 &&
+		strings.HasSuffix(strings.ToLower(msg), syscall.EBUSY.Error()) {
+		return fmt.Errorf("%w: %s", ErrBusy, msg)
+	}
+	if msg != "" {
+		return fmt.Errorf("%s (code %v)", msg, err)
 	}
 	return err
 }
 
+// unmountLazy detaches the mount from the file system tree. The
+// kernel keeps the file system alive until its last file is closed.
+func unmountLazy(mountPoint string, opts *MountOptions) error {
+	if opts.DirectMount || os.Geteuid() == 0 {
+		err := syscall.Unmount(mountPoint, syscall.MNT_DETACH)
+		if err == nil || opts.DirectMountStrict {
+			return err
+		}
+	}
+	return fusermountUnmount(mountPoint, "-z")
+}
+
 func getConnection(local *os.File) (int, error) {
 	var data [4]byte
 	control := make([]byte, 4*256)
@@ -121,13 +257,7 @@ func getConnection(local *os.File) (int, error) {
 }
 
 func init() {
-	var err error
-	fusermountBinary, err = exec.LookPath("fusermount")
-	if err != nil {
-		log.Fatal("Could not find fusermount binary: %v", err)
-	}
-	umountBinary, _ = exec.LookPath("umount")
-	if err != nil {
-		log.Fatalf("Could not find umount binary: %v", err)
-	}
+	// fusermount is not needed for direct mounts, so a missing
+	// binary is only reported when it is used.
+	fusermountBinary, _ = exec.LookPath("fusermount")
 }
@@ -0,0 +1,72 @@
+package fuse
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestDirectMountArgs(t *testing.T) {
+	source, fstype, flags, data, err := directMountArgs("ro,allow_other,nodev,suid,subtype=myfs,max_read=4096")
+	if err != nil {
+		t.Fatalf("directMountArgs: %v", err)
+	}
+	if source != "myfs" || fstype != "fuse.myfs" {
+		t.Errorf("got source %q, fstype %q", source, fstype)
+	}
+	if want := uintptr(syscall.MS_RDONLY | syscall.MS_NODEV); flags != want {
+		t.Errorf("got flags 0x%x, want 0x%x", flags, want)
+	}
+	if want := []string{"allow_other", "max_read=4096"}; !reflect.DeepEqual(data, want) {
+		t.Errorf("got data %q, want %q", data, want)
+	}
+
+	if source, _, _, _, _ := directMountArgs("fsname=src,subtype=myfs"); source != "src" {
+		t.Errorf("got source %q, want src", source)
+	}
+	if _, _, _, _, err := directMountArgs("auto_unmount"); err == nil {
+		t.Error("auto_unmount should not be supported")
+	}
+	if _, _, _, _, err := directMountArgs("blksize=4096"); err == nil {
+		t.Error("blksize should not be supported")
+	}
+	if _, _, flags, _, _ := directMountArgs("noatime,atime"); flags&syscall.MS_NOATIME != 0 {
+		t.Errorf("atime did not clear MS_NOATIME: flags 0x%x", flags)
+	}
+
+	// Generic options that ParseMountOptions passes on must work
+	// for direct mounts too.
+	for o := range genericMountOptions {
+		if _, _, _, _, err := directMountArgs(o); err != nil {
+			t.Errorf("directMountArgs(%q): %v", o, err)
+		}
+	}
+}
+
+func TestUnmountError(t *testing.T) {
+	run := func(script string) error {
+		var stderr bytes.Buffer
+		cmd := exec.Command("sh", "-c", script)
+		cmd.Stderr = &stderr
+		return unmountError(cmd.Run(), stderr.String())
+	}
+
+	busy := "echo 'fusermount: failed to unmount /mnt: Device or resource busy' >&2; exit 1"
+	if err := run(busy); !errors.Is(err, ErrBusy) {
+		t.Errorf("got %v, want ErrBusy", err)
+	}
+	for _, script := range []string{
+		"echo 'fusermount: entry for /mnt/busy not found in /etc/mtab' >&2; exit 1",
+		"echo 'fusermount: failed to unmount /mnt: Device or resource busy' >&2; exit 2",
+	} {
+		if err := run(script); err == nil || errors.Is(err, ErrBusy) {
+			t.Errorf("%q: got %v, want a non-busy error", script, err)
+		}
+	}
+	if err := run("echo warning >&2"); err != nil {
+		t.Errorf("got %v for successful unmount", err)
+	}
+}
@@ -0,0 +1,236 @@
+package fuse
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// optionStrings validates the options, and returns the -o options
+// for the mount.
+func (o *MountOptions) optionStrings(defaultName string) ([]string, error) {
+	var optStrs []string
+	for _, s := range o.Options {
+		if s == "" {
+			return nil, fmt.Errorf("Options: entries must not be empty")
+		}
+		// Entries may hold several options, like "noexec,nosuid".
+		for _, opt := range strings.Split(s, ",") {
+			if opt != "" {
+				optStrs = append(optStrs, opt)
+			}
+		}
+	}
+	if strings.Contains(o.FsName, ",") {
+		return nil, fmt.Errorf("FsName %q: must not contain ','", o.FsName)
+	}
+	if o.MaxRead < 0 {
+		return nil, fmt.Errorf("MaxRead %d: must not be negative", o.MaxRead)
+	}
+	if o.BlockSize != 0 {
+		return nil, fmt.Errorf("BlockSize %d: blksize is only valid for fuseblk mounts, which are not supported", o.BlockSize)
+	}
+	if o.AutoUnmount && o.DirectMount && o.DirectMountStrict {
+		return nil, fmt.Errorf("AutoUnmount needs fusermount, and cannot be combined with DirectMountStrict")
+	}
+
+	if o.AllowOther {
+		optStrs = append(optStrs, "allow_other")
+	}
+	if o.ReadOnly {
+		optStrs = append(optStrs, "ro")
+	}
+	if o.DefaultPermissions {
+		optStrs = append(optStrs, "default_permissions")
+	}
+	if o.AutoUnmount {
+		optStrs = append(optStrs, "auto_unmount")
+	}
+	if o.MaxRead > 0 {
+		optStrs = append(optStrs, fmt.Sprintf("max_read=%d", o.MaxRead))
+	}
+	if o.FsName != "" {
+		optStrs = append(optStrs, "fsname="+o.FsName)
+	}
+
+	name := o.Name
+	if name == "" {
+		name = defaultName
+		if len(name) > _MAX_NAME_LEN {
+			name = name[:_MAX_NAME_LEN]
+		}
+	}
+	optStrs = append(optStrs, "subtype="+strings.Replace(name, ",", ";", -1))
+	return optStrs, nil
+}
+
+// Options that mount(8) and systemd interpret themselves, and which
+// are not meant for the kernel.
+var userspaceMountOptions = map[string]bool{
+	"defaults": true,
+	"auto":     true,
+	"noauto":   true,
+	"nofail":   true,
+	"user":     true,
+	"nouser":   true,
+	"users":    true,
+	"owner":    true,
+	"group":    true,
+	"_netdev":  true,
+}
+
+// Generic mount flags, which are passed to the kernel as they are.
+var genericMountOptions = map[string]bool{
+	"suid":        true,
+	"nosuid":      true,
+	"dev":         true,
+	"nodev":       true,
+	"exec":        true,
+	"noexec":      true,
+	"async":       true,
+	"sync":        true,
+	"dirsync":     true,
+	"atime":       true,
+	"noatime":     true,
+	"nodiratime":  true,
+	"relatime":    true,
+	"strictatime": true,
+}
+
+// ParseMountOptions parses a comma separated option string, as
+// passed to mount(8) with -o or written in /etc/fstab, into o.
+//
+// Options that go-fuse knows set the corresponding fields, eg. "ro"
+// sets ReadOnly and "fsname=x" sets FsName. Generic mount flags like
+// "noexec" are added to o.Options. Options that only mount(8) and
+// systemd use, like "noauto", "nofail", "_netdev" and "x-systemd.*",
+// are dropped. The remaining options are returned, so the file
+// system can interpret them.
+func ParseMountOptions(s string, o *MountOptions) (rest []string, err error) {
+	if s == "" {
+		return nil, nil
+	}
+	for _, opt := range strings.Split(s, ",") {
+		key, val := opt, ""
+		hasVal := false
+		if i := strings.Index(opt, "="); i >= 0 {
+			key, val, hasVal = opt[:i], opt[i+1:], true
+		}
+
+		intVal := func() (int, error) {
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("mount option %q: want a non-negative number", opt)
+			}
+			return n, nil
+		}
+		noVal := func() error {
+			if hasVal {
+				return fmt.Errorf("mount option %q: does not take a value", opt)
+			}
+			return nil
+		}
+
+		switch {
+		case opt == "":
+			continue
+		case userspaceMountOptions[key] || strings.HasPrefix(key, "x-"):
+			continue
+		case genericMountOptions[key]:
+			err = noVal()
+			o.Options = append(o.Options, opt)
+		case key == "ro" || key == "rw":
+			err = noVal()
+			o.ReadOnly = key == "ro"
+		case key == "allow_other":
+			err = noVal()
+			o.AllowOther = true
+		case key == "default_permissions":
+			err = noVal()
+			o.DefaultPermissions = true
+		case key == "auto_unmount":
+			err = noVal()
+			o.AutoUnmount = true
+		case key == "fsname":
+			o.FsName = val
+		case key == "subtype":
+			o.Name = val
+		case key == "max_read":
+			o.MaxRead, err = intVal()
+		case key == "max_write":
+			o.MaxWrite, err = intVal()
+		case key == "blksize":
+			o.BlockSize, err = intVal()
+		default:
+			rest = append(rest, opt)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rest, nil
+}
+
+// MountHelperArgs are the arguments that mount(8) passes to a mount
+// helper, eg. for an /etc/fstab line
+//
+//	/srv/data  /mnt/data  fuse.myfs  ro,allow_other  0 0
+//
+// mount(8) runs mount.fuse, which in turn runs "myfs /srv/data
+// /mnt/data -o ro,allow_other".
+type MountHelperArgs struct {
+	Source     string
+	MountPoint string
+
+	// The option string, to be parsed with ParseMountOptions.
+	// Repeated -o flags are joined with commas.
+	Options string
+
+	// The file system type given with -t, if any.
+	Type string
+
+	// Set for -f: do everything but the actual mount.
+	Fake bool
+}
+
+// ParseMountHelperArgs parses the arguments of a mount helper, not
+// including the program name.
+func ParseMountHelperArgs(args []string) (*MountHelperArgs, error) {
+	r := &MountHelperArgs{}
+	var positional, opts []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "-o" || a == "-t" || a == "-N":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("flag %s needs an argument", a)
+			}
+			i++
+			switch a {
+			case "-o":
+				opts = append(opts, args[i])
+			case "-t":
+				r.Type = args[i]
+			case "-N":
+				return nil, fmt.Errorf("flag -N (mount namespace) is not supported")
+			}
+		case strings.HasPrefix(a, "-o") && len(a) > 2:
+			opts = append(opts, a[2:])
+		case a == "-f":
+			r.Fake = true
+		case a == "-n" || a == "-s" || a == "-v":
+			// Don't write mtab, be sloppy, be verbose:
+			// nothing to do for us.
+		case strings.HasPrefix(a, "-") && a != "-":
+			return nil, fmt.Errorf("unknown flag %q", a)
+		default:
+			positional = append(positional, a)
+		}
+	}
+	if len(positional) != 2 {
+		return nil, fmt.Errorf("want source and mount point, got %q", positional)
+	}
+	r.Source, r.MountPoint = positional[0], positional[1]
+	r.Options = strings.Join(opts, ",")
+	return r, nil
+}
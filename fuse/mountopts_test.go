@@ -0,0 +1,99 @@
+package fuse
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMountOptions(t *testing.T) {
+	var o MountOptions
+	rest, err := ParseMountOptions("defaults,ro,noexec,allow_other,fsname=data,subtype=myfs,max_read=65536,nofail,x-systemd.automount,cache=yes", &o)
+	if err != nil {
+		t.Fatalf("ParseMountOptions: %v", err)
+	}
+	want := MountOptions{
+		ReadOnly:   true,
+		AllowOther: true,
+		FsName:     "data",
+		Name:       "myfs",
+		MaxRead:    65536,
+		Options:    []string{"noexec"},
+	}
+	if !reflect.DeepEqual(o, want) {
+		t.Errorf("got %+v, want %+v", o, want)
+	}
+	if !reflect.DeepEqual(rest, []string{"cache=yes"}) {
+		t.Errorf("got rest %q", rest)
+	}
+
+	for _, bad := range []string{"max_read=x", "max_read=-1", "ro=1", "blksize="} {
+		if _, err := ParseMountOptions(bad, &MountOptions{}); err == nil {
+			t.Errorf("ParseMountOptions(%q) succeeded", bad)
+		}
+	}
+
+	// blksize parses, but mounting with it fails.
+	o = MountOptions{}
+	if _, err := ParseMountOptions("blksize=4096", &o); err != nil || o.BlockSize != 4096 {
+		t.Fatalf("ParseMountOptions(blksize=4096): got %d, %v", o.BlockSize, err)
+	}
+	if _, err := o.optionStrings("fs"); err == nil {
+		t.Error("optionStrings succeeded with blksize")
+	}
+}
+
+func TestMountOptionStrings(t *testing.T) {
+	o := MountOptions{
+		Options:            []string{"noexec,nosuid", "nodev"},
+		ReadOnly:           true,
+		DefaultPermissions: true,
+		FsName:             "data",
+	}
+	got, err := o.optionStrings("a,long,file system name")
+	if err != nil {
+		t.Fatalf("optionStrings: %v", err)
+	}
+	want := "noexec,nosuid,nodev,ro,default_permissions,fsname=data,subtype=a;long;file system n"
+	if strings.Join(got, ",") != want {
+		t.Errorf("got %q, want %q", strings.Join(got, ","), want)
+	}
+
+	for _, bad := range []MountOptions{
+		{Options: []string{""}},
+		{FsName: "a,b"},
+		{MaxRead: -1},
+		{BlockSize: 4096},
+		{AutoUnmount: true, DirectMount: true, DirectMountStrict: true},
+	} {
+		if _, err := bad.optionStrings("fs"); err == nil {
+			t.Errorf("optionStrings succeeded for %+v", bad)
+		}
+	}
+}
+
+func TestParseMountHelperArgs(t *testing.T) {
+	got, err := ParseMountHelperArgs([]string{"/srv/data", "/mnt/data", "-n", "-o", "ro,allow_other", "-odev", "-t", "fuse.myfs"})
+	if err != nil {
+		t.Fatalf("ParseMountHelperArgs: %v", err)
+	}
+	want := &MountHelperArgs{
+		Source:     "/srv/data",
+		MountPoint: "/mnt/data",
+		Options:    "ro,allow_other,dev",
+		Type:       "fuse.myfs",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	for _, bad := range [][]string{
+		{"/mnt/data"},
+		{"/srv/data", "/mnt/data", "-o"},
+		{"/srv/data", "/mnt/data", "-x"},
+	} {
+		if _, err := ParseMountHelperArgs(bad); err == nil {
+			t.Errorf("ParseMountHelperArgs(%q) succeeded", bad)
+		}
+	}
+}
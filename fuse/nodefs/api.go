@@ -67,7 +67,13 @@ type Node interface {
 	Unlink(name string, context *fuse.Context) (code fuse.Status)
 	Rmdir(name string, context *fuse.Context) (code fuse.Status)
 	Symlink(name string, content string, context *fuse.Context) (newNode Node, code fuse.Status)
-	Rename(oldName string, newParent Node, newName string, context *fuse.Context) (code fuse.Status)
+
+	// Rename moves oldName to newName in newParent. Flags is a
+	// combination of fuse.RENAME_NOREPLACE and
+	// fuse.RENAME_EXCHANGE, as for renameat2(2). Nodes that do
+	// not support a flag should return EINVAL rather than ENOSYS,
+	// as ENOSYS disables flagged renames for the whole mount.
+	Rename(oldName string, newParent Node, newName string, flags uint32, context *fuse.Context) (code fuse.Status)
 	Link(name string, existing Node, context *fuse.Context) (newNode Node, code fuse.Status)
 
 	// Files
@@ -89,6 +95,20 @@ type Node interface {
 	Utimens(file File, atime *time.Time, mtime *time.Time, context *fuse.Context) (code fuse.Status)
 	Fallocate(file File, off uint64, size uint64, mode uint32, context *fuse.Context) (code fuse.Status)
 
+	// Lseek finds data and holes in the file (SEEK_DATA and
+	// SEEK_HOLE). CopyFileRange copies size bytes at offIn to
+	// offOut in outFile, which belongs to the node out.
+	Lseek(file File, off uint64, whence uint32, context *fuse.Context) (uint64, fuse.Status)
+	CopyFileRange(file File, offIn uint64, out *Inode, outFile File, offOut uint64, size uint64, flags uint64, context *fuse.Context) (written uint32, code fuse.Status)
+
+	// File locking. These are only called if the mount was made
+	// with fuse.MountOptions.EnableLocks. The owner identifies
+	// the holder of the lock; flags may contain
+	// fuse.FUSE_LK_FLOCK.
+	GetLk(file File, owner uint64, lk *fuse.FileLock, flags uint32, out *fuse.FileLock, context *fuse.Context) (code fuse.Status)
+	SetLk(file File, owner uint64, lk *fuse.FileLock, flags uint32, context *fuse.Context) (code fuse.Status)
+	SetLkw(file File, owner uint64, lk *fuse.FileLock, flags uint32, context *fuse.Context) (code fuse.Status)
+
 	StatFs() *fuse.StatfsOut
 }
 
@@ -108,6 +128,12 @@ type File interface {
 
 	Read(dest []byte, off int64) (fuse.ReadResult, fuse.Status)
 	Write(data []byte, off int64) (written uint32, code fuse.Status)
+
+	// SpliceWrite writes the payload held in data at off. Return
+	// ENOSYS without touching data to receive it through Write
+	// instead.
+	SpliceWrite(data *fuse.WritePipe, off int64) (written uint32, code fuse.Status)
+
 	Flush() fuse.Status
 	Release()
 	Fsync(flags int) (code fuse.Status)
@@ -120,6 +146,35 @@ type File interface {
 	Chmod(perms uint32) fuse.Status
 	Utimens(atime *time.Time, mtime *time.Time) fuse.Status
 	Allocate(off uint64, size uint64, mode uint32) (code fuse.Status)
+
+	// Lseek returns the offset of the next data (SEEK_DATA) or
+	// hole (SEEK_HOLE) at or after off.
+	Lseek(off uint64, whence uint32) (uint64, fuse.Status)
+
+	// CopyFileRange copies size bytes at offIn from this file to
+	// out at offOut, and returns the number of bytes copied.
+	// Return ENOSYS if out is not a file that can be copied to
+	// directly; the kernel then copies the data itself.
+	CopyFileRange(offIn uint64, out File, offOut uint64, size uint64, flags uint64) (written uint32, code fuse.Status)
+
+	// File locking. GetLk returns the lock that would conflict
+	// with lk in out, or sets out.Typ to syscall.F_UNLCK if there
+	// is none. SetLkw blocks until the lock is acquired.
+	GetLk(owner uint64, lk *fuse.FileLock, flags uint32, out *fuse.FileLock) (code fuse.Status)
+	SetLk(owner uint64, lk *fuse.FileLock, flags uint32) (code fuse.Status)
+	SetLkw(owner uint64, lk *fuse.FileLock, flags uint32) (code fuse.Status)
+
+	// Ioctl handles restricted ioctls. input holds the data
+	// the command reads, and output should be filled with the
+	// data it writes; the sizes follow from cmd. The result is
+	// returned from ioctl(2) on success.
+	Ioctl(cmd uint32, arg uint64, input []byte, output []byte) (result int32, code fuse.Status)
+
+	// Poll returns the poll(2) events that are ready. If flags
+	// has fuse.FUSE_POLL_SCHEDULE_NOTIFY set, the file should
+	// call FileSystemConnector.PollNotify with kh when its state
+	// changes.
+	Poll(kh uint64, flags uint32, events uint32) (revents uint32, code fuse.Status)
 }
 
 // Wrap a File return in this to set FUSE flags.  Also used internally
@@ -33,6 +33,10 @@ func (f *defaultFile) Write(data []byte, off int64) (uint32, fuse.Status) {
 	return 0, fuse.ENOSYS
 }
 
+func (f *defaultFile) SpliceWrite(data *fuse.WritePipe, off int64) (uint32, fuse.Status) {
+	return 0, fuse.ENOSYS
+}
+
 func (f *defaultFile) Flush() fuse.Status {
 	return fuse.OK
 }
@@ -68,3 +72,31 @@ func (f *defaultFile) Chmod(perms uint32) fuse.Status {
 func (f *defaultFile) Allocate(off uint64, size uint64, mode uint32) (code fuse.Status) {
 	return fuse.ENOSYS
 }
+
+func (f *defaultFile) Lseek(off uint64, whence uint32) (uint64, fuse.Status) {
+	return 0, fuse.ENOSYS
+}
+
+func (f *defaultFile) CopyFileRange(offIn uint64, out File, offOut uint64, size uint64, flags uint64) (uint32, fuse.Status) {
+	return 0, fuse.ENOSYS
+}
+
+func (f *defaultFile) GetLk(owner uint64, lk *fuse.FileLock, flags uint32, out *fuse.FileLock) (code fuse.Status) {
+	return fuse.ENOSYS
+}
+
+func (f *defaultFile) SetLk(owner uint64, lk *fuse.FileLock, flags uint32) (code fuse.Status) {
+	return fuse.ENOSYS
+}
+
+func (f *defaultFile) SetLkw(owner uint64, lk *fuse.FileLock, flags uint32) (code fuse.Status) {
+	return fuse.ENOSYS
+}
+
+func (f *defaultFile) Ioctl(cmd uint32, arg uint64, input []byte, output []byte) (result int32, code fuse.Status) {
+	return 0, fuse.ENOSYS
+}
+
+func (f *defaultFile) Poll(kh uint64, flags uint32, events uint32) (revents uint32, code fuse.Status) {
+	return 0, fuse.ENOSYS
+}
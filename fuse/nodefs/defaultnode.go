@@ -90,7 +90,7 @@ func (n *defaultNode) Symlink(name string, content string, context *fuse.Context
 	return nil, fuse.ENOSYS
 }
 
-func (n *defaultNode) Rename(oldName string, newParent Node, newName string, context *fuse.Context) (code fuse.Status) {
+func (n *defaultNode) Rename(oldName string, newParent Node, newName string, flags uint32, context *fuse.Context) (code fuse.Status) {
 	return fuse.ENOSYS
 }
 
@@ -167,3 +167,40 @@ func (n *defaultNode) Utimens(file File, atime *time.Time, mtime *time.Time, con
 func (n *defaultNode) Fallocate(file File, off uint64, size uint64, mode uint32, context *fuse.Context) (code fuse.Status) {
 	return fuse.ENOSYS
 }
+
+func (n *defaultNode) Lseek(file File, off uint64, whence uint32, context *fuse.Context) (uint64, fuse.Status) {
+	if file == nil {
+		return 0, fuse.ENOSYS
+	}
+	return file.Lseek(off, whence)
+}
+
+func (n *defaultNode) CopyFileRange(file File, offIn uint64, out *Inode, outFile File, offOut uint64, size uint64, flags uint64, context *fuse.Context) (uint32, fuse.Status) {
+	if file == nil || outFile == nil {
+		return 0, fuse.ENOSYS
+	}
+	return file.CopyFileRange(offIn, outFile, offOut, size, flags)
+}
+
+// The lock methods forward to the file, so nodes that return files
+// that know how to lock (eg. NewLoopbackFile) get locking for free.
+func (n *defaultNode) GetLk(file File, owner uint64, lk *fuse.FileLock, flags uint32, out *fuse.FileLock, context *fuse.Context) (code fuse.Status) {
+	if file == nil {
+		return fuse.ENOSYS
+	}
+	return file.GetLk(owner, lk, flags, out)
+}
+
+func (n *defaultNode) SetLk(file File, owner uint64, lk *fuse.FileLock, flags uint32, context *fuse.Context) (code fuse.Status) {
+	if file == nil {
+		return fuse.ENOSYS
+	}
+	return file.SetLk(owner, lk, flags)
+}
+
+func (n *defaultNode) SetLkw(file File, owner uint64, lk *fuse.FileLock, flags uint32, context *fuse.Context) (code fuse.Status) {
+	if file == nil {
+		return fuse.ENOSYS
+	}
+	return file.SetLkw(owner, lk, flags)
+}
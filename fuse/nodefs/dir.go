@@ -10,7 +10,7 @@ type connectorDir struct {
 	node       Node
 	stream     []fuse.DirEntry
 	lastOffset uint64
-	rawFS      fuse.RawFileSystem
+	rawFS      *rawBridge
 	lookups    []fuse.EntryOut
 }
 
@@ -21,7 +21,7 @@ func (d *connectorDir) ReadDir(input *fuse.ReadIn, out *fuse.DirEntryList) (code
 	// rewinddir() should be as if reopening directory.
 	// TODO - test this.
 	if d.lastOffset > 0 && input.Offset == 0 {
-		d.stream, code = d.node.OpenDir((*fuse.Context)(&input.Context))
+		d.stream, code = d.node.OpenDir(d.rawFS.context(&input.InHeader))
 		if !code.Ok() {
 			return code
 		}
@@ -49,7 +49,7 @@ func (d *connectorDir) ReadDirPlus(input *fuse.ReadIn, out *fuse.DirEntryList) (
 
 	// rewinddir() should be as if reopening directory.
 	if d.lastOffset > 0 && input.Offset == 0 {
-		d.stream, code = d.node.OpenDir((*fuse.Context)(&input.Context))
+		d.stream, code = d.node.OpenDir(d.rawFS.context(&input.InHeader))
 		if !code.Ok() {
 			return code
 		}
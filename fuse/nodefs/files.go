@@ -133,6 +133,13 @@ func (f *loopbackFile) Write(data []byte, off int64) (uint32, fuse.Status) {
 	return uint32(n), fuse.ToStatus(err)
 }
 
+func (f *loopbackFile) SpliceWrite(data *fuse.WritePipe, off int64) (uint32, fuse.Status) {
+	f.lock.Lock()
+	n, err := data.WriteTo(f.File.Fd(), off)
+	f.lock.Unlock()
+	return uint32(n), fuse.ToStatus(err)
+}
+
 func (f *loopbackFile) Release() {
 	f.lock.Lock()
 	f.File.Close()
@@ -200,7 +207,37 @@ func (f *loopbackFile) GetAttr(a *fuse.Attr) fuse.Status {
 	return fuse.OK
 }
 
-// Allocate, Utimens implemented in files_linux.go
+// The events poll(2) reports for regular files: POLLIN, POLLOUT,
+// POLLRDNORM and POLLWRNORM, in the Linux encoding used by FUSE.
+const _DEFAULT_POLLMASK = 0x1 | 0x4 | 0x40 | 0x100
+
+// Poll reports the file as always ready, like the kernel does for
+// regular files. Returning ENOSYS instead would disable poll for
+// all files on the mount.
+func (f *loopbackFile) Poll(kh uint64, flags uint32, events uint32) (revents uint32, code fuse.Status) {
+	return _DEFAULT_POLLMASK, fuse.OK
+}
+
+func (f *loopbackFile) Lseek(off uint64, whence uint32) (uint64, fuse.Status) {
+	f.lock.Lock()
+	n, err := syscall.Seek(int(f.File.Fd()), int64(off), int(whence))
+	f.lock.Unlock()
+	return uint64(n), fuse.ToStatus(err)
+}
+
+// toLoopbackFile returns the loopbackFile that f wraps, if any.
+func toLoopbackFile(f File) *loopbackFile {
+	for f != nil {
+		if lf, ok := f.(*loopbackFile); ok {
+			return lf
+		}
+		f = f.InnerFile()
+	}
+	return nil
+}
+
+// Allocate, Utimens, GetLk, SetLk, SetLkw, Ioctl and CopyFileRange
+// implemented in files_linux.go
 
 ////////////////////////////////////////////////////////////////
 
@@ -221,6 +258,10 @@ func (f *readOnlyFile) Write(data []byte, off int64) (uint32, fuse.Status) {
 	return 0, fuse.EPERM
 }
 
+func (f *readOnlyFile) SpliceWrite(data *fuse.WritePipe, off int64) (uint32, fuse.Status) {
+	return 0, fuse.EPERM
+}
+
 func (f *readOnlyFile) Fsync(flag int) (code fuse.Status) {
 	return fuse.OK
 }
@@ -240,3 +281,12 @@ func (f *readOnlyFile) Chown(uid uint32, gid uint32) fuse.Status {
 func (f *readOnlyFile) Allocate(off uint64, sz uint64, mode uint32) fuse.Status {
 	return fuse.EPERM
 }
+
+// Ioctl only passes on commands that take no input, since the
+// others may modify the file.
+func (f *readOnlyFile) Ioctl(cmd uint32, arg uint64, input []byte, output []byte) (result int32, code fuse.Status) {
+	if len(input) > 0 {
+		return 0, fuse.EPERM
+	}
+	return f.File.Ioctl(cmd, arg, input, output)
+}
@@ -1,8 +1,10 @@
 package nodefs
 
 import (
+	"fmt"
 	"syscall"
 	"time"
+	"unsafe"
 
 	"github.com/hanwen/go-fuse/fuse"
 )
@@ -20,22 +22,175 @@ func (f *loopbackFile) Allocate(off uint64, sz uint64, mode uint32) fuse.Status
 const _UTIME_NOW = ((1 << 30) - 1)
 const _UTIME_OMIT = ((1 << 30) - 2)
 
+func utimeToTimespec(t *time.Time) syscall.Timespec {
+	if t == nil {
+		return syscall.Timespec{Nsec: _UTIME_OMIT}
+	}
+	return syscall.NsecToTimespec(t.UnixNano())
+}
+
+// Utimens leaves times that are nil untouched. futimes(2) does not
+// support UTIME_OMIT, so go through utimensat(2) on /proc instead.
 func (f *loopbackFile) Utimens(a *time.Time, m *time.Time) fuse.Status {
-	tv := make([]syscall.Timeval, 2)
-	if a == nil {
-		tv[0].Usec = _UTIME_OMIT
-	} else {
-		n := a.UnixNano()
-		tv[0] = syscall.NsecToTimeval(n)
+	ts := []syscall.Timespec{utimeToTimespec(a), utimeToTimespec(m)}
+	f.lock.Lock()
+	err := syscall.UtimesNano(fmt.Sprintf("/proc/self/fd/%d", f.File.Fd()), ts)
+	f.lock.Unlock()
+	return fuse.ToStatus(err)
+}
+
+// Open file description locks belong to the open file rather than
+// the process, so locks taken through different FUSE file handles
+// conflict with each other, like they would for separate processes
+// on the backing file system. These are missing from the syscall
+// package.
+const (
+	_F_OFD_GETLK  = 36
+	_F_OFD_SETLK  = 37
+	_F_OFD_SETLKW = 38
+)
+
+// The lock owner is not passed on: each loopbackFile has its own
+// backing file descriptor, which serves as the owner of the lock.
+func (f *loopbackFile) GetLk(owner uint64, lk *fuse.FileLock, flags uint32, out *fuse.FileLock) (code fuse.Status) {
+	flk := syscall.Flock_t{}
+	lk.ToFlockT(&flk)
+	f.lock.Lock()
+	err := syscall.FcntlFlock(f.File.Fd(), _F_OFD_GETLK, &flk)
+	f.lock.Unlock()
+	if err != nil {
+		return fuse.ToStatus(err)
+	}
+	out.FromFlockT(&flk)
+	if flk.Pid < 0 {
+		// OFD locks are not owned by a process.
+		out.Pid = 0
 	}
+	return fuse.OK
+}
+
+func (f *loopbackFile) SetLk(owner uint64, lk *fuse.FileLock, flags uint32) (code fuse.Status) {
+	f.lock.Lock()
+	code = f.setLock(lk, flags, false)
+	f.lock.Unlock()
+	return code
+}
 
-	if m == nil {
-		tv[1].Usec = _UTIME_OMIT
-	} else {
-		n := a.UnixNano()
-		tv[1] = syscall.NsecToTimeval(n)
+// SetLkw does not hold the file lock while waiting, as that would
+// stall all other operations on this file. The kernel will not
+// release the file while the lock request is outstanding.
+func (f *loopbackFile) SetLkw(owner uint64, lk *fuse.FileLock, flags uint32) (code fuse.Status) {
+	return f.setLock(lk, flags, true)
+}
+
+func (f *loopbackFile) setLock(lk *fuse.FileLock, flags uint32, blocking bool) (code fuse.Status) {
+	if flags&fuse.FUSE_LK_FLOCK != 0 {
+		var op int
+		switch lk.Typ {
+		case syscall.F_RDLCK:
+			op = syscall.LOCK_SH
+		case syscall.F_WRLCK:
+			op = syscall.LOCK_EX
+		case syscall.F_UNLCK:
+			op = syscall.LOCK_UN
+		default:
+			return fuse.EINVAL
+		}
+		if !blocking {
+			op |= syscall.LOCK_NB
+		}
+		return fuse.ToStatus(syscall.Flock(int(f.File.Fd()), op))
 	}
 
-	err := syscall.Futimes(int(f.File.Fd()), tv)
-	return fuse.ToStatus(err)
+	flk := syscall.Flock_t{}
+	lk.ToFlockT(&flk)
+	cmd := _F_OFD_SETLK
+	if blocking {
+		cmd = _F_OFD_SETLKW
+	}
+	return fuse.ToStatus(syscall.FcntlFlock(f.File.Fd(), cmd, &flk))
+}
+
+// Ioctl commands that only read or write a buffer of the size
+// encoded in the command, and that are therefore safe to pass on to
+// the backing file. FICLONE is not among them: the kernel handles it
+// in the VFS layer, so it never reaches a FUSE file system.
+const (
+	_FS_IOC_GETFLAGS   = 0x80086601
+	_FS_IOC_SETFLAGS   = 0x40086602
+	_FS_IOC32_GETFLAGS = 0x80046601
+	_FS_IOC32_SETFLAGS = 0x40046602
+	_FS_IOC_GETVERSION = 0x80087601
+	_FS_IOC_FSGETXATTR = 0x801c581f
+	_FS_IOC_FSSETXATTR = 0x401c5820
+)
+
+var loopbackIoctls = map[uint32]bool{
+	_FS_IOC_GETFLAGS:   true,
+	_FS_IOC_SETFLAGS:   true,
+	_FS_IOC32_GETFLAGS: true,
+	_FS_IOC32_SETFLAGS: true,
+	_FS_IOC_GETVERSION: true,
+	_FS_IOC_FSGETXATTR: true,
+	_FS_IOC_FSSETXATTR: true,
+}
+
+func (f *loopbackFile) Ioctl(cmd uint32, arg uint64, input []byte, output []byte) (result int32, code fuse.Status) {
+	if !loopbackIoctls[cmd] {
+		return 0, fuse.ENOTTY
+	}
+
+	// The kernel may ask for less data than the command encodes,
+	// eg. 4 bytes for FS_IOC_GETFLAGS, so make room for whatever
+	// the backing file system writes.
+	sz := int(cmd>>16) & 0x3fff
+	if len(input) > sz {
+		sz = len(input)
+	}
+	if len(output) > sz {
+		sz = len(output)
+	}
+	buf := make([]byte, sz)
+	copy(buf, input)
+
+	f.lock.Lock()
+	r, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.File.Fd(), uintptr(cmd), uintptr(unsafe.Pointer(&buf[0])))
+	f.lock.Unlock()
+	if errno != 0 {
+		return 0, fuse.Status(errno)
+	}
+	copy(output, buf)
+	return int32(r), fuse.OK
+}
+
+// The result must fit the uint32 in the reply.
+const _MAX_COPY_SIZE = 1 << 30
+
+// CopyFileRange copies between backing files with
+// copy_file_range(2), so file systems that support it can share
+// extents or copy on the server side.
+func (f *loopbackFile) CopyFileRange(offIn uint64, out File, offOut uint64, size uint64, flags uint64) (uint32, fuse.Status) {
+	dst := toLoopbackFile(out)
+	if dst == nil || _SYS_COPY_FILE_RANGE == 0 {
+		return 0, fuse.ENOSYS
+	}
+	if size > _MAX_COPY_SIZE {
+		size = _MAX_COPY_SIZE
+	}
+	inOff := int64(offIn)
+	outOff := int64(offOut)
+
+	// Only take our own lock: taking dst.lock too could deadlock
+	// against a copy in the other direction. Like for Read, the
+	// kernel does not release dst while this call is in flight.
+	f.lock.Lock()
+	n, _, errno := syscall.Syscall6(_SYS_COPY_FILE_RANGE,
+		f.File.Fd(), uintptr(unsafe.Pointer(&inOff)),
+		dst.File.Fd(), uintptr(unsafe.Pointer(&outOff)),
+		uintptr(size), uintptr(flags))
+	f.lock.Unlock()
+	if errno != 0 {
+		return 0, fuse.Status(errno)
+	}
+	return uint32(n), fuse.OK
 }
@@ -0,0 +1,141 @@
+package nodefs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestLoopbackFileUtimensOmit(t *testing.T) {
+	f, err := ioutil.TempFile("", "go-fuse-utimens")
+	if err != nil {
+		t.Fatalf("TempFile failed: %v", err)
+	}
+	defer os.Remove(f.Name())
+
+	atime := time.Unix(1000000, 0)
+	mtime := time.Unix(2000000, 0)
+	if err := os.Chtimes(f.Name(), atime, mtime); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+
+	lf := NewLoopbackFile(f)
+	defer lf.Release()
+	newMtime := time.Unix(3000000, 0)
+	if code := lf.Utimens(nil, &newMtime); !code.Ok() {
+		t.Fatalf("Utimens failed: %v", code)
+	}
+
+	var st syscall.Stat_t
+	if err := syscall.Stat(f.Name(), &st); err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if st.Atim.Sec != atime.Unix() {
+		t.Errorf("atime changed to %d, want %d", st.Atim.Sec, atime.Unix())
+	}
+	if st.Mtim.Sec != newMtime.Unix() {
+		t.Errorf("got mtime %d, want %d", st.Mtim.Sec, newMtime.Unix())
+	}
+}
+
+func TestLoopbackFileCopyFileRange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-fuse-copy")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := bytes.Repeat([]byte("abcdefghijklmnop"), 1000)
+	if err := ioutil.WriteFile(dir+"/src", content, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	src, err := os.Open(dir + "/src")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	dst, err := os.Create(dir + "/dst")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	in := NewLockingFile(&sync.Mutex{}, NewLoopbackFile(src))
+	defer in.Release()
+	outMu := &sync.Mutex{}
+	out := NewLockingFile(outMu, NewLoopbackFile(dst))
+	defer out.Release()
+
+	// The copy must wait for the lock of the destination.
+	outMu.Lock()
+	type result struct {
+		n    uint32
+		code fuse.Status
+	}
+	done := make(chan result, 1)
+	go func() {
+		n, code := in.CopyFileRange(16, out, 0, uint64(len(content)), 0)
+		done <- result{n, code}
+	}()
+	select {
+	case <-done:
+		t.Fatal("CopyFileRange did not take the lock of the destination")
+	case <-time.After(10 * time.Millisecond):
+	}
+	outMu.Unlock()
+	r := <-done
+	if r.code == fuse.ENOSYS {
+		t.Skip("copy_file_range not supported")
+	}
+	if !r.code.Ok() || int(r.n) != len(content)-16 {
+		t.Fatalf("CopyFileRange: got %d, %v", r.n, r.code)
+	}
+	got, err := ioutil.ReadFile(dir + "/dst")
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if !bytes.Equal(got, content[16:]) {
+		t.Errorf("got %d bytes, want %d", len(got), len(content)-16)
+	}
+
+	if _, code := in.CopyFileRange(0, NewDefaultFile(), 0, 10, 0); code != fuse.ENOSYS {
+		t.Errorf("copy to non-loopback file: got %v, want ENOSYS", code)
+	}
+	// Without the wrapper, the lock of out cannot be taken.
+	bare := NewLoopbackFile(src)
+	if _, code := bare.CopyFileRange(0, out, 0, 10, 0); code != fuse.ENOSYS {
+		t.Errorf("copy to locking file: got %v, want ENOSYS", code)
+	}
+}
+
+func TestLoopbackFileLseek(t *testing.T) {
+	f, err := ioutil.TempFile("", "go-fuse-lseek")
+	if err != nil {
+		t.Fatalf("TempFile failed: %v", err)
+	}
+	defer os.Remove(f.Name())
+
+	const dataOff = 1 << 20
+	if _, err := f.WriteAt([]byte("data"), dataOff); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+
+	lf := NewLoopbackFile(f)
+	defer lf.Release()
+	const seekData = 3
+	off, code := lf.Lseek(0, seekData)
+	if code == fuse.Status(syscall.EINVAL) {
+		t.Skip("SEEK_DATA not supported")
+	}
+	if !code.Ok() {
+		t.Fatalf("Lseek failed: %v", code)
+	}
+	// File systems without hole support report all data.
+	if off != dataOff && off != 0 {
+		t.Errorf("got data at %d, want %d", off, dataOff)
+	}
+}
@@ -80,6 +80,19 @@ func (c *FileSystemConnector) Server() *fuse.Server {
 	return c.server
 }
 
+// context returns the Context that is passed to nodes for the
+// request with the given header. Lookups that do not come from the
+// kernel have no header, and get no Context.
+func (c *FileSystemConnector) context(header *fuse.InHeader) *fuse.Context {
+	if header == nil {
+		return nil
+	}
+	if c.server == nil {
+		return &fuse.Context{Owner: header.Owner, Pid: header.Pid}
+	}
+	return c.server.Context(header)
+}
+
 // SetDebug toggles printing of debug information.
 func (c *FileSystemConnector) SetDebug(debug bool) {
 	c.debug = debug
@@ -415,3 +428,41 @@ func (c *FileSystemConnector) DeleteNotify(dir *Inode, child *Inode, name string
 
 	return c.server.DeleteNotify(nId, chId, name)
 }
+
+// FileNotifyStoreCache stores data in the kernel's page cache for
+// node, starting at off.
+func (c *FileSystemConnector) FileNotifyStoreCache(node *Inode, off int64, data []byte) fuse.Status {
+	nId := c.nodeId(node)
+	if nId == 0 {
+		return fuse.OK
+	}
+	return c.server.InodeNotifyStoreCache(nId, off, data)
+}
+
+// FileRetrieveCache reads data that the kernel caches for node,
+// starting at off, into dest. It returns the number of bytes read,
+// or EINTR if cancel is closed before the kernel answers.
+func (c *FileSystemConnector) FileRetrieveCache(node *Inode, off int64, dest []byte, cancel <-chan struct{}) (n int, st fuse.Status) {
+	nId := c.nodeId(node)
+	if nId == 0 {
+		// The kernel does not know the node, so it caches
+		// nothing.
+		return 0, fuse.OK
+	}
+	return c.server.InodeRetrieveCache(nId, off, dest, cancel)
+}
+
+// nodeId returns the ID under which the kernel knows node, or 0 if
+// it does not know it.
+func (c *FileSystemConnector) nodeId(node *Inode) uint64 {
+	if node == c.rootNode {
+		return fuse.FUSE_ROOT_ID
+	}
+	return c.inodeMap.Handle(&node.handled)
+}
+
+// PollNotify wakes up poll(2) callers waiting on a file, identified
+// by the kernel handle that was passed to File.Poll.
+func (c *FileSystemConnector) PollNotify(kh uint64) fuse.Status {
+	return c.server.PollNotify(kh)
+}
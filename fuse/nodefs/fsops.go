@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/hanwen/go-fuse/fuse"
@@ -54,6 +55,10 @@ func (c *rawBridge) Init(s *fuse.Server) {
 	c.server = s
 }
 
+func (c *rawBridge) context(header *fuse.InHeader) *fuse.Context {
+	return c.fsConn().context(header)
+}
+
 func (c *FileSystemConnector) lookupMountUpdate(out *fuse.Attr, mount *fileSystemMount) (node *Inode, code fuse.Status) {
 	code = mount.fs.Root().GetAttr(out, nil, nil)
 	if !code.Ok() {
@@ -76,10 +81,10 @@ func (c *FileSystemConnector) internalLookup(out *fuse.Attr, parent *Inode, name
 	}
 	var fsNode Node
 	if child != nil {
-		code = child.fsInode.GetAttr(out, nil, &header.Context)
+		code = child.fsInode.GetAttr(out, nil, c.context(header))
 		fsNode = child.Node()
 	} else {
-		fsNode, code = parent.fsInode.Lookup(out, name, &header.Context)
+		fsNode, code = parent.fsInode.Lookup(out, name, c.context(header))
 	}
 
 	if child == nil && fsNode != nil {
@@ -133,7 +138,7 @@ func (c *rawBridge) GetAttr(input *fuse.GetAttrIn, out *fuse.AttrOut) (code fuse
 	}
 
 	dest := (*fuse.Attr)(&out.Attr)
-	code = node.fsInode.GetAttr(dest, f, &input.Context)
+	code = node.fsInode.GetAttr(dest, f, c.context(&input.InHeader))
 	if !code.Ok() {
 		return code
 	}
@@ -144,7 +149,7 @@ func (c *rawBridge) GetAttr(input *fuse.GetAttrIn, out *fuse.AttrOut) (code fuse
 
 func (c *rawBridge) OpenDir(input *fuse.OpenIn, out *fuse.OpenOut) (code fuse.Status) {
 	node := c.toInode(input.NodeId)
-	stream, err := node.fsInode.OpenDir(&input.Context)
+	stream, err := node.fsInode.OpenDir(c.context(&input.InHeader))
 	if err != fuse.OK {
 		return err
 	}
@@ -174,9 +179,30 @@ func (c *rawBridge) ReadDirPlus(input *fuse.ReadIn, out *fuse.DirEntryList) fuse
 	return opened.dir.ReadDirPlus(input, out)
 }
 
+// openFlags adapts open flags to the writeback cache. The kernel
+// then computes O_APPEND offsets itself, and may read pages from a
+// file to fill in partial writes, so files are opened for reading
+// too.
+func (c *rawBridge) openFlags(flags uint32) uint32 {
+	if c.server == nil || c.server.KernelSettings().Flags&fuse.CAP_WRITEBACK_CACHE == 0 {
+		return flags
+	}
+	flags &^= syscall.O_APPEND
+	if flags&syscall.O_ACCMODE == syscall.O_WRONLY {
+		flags = flags&^syscall.O_ACCMODE | syscall.O_RDWR
+	}
+	return flags
+}
+
 func (c *rawBridge) Open(input *fuse.OpenIn, out *fuse.OpenOut) (status fuse.Status) {
 	node := c.toInode(input.NodeId)
-	f, code := node.fsInode.Open(input.Flags, &input.Context)
+	flags := c.openFlags(input.Flags)
+	ctx := c.context(&input.InHeader)
+	f, code := node.fsInode.Open(flags, ctx)
+	if code == fuse.EACCES && flags&syscall.O_ACCMODE != input.Flags&syscall.O_ACCMODE {
+		// Not readable; the kernel will have to do without.
+		f, code = node.fsInode.Open(flags&^syscall.O_ACCMODE|input.Flags&syscall.O_ACCMODE, ctx)
+	}
 	if !code.Ok() {
 		return code
 	}
@@ -188,6 +214,7 @@ func (c *rawBridge) Open(input *fuse.OpenIn, out *fuse.OpenOut) (status fuse.Sta
 
 func (c *rawBridge) SetAttr(input *fuse.SetAttrIn, out *fuse.AttrOut) (code fuse.Status) {
 	node := c.toInode(input.NodeId)
+	ctx := c.context(&input.InHeader)
 
 	var f File
 	if input.Valid&fuse.FATTR_FH != 0 {
@@ -197,13 +224,13 @@ func (c *rawBridge) SetAttr(input *fuse.SetAttrIn, out *fuse.AttrOut) (code fuse
 
 	if code.Ok() && input.Valid&fuse.FATTR_MODE != 0 {
 		permissions := uint32(07777) & input.Mode
-		code = node.fsInode.Chmod(f, permissions, &input.Context)
+		code = node.fsInode.Chmod(f, permissions, ctx)
 	}
 	if code.Ok() && (input.Valid&(fuse.FATTR_UID|fuse.FATTR_GID) != 0) {
-		code = node.fsInode.Chown(f, uint32(input.Uid), uint32(input.Gid), &input.Context)
+		code = node.fsInode.Chown(f, uint32(input.Uid), uint32(input.Gid), ctx)
 	}
 	if code.Ok() && input.Valid&fuse.FATTR_SIZE != 0 {
-		code = node.fsInode.Truncate(f, input.Size, &input.Context)
+		code = node.fsInode.Truncate(f, input.Size, ctx)
 	}
 	if code.Ok() && (input.Valid&(fuse.FATTR_ATIME|fuse.FATTR_MTIME|fuse.FATTR_ATIME_NOW|fuse.FATTR_MTIME_NOW) != 0) {
 		now := time.Now()
@@ -228,8 +255,10 @@ func (c *rawBridge) SetAttr(input *fuse.SetAttrIn, out *fuse.AttrOut) (code fuse
 			}
 		}
 
-		code = node.fsInode.Utimens(f, atime, mtime, &input.Context)
+		code = node.fsInode.Utimens(f, atime, mtime, ctx)
 	}
+	// FATTR_CTIME, which comes with the writeback cache, is
+	// ignored: the file system updates ctime by itself.
 
 	if !code.Ok() {
 		return code
@@ -238,7 +267,7 @@ func (c *rawBridge) SetAttr(input *fuse.SetAttrIn, out *fuse.AttrOut) (code fuse
 	// Must call GetAttr(); the filesystem may override some of
 	// the changes we effect here.
 	attr := (*fuse.Attr)(&out.Attr)
-	code = node.fsInode.GetAttr(attr, nil, &input.Context)
+	code = node.fsInode.GetAttr(attr, nil, ctx)
 	if code.Ok() {
 		node.mount.fillAttr(out, input.NodeId)
 	}
@@ -249,53 +278,56 @@ func (c *rawBridge) Fallocate(input *fuse.FallocateIn) (code fuse.Status) {
 	n := c.toInode(input.NodeId)
 	opened := n.mount.getOpenedFile(input.Fh)
 
-	return n.fsInode.Fallocate(opened, input.Offset, input.Length, input.Mode, &input.Context)
+	return n.fsInode.Fallocate(opened, input.Offset, input.Length, input.Mode, c.context(&input.InHeader))
 }
 
 func (c *rawBridge) Readlink(header *fuse.InHeader) (out []byte, code fuse.Status) {
 	n := c.toInode(header.NodeId)
-	return n.fsInode.Readlink(&header.Context)
+	return n.fsInode.Readlink(c.context(header))
 }
 
 func (c *rawBridge) Mknod(input *fuse.MknodIn, name string, out *fuse.EntryOut) (code fuse.Status) {
 	parent := c.toInode(input.NodeId)
+	ctx := c.context(&input.InHeader)
 
-	fsNode, code := parent.fsInode.Mknod(name, input.Mode, uint32(input.Rdev), &input.Context)
+	fsNode, code := parent.fsInode.Mknod(name, input.Mode, uint32(input.Rdev), ctx)
 	if code.Ok() {
 		c.childLookup(out, fsNode)
-		code = fsNode.GetAttr((*fuse.Attr)(&out.Attr), nil, &input.Context)
+		code = fsNode.GetAttr((*fuse.Attr)(&out.Attr), nil, ctx)
 	}
 	return code
 }
 
 func (c *rawBridge) Mkdir(input *fuse.MkdirIn, name string, out *fuse.EntryOut) (code fuse.Status) {
 	parent := c.toInode(input.NodeId)
+	ctx := c.context(&input.InHeader)
 
-	fsNode, code := parent.fsInode.Mkdir(name, input.Mode, &input.Context)
+	fsNode, code := parent.fsInode.Mkdir(name, input.Mode, ctx)
 	if code.Ok() {
 		c.childLookup(out, fsNode)
-		code = fsNode.GetAttr((*fuse.Attr)(&out.Attr), nil, &input.Context)
+		code = fsNode.GetAttr((*fuse.Attr)(&out.Attr), nil, ctx)
 	}
 	return code
 }
 
 func (c *rawBridge) Unlink(header *fuse.InHeader, name string) (code fuse.Status) {
 	parent := c.toInode(header.NodeId)
-	return parent.fsInode.Unlink(name, &header.Context)
+	return parent.fsInode.Unlink(name, c.context(header))
 }
 
 func (c *rawBridge) Rmdir(header *fuse.InHeader, name string) (code fuse.Status) {
 	parent := c.toInode(header.NodeId)
-	return parent.fsInode.Rmdir(name, &header.Context)
+	return parent.fsInode.Rmdir(name, c.context(header))
 }
 
 func (c *rawBridge) Symlink(header *fuse.InHeader, pointedTo string, linkName string, out *fuse.EntryOut) (code fuse.Status) {
 	parent := c.toInode(header.NodeId)
+	ctx := c.context(header)
 
-	fsNode, code := parent.fsInode.Symlink(linkName, pointedTo, &header.Context)
+	fsNode, code := parent.fsInode.Symlink(linkName, pointedTo, ctx)
 	if code.Ok() {
 		c.childLookup(out, fsNode)
-		code = fsNode.GetAttr((*fuse.Attr)(&out.Attr), nil, &header.Context)
+		code = fsNode.GetAttr((*fuse.Attr)(&out.Attr), nil, ctx)
 	}
 	return code
 }
@@ -315,22 +347,28 @@ func (c *rawBridge) Rename(input *fuse.RenameIn, oldName string, newName string)
 	if oldParent.mount != newParent.mount {
 		return fuse.EXDEV
 	}
+	if input.Flags&fuse.RENAME_EXCHANGE != 0 {
+		if target := newParent.GetChild(newName); target != nil && target.mountPoint != nil {
+			return fuse.EBUSY
+		}
+	}
 
-	return oldParent.fsInode.Rename(oldName, newParent.fsInode, newName, &input.Context)
+	return oldParent.fsInode.Rename(oldName, newParent.fsInode, newName, input.Flags, c.context(&input.InHeader))
 }
 
 func (c *rawBridge) Link(input *fuse.LinkIn, name string, out *fuse.EntryOut) (code fuse.Status) {
 	existing := c.toInode(input.Oldnodeid)
 	parent := c.toInode(input.NodeId)
+	ctx := c.context(&input.InHeader)
 
 	if existing.mount != parent.mount {
 		return fuse.EXDEV
 	}
 
-	fsNode, code := parent.fsInode.Link(name, existing.fsInode, &input.Context)
+	fsNode, code := parent.fsInode.Link(name, existing.fsInode, ctx)
 	if code.Ok() {
 		c.childLookup(out, fsNode)
-		code = fsNode.GetAttr((*fuse.Attr)(&out.Attr), nil, &input.Context)
+		code = fsNode.GetAttr((*fuse.Attr)(&out.Attr), nil, ctx)
 	}
 
 	return code
@@ -338,12 +376,12 @@ func (c *rawBridge) Link(input *fuse.LinkIn, name string, out *fuse.EntryOut) (c
 
 func (c *rawBridge) Access(input *fuse.AccessIn) (code fuse.Status) {
 	n := c.toInode(input.NodeId)
-	return n.fsInode.Access(input.Mask, &input.Context)
+	return n.fsInode.Access(input.Mask, c.context(&input.InHeader))
 }
 
 func (c *rawBridge) Create(input *fuse.CreateIn, name string, out *fuse.CreateOut) (code fuse.Status) {
 	parent := c.toInode(input.NodeId)
-	f, fsNode, code := parent.fsInode.Create(name, uint32(input.Flags), input.Mode, &input.Context)
+	f, fsNode, code := parent.fsInode.Create(name, c.openFlags(input.Flags), input.Mode, c.context(&input.InHeader))
 	if !code.Ok() {
 		return code
 	}
@@ -369,28 +407,28 @@ func (c *rawBridge) ReleaseDir(input *fuse.ReleaseIn) {
 
 func (c *rawBridge) GetXAttrSize(header *fuse.InHeader, attribute string) (sz int, code fuse.Status) {
 	node := c.toInode(header.NodeId)
-	data, errno := node.fsInode.GetXAttr(attribute, &header.Context)
+	data, errno := node.fsInode.GetXAttr(attribute, c.context(header))
 	return len(data), errno
 }
 
 func (c *rawBridge) GetXAttrData(header *fuse.InHeader, attribute string) (data []byte, code fuse.Status) {
 	node := c.toInode(header.NodeId)
-	return node.fsInode.GetXAttr(attribute, &header.Context)
+	return node.fsInode.GetXAttr(attribute, c.context(header))
 }
 
 func (c *rawBridge) RemoveXAttr(header *fuse.InHeader, attr string) fuse.Status {
 	node := c.toInode(header.NodeId)
-	return node.fsInode.RemoveXAttr(attr, &header.Context)
+	return node.fsInode.RemoveXAttr(attr, c.context(header))
 }
 
 func (c *rawBridge) SetXAttr(input *fuse.SetXAttrIn, attr string, data []byte) fuse.Status {
 	node := c.toInode(input.NodeId)
-	return node.fsInode.SetXAttr(attr, data, int(input.Flags), &input.Context)
+	return node.fsInode.SetXAttr(attr, data, int(input.Flags), c.context(&input.InHeader))
 }
 
 func (c *rawBridge) ListXAttr(header *fuse.InHeader) (data []byte, code fuse.Status) {
 	node := c.toInode(header.NodeId)
-	attrs, code := node.fsInode.ListXAttr(&header.Context)
+	attrs, code := node.fsInode.ListXAttr(c.context(header))
 	if code != fuse.OK {
 		return nil, code
 	}
@@ -413,6 +451,28 @@ func (c *rawBridge) Write(input *fuse.WriteIn, data []byte) (written uint32, cod
 	return opened.WithFlags.File.Write(data, int64(input.Offset))
 }
 
+func (c *rawBridge) SpliceWrite(input *fuse.WriteIn, data *fuse.WritePipe) (written uint32, code fuse.Status) {
+	node := c.toInode(input.NodeId)
+	opened := node.mount.getOpenedFile(input.Fh)
+	return opened.WithFlags.File.SpliceWrite(data, int64(input.Offset))
+}
+
+func (c *rawBridge) Lseek(input *fuse.LseekIn, out *fuse.LseekOut) fuse.Status {
+	node := c.toInode(input.NodeId)
+	opened := node.mount.getOpenedFile(input.Fh)
+	off, code := node.fsInode.Lseek(opened.WithFlags.File, input.Offset, input.Whence, c.context(&input.InHeader))
+	out.Offset = off
+	return code
+}
+
+func (c *rawBridge) CopyFileRange(input *fuse.CopyFileRangeIn) (written uint32, code fuse.Status) {
+	node := c.toInode(input.NodeId)
+	in := node.mount.getOpenedFile(input.FhIn)
+	outNode := c.toInode(input.NodeIdOut)
+	out := outNode.mount.getOpenedFile(input.FhOut)
+	return node.fsInode.CopyFileRange(in.WithFlags.File, input.OffIn, outNode, out.WithFlags.File, input.OffOut, input.Len, input.Flags, c.context(&input.InHeader))
+}
+
 func (c *rawBridge) Read(input *fuse.ReadIn, buf []byte) (fuse.ReadResult, fuse.Status) {
 	node := c.toInode(input.NodeId)
 	opened := node.mount.getOpenedFile(input.Fh)
@@ -435,3 +495,44 @@ func (c *rawBridge) Flush(input *fuse.FlushIn) fuse.Status {
 	opened := node.mount.getOpenedFile(input.Fh)
 	return opened.WithFlags.File.Flush()
 }
+
+func (c *rawBridge) GetLk(input *fuse.LkIn, out *fuse.LkOut) (code fuse.Status) {
+	n := c.toInode(input.NodeId)
+	opened := n.mount.getOpenedFile(input.Fh)
+
+	return n.fsInode.GetLk(opened.WithFlags.File, input.Owner, &input.Lk, input.LkFlags, &out.Lk, c.context(&input.InHeader))
+}
+
+func (c *rawBridge) SetLk(input *fuse.LkIn) (code fuse.Status) {
+	n := c.toInode(input.NodeId)
+	opened := n.mount.getOpenedFile(input.Fh)
+
+	return n.fsInode.SetLk(opened.WithFlags.File, input.Owner, &input.Lk, input.LkFlags, c.context(&input.InHeader))
+}
+
+func (c *rawBridge) SetLkw(input *fuse.LkIn) (code fuse.Status) {
+	n := c.toInode(input.NodeId)
+	opened := n.mount.getOpenedFile(input.Fh)
+
+	return n.fsInode.SetLkw(opened.WithFlags.File, input.Owner, &input.Lk, input.LkFlags, c.context(&input.InHeader))
+}
+
+func (c *rawBridge) Ioctl(input *fuse.IoctlIn, inData []byte, out *fuse.IoctlOut, outData []byte) (code fuse.Status) {
+	node := c.toInode(input.NodeId)
+	opened := node.mount.getOpenedFile(input.Fh)
+	if opened.WithFlags.File == nil {
+		// Directory handles have no File.
+		return fuse.ENOTTY
+	}
+
+	out.Result, code = opened.WithFlags.File.Ioctl(input.Cmd, input.Arg, inData, outData)
+	return code
+}
+
+func (c *rawBridge) Poll(input *fuse.PollIn, out *fuse.PollOut) (code fuse.Status) {
+	node := c.toInode(input.NodeId)
+	opened := node.mount.getOpenedFile(input.Fh)
+
+	out.Revents, code = opened.WithFlags.File.Poll(input.Kh, input.Flags, input.Events)
+	return code
+}
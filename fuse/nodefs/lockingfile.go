@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"sync"
 	"time"
+	"unsafe"
 
 	"github.com/hanwen/go-fuse/fuse"
 )
@@ -45,6 +46,12 @@ func (f *lockingFile) Write(data []byte, off int64) (uint32, fuse.Status) {
 	return f.file.Write(data, off)
 }
 
+func (f *lockingFile) SpliceWrite(data *fuse.WritePipe, off int64) (uint32, fuse.Status) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.SpliceWrite(data, off)
+}
+
 func (f *lockingFile) Flush() fuse.Status {
 	f.mu.Lock()
 	defer f.mu.Unlock()
@@ -98,3 +105,61 @@ func (f *lockingFile) Allocate(off uint64, size uint64, mode uint32) (code fuse.
 	defer f.mu.Unlock()
 	return f.file.Allocate(off, size, mode)
 }
+
+func (f *lockingFile) Lseek(off uint64, whence uint32) (uint64, fuse.Status) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Lseek(off, whence)
+}
+
+// CopyFileRange also holds the lock of out if that is a lockingFile,
+// and passes on the file that out wraps. The locks are taken in a
+// fixed order, so copies in opposite directions cannot deadlock.
+func (f *lockingFile) CopyFileRange(offIn uint64, out File, offOut uint64, size uint64, flags uint64) (uint32, fuse.Status) {
+	first, second := f.mu, f.mu
+	if lf, ok := out.(*lockingFile); ok {
+		out = lf.file
+		if uintptr(unsafe.Pointer(lf.mu)) < uintptr(unsafe.Pointer(f.mu)) {
+			first = lf.mu
+		} else {
+			second = lf.mu
+		}
+	}
+	first.Lock()
+	defer first.Unlock()
+	if second != first {
+		second.Lock()
+		defer second.Unlock()
+	}
+	return f.file.CopyFileRange(offIn, out, offOut, size, flags)
+}
+
+func (f *lockingFile) GetLk(owner uint64, lk *fuse.FileLock, flags uint32, out *fuse.FileLock) (code fuse.Status) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.GetLk(owner, lk, flags, out)
+}
+
+func (f *lockingFile) SetLk(owner uint64, lk *fuse.FileLock, flags uint32) (code fuse.Status) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.SetLk(owner, lk, flags)
+}
+
+// SetLkw does not take the mutex: it may block until the lock is
+// released through another file sharing the same mutex.
+func (f *lockingFile) SetLkw(owner uint64, lk *fuse.FileLock, flags uint32) (code fuse.Status) {
+	return f.file.SetLkw(owner, lk, flags)
+}
+
+func (f *lockingFile) Ioctl(cmd uint32, arg uint64, input []byte, output []byte) (result int32, code fuse.Status) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Ioctl(cmd, arg, input, output)
+}
+
+func (f *lockingFile) Poll(kh uint64, flags uint32, events uint32) (revents uint32, code fuse.Status) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Poll(kh, flags, events)
+}
@@ -120,7 +120,29 @@ func (n *memNode) Symlink(name string, content string, context *fuse.Context) (n
 	return ch, fuse.OK
 }
 
-func (n *memNode) Rename(oldName string, newParent Node, newName string, context *fuse.Context) (code fuse.Status) {
+func (n *memNode) Rename(oldName string, newParent Node, newName string, flags uint32, context *fuse.Context) (code fuse.Status) {
+	if flags&^(fuse.RENAME_NOREPLACE|fuse.RENAME_EXCHANGE) != 0 ||
+		flags == fuse.RENAME_NOREPLACE|fuse.RENAME_EXCHANGE {
+		return fuse.EINVAL
+	}
+	if n.Inode().GetChild(oldName) == nil {
+		return fuse.ENOENT
+	}
+	target := newParent.Inode().GetChild(newName)
+	if flags&fuse.RENAME_NOREPLACE != 0 && target != nil {
+		return fuse.Status(syscall.EEXIST)
+	}
+	if flags&fuse.RENAME_EXCHANGE != 0 {
+		if target == nil {
+			return fuse.ENOENT
+		}
+		ch := n.Inode().RmChild(oldName)
+		other := newParent.Inode().RmChild(newName)
+		newParent.Inode().AddChild(newName, ch)
+		n.Inode().AddChild(oldName, other)
+		return fuse.OK
+	}
+
 	ch := n.Inode().RmChild(oldName)
 	newParent.Inode().RmChild(newName)
 	newParent.Inode().AddChild(newName, ch)
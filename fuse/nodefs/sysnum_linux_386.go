@@ -0,0 +1,4 @@
+package nodefs
+
+// Not in the syscall package.
+const _SYS_COPY_FILE_RANGE = 377
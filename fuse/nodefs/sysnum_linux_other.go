@@ -0,0 +1,7 @@
+// +build linux,!amd64,!386,!arm,!arm64
+
+package nodefs
+
+// We don't know the number on this architecture, so the features
+// that need it report ENOSYS.
+const _SYS_COPY_FILE_RANGE = 0
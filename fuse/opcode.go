@@ -4,59 +4,67 @@ import (
 	"bytes"
 	"log"
 	"reflect"
+	"sync/atomic"
+	"syscall"
 	"unsafe"
 )
 
 const (
-	_OP_LOOKUP       = int32(1)
-	_OP_FORGET       = int32(2)
-	_OP_GETATTR      = int32(3)
-	_OP_SETATTR      = int32(4)
-	_OP_READLINK     = int32(5)
-	_OP_SYMLINK      = int32(6)
-	_OP_MKNOD        = int32(8)
-	_OP_MKDIR        = int32(9)
-	_OP_UNLINK       = int32(10)
-	_OP_RMDIR        = int32(11)
-	_OP_RENAME       = int32(12)
-	_OP_LINK         = int32(13)
-	_OP_OPEN         = int32(14)
-	_OP_READ         = int32(15)
-	_OP_WRITE        = int32(16)
-	_OP_STATFS       = int32(17)
-	_OP_RELEASE      = int32(18)
-	_OP_FSYNC        = int32(20)
-	_OP_SETXATTR     = int32(21)
-	_OP_GETXATTR     = int32(22)
-	_OP_LISTXATTR    = int32(23)
-	_OP_REMOVEXATTR  = int32(24)
-	_OP_FLUSH        = int32(25)
-	_OP_INIT         = int32(26)
-	_OP_OPENDIR      = int32(27)
-	_OP_READDIR      = int32(28)
-	_OP_RELEASEDIR   = int32(29)
-	_OP_FSYNCDIR     = int32(30)
-	_OP_GETLK        = int32(31)
-	_OP_SETLK        = int32(32)
-	_OP_SETLKW       = int32(33)
-	_OP_ACCESS       = int32(34)
-	_OP_CREATE       = int32(35)
-	_OP_INTERRUPT    = int32(36)
-	_OP_BMAP         = int32(37)
-	_OP_DESTROY      = int32(38)
-	_OP_IOCTL        = int32(39)
-	_OP_POLL         = int32(40)
-	_OP_NOTIFY_REPLY = int32(41)
-	_OP_BATCH_FORGET = int32(42)
-	_OP_FALLOCATE    = int32(43) // protocol version 19.
-	_OP_READDIRPLUS  = int32(44) // protocol version 21.
+	_OP_LOOKUP          = int32(1)
+	_OP_FORGET          = int32(2)
+	_OP_GETATTR         = int32(3)
+	_OP_SETATTR         = int32(4)
+	_OP_READLINK        = int32(5)
+	_OP_SYMLINK         = int32(6)
+	_OP_MKNOD           = int32(8)
+	_OP_MKDIR           = int32(9)
+	_OP_UNLINK          = int32(10)
+	_OP_RMDIR           = int32(11)
+	_OP_RENAME          = int32(12)
+	_OP_LINK            = int32(13)
+	_OP_OPEN            = int32(14)
+	_OP_READ            = int32(15)
+	_OP_WRITE           = int32(16)
+	_OP_STATFS          = int32(17)
+	_OP_RELEASE         = int32(18)
+	_OP_FSYNC           = int32(20)
+	_OP_SETXATTR        = int32(21)
+	_OP_GETXATTR        = int32(22)
+	_OP_LISTXATTR       = int32(23)
+	_OP_REMOVEXATTR     = int32(24)
+	_OP_FLUSH           = int32(25)
+	_OP_INIT            = int32(26)
+	_OP_OPENDIR         = int32(27)
+	_OP_READDIR         = int32(28)
+	_OP_RELEASEDIR      = int32(29)
+	_OP_FSYNCDIR        = int32(30)
+	_OP_GETLK           = int32(31)
+	_OP_SETLK           = int32(32)
+	_OP_SETLKW          = int32(33)
+	_OP_ACCESS          = int32(34)
+	_OP_CREATE          = int32(35)
+	_OP_INTERRUPT       = int32(36)
+	_OP_BMAP            = int32(37)
+	_OP_DESTROY         = int32(38)
+	_OP_IOCTL           = int32(39)
+	_OP_POLL            = int32(40)
+	_OP_NOTIFY_REPLY    = int32(41)
+	_OP_BATCH_FORGET    = int32(42)
+	_OP_FALLOCATE       = int32(43) // protocol version 19.
+	_OP_READDIRPLUS     = int32(44) // protocol version 21.
+	_OP_RENAME2         = int32(45) // protocol version 23.
+	_OP_LSEEK           = int32(46) // protocol version 24.
+	_OP_COPY_FILE_RANGE = int32(47) // protocol version 28.
 
 	// The following entries don't have to be compatible across Go-FUSE versions.
-	_OP_NOTIFY_ENTRY  = int32(100)
-	_OP_NOTIFY_INODE  = int32(101)
-	_OP_NOTIFY_DELETE = int32(102) // protocol version 18
-
-	_OPCODE_COUNT = int32(103)
+	_OP_NOTIFY_ENTRY    = int32(100)
+	_OP_NOTIFY_INODE    = int32(101)
+	_OP_NOTIFY_DELETE   = int32(102) // protocol version 18
+	_OP_NOTIFY_POLL     = int32(103)
+	_OP_NOTIFY_STORE    = int32(104) // protocol version 15
+	_OP_NOTIFY_RETRIEVE = int32(105) // protocol version 15
+
+	_OPCODE_COUNT = int32(106)
 )
 
 ////////////////////////////////////////////////////////////////
@@ -75,13 +83,49 @@ func doInit(server *Server, req *request) {
 	}
 
 	server.reqMu.Lock()
+	if server.kernelSettings.Major != 0 {
+		server.reqMu.Unlock()
+		log.Printf("Ignoring repeated INIT")
+		req.status = EINVAL
+		return
+	}
 	server.kernelSettings = *input
 	server.kernelSettings.Flags = input.Flags & (CAP_ASYNC_READ | CAP_BIG_WRITES | CAP_FILE_OPS |
 		CAP_AUTO_INVAL_DATA | CAP_READDIRPLUS)
+	if server.opts.EnableLocks {
+		server.kernelSettings.Flags |= input.Flags & (CAP_POSIX_LOCKS | CAP_FLOCK_LOCKS)
+	}
+	if server.opts.EnableParallelDirOps {
+		server.kernelSettings.Flags |= input.Flags & CAP_PARALLEL_DIROPS
+	}
+	if server.opts.EnableSymlinkCache {
+		server.kernelSettings.Flags |= input.Flags & CAP_CACHE_SYMLINKS
+	}
+	if server.opts.EnableWritebackCache {
+		server.kernelSettings.Flags |= input.Flags & CAP_WRITEBACK_CACHE
+	}
+	if server.opts.EnableSpliceWrites {
+		server.kernelSettings.Flags |= input.Flags & CAP_SPLICE_READ
+	}
+	if server.opts.EnableNoOpen {
+		server.kernelSettings.Flags |= input.Flags & (CAP_NO_OPEN_SUPPORT | CAP_NO_OPENDIR_SUPPORT)
+	}
 
-	if input.Minor >= 13 {
-		server.setSplice()
+	maxWrite := server.opts.MaxWrite
+	var maxPages uint16
+	if maxWrite > MAX_KERNEL_WRITE {
+		if input.Flags&CAP_MAX_PAGES != 0 {
+			server.kernelSettings.Flags |= CAP_MAX_PAGES
+			maxPages = uint16((maxWrite + PAGESIZE - 1) / PAGESIZE)
+		} else {
+			// Requests will not be larger, so read them into
+			// smaller buffers.
+			maxWrite = MAX_KERNEL_WRITE
+			server.opts.MaxWrite = maxWrite
+			atomic.StoreInt64(&server.readBufSize, int64(maxWrite+PAGESIZE))
+		}
 	}
+
 	server.reqMu.Unlock()
 
 	out := &InitOut{
@@ -89,14 +133,22 @@ func doInit(server *Server, req *request) {
 		Minor:               _OUR_MINOR_VERSION,
 		MaxReadAhead:        input.MaxReadAhead,
 		Flags:               server.kernelSettings.Flags,
-		MaxWrite:            uint32(server.opts.MaxWrite),
+		MaxWrite:            uint32(maxWrite),
 		CongestionThreshold: uint16(server.opts.MaxBackground * 3 / 4),
 		MaxBackground:       uint16(server.opts.MaxBackground),
+		MaxPages:            maxPages,
 	}
 	if out.Minor > input.Minor {
 		out.Minor = input.Minor
 	}
 
+	if input.Minor < 23 {
+		// Older kernels reject a reply that is larger than
+		// the InitOut they know.
+		h := *req.handler
+		h.OutputSize = _COMPAT_22_INIT_OUT_SIZE
+		req.handler = &h
+	}
 	req.outData = unsafe.Pointer(out)
 	req.status = OK
 }
@@ -139,6 +191,9 @@ func doReadDirPlus(server *Server, req *request) {
 func doOpenDir(server *Server, req *request) {
 	out := (*OpenOut)(req.outData)
 	status := server.fileSystem.OpenDir((*OpenIn)(req.inData), out)
+	if status == OK && server.opts.EnableDirCache {
+		out.OpenFlags |= FOPEN_CACHE_DIR | FOPEN_KEEP_CACHE
+	}
 	req.status = status
 }
 
@@ -148,8 +203,22 @@ func doSetattr(server *Server, req *request) {
 }
 
 func doWrite(server *Server, req *request) {
-	n, status := server.fileSystem.Write((*WriteIn)(req.inData), req.arg)
+	in := (*WriteIn)(req.inData)
 	o := (*WriteOut)(req.outData)
+	if req.writePipe != nil {
+		n, status := server.fileSystem.SpliceWrite(in, req.writePipe)
+		if status != ENOSYS {
+			o.Size = n
+			req.status = status
+			return
+		}
+		// The file system wants the data in memory.
+		if _, err := req.writePipe.Bytes(req.arg); err != nil {
+			req.status = ToStatus(err)
+			return
+		}
+	}
+	n, status := server.fileSystem.Write(in, req.arg)
 	o.Size = n
 	req.status = status
 }
@@ -227,13 +296,11 @@ func doForget(server *Server, req *request) {
 
 func doBatchForget(server *Server, req *request) {
 	in := (*_BatchForgetIn)(req.inData)
-	wantBytes := uintptr(in.Count) * unsafe.Sizeof(_ForgetOne{})
-	if uintptr(len(req.arg)) < wantBytes {
-		// We have no return value to complain, so log an error.
-		log.Printf("Too few bytes for batch forget. Got %d bytes, want %d (%d entries)",
-			len(req.arg), wantBytes, in.Count)
+	if in.Count == 0 {
+		return
 	}
 
+	// parse has checked that req.arg holds in.Count entries.
 	h := &reflect.SliceHeader{uintptr(unsafe.Pointer(&req.arg[0])), int(in.Count), int(in.Count)}
 
 	forgets := *(*[]_ForgetOne)(unsafe.Pointer(h))
@@ -328,6 +395,8 @@ func doSymlink(server *Server, req *request) {
 	req.status = server.fileSystem.Symlink(req.inHeader, req.filenames[1], req.filenames[0], out)
 }
 
+// doRename handles RENAME and RENAME2; request.parse widens the
+// input of the former.
 func doRename(server *Server, req *request) {
 	req.status = server.fileSystem.Rename((*RenameIn)(req.inData), req.filenames[0], req.filenames[1])
 }
@@ -338,7 +407,66 @@ func doStatFs(server *Server, req *request) {
 }
 
 func doIoctl(server *Server, req *request) {
-	req.status = ENOSYS
+	in := (*IoctlIn)(req.inData)
+	if in.Flags&FUSE_IOCTL_UNRESTRICTED != 0 {
+		// Unrestricted ioctls need the retry protocol, which
+		// the kernel only allows for CUSE.
+		req.status = ENOSYS
+		return
+	}
+
+	out := (*IoctlOut)(req.outData)
+	buf := server.allocOut(req, in.OutSize)
+	req.status = server.fileSystem.Ioctl(in, req.arg, out, buf)
+	if req.status == OK {
+		req.flatData = buf
+	}
+}
+
+func doPoll(server *Server, req *request) {
+	req.status = server.fileSystem.Poll((*PollIn)(req.inData), (*PollOut)(req.outData))
+}
+
+func doNotifyReply(server *Server, req *request) {
+	reply := (*NotifyRetrieveIn)(req.inData)
+	server.retrieveMu.Lock()
+	r := server.retrieveTab[reply.Unique]
+	delete(server.retrieveTab, reply.Unique)
+	server.retrieveMu.Unlock()
+
+	if r == nil {
+		log.Printf("NOTIFY_REPLY for unknown retrieve %d", reply.Unique)
+		return
+	}
+	data := req.arg
+	if len(data) > int(reply.Size) {
+		data = data[:reply.Size]
+	}
+	r.n = copy(r.dest, data)
+	close(r.ready)
+}
+
+func doGetLk(server *Server, req *request) {
+	req.status = server.fileSystem.GetLk((*LkIn)(req.inData), (*LkOut)(req.outData))
+}
+
+func doSetLk(server *Server, req *request) {
+	req.status = server.fileSystem.SetLk((*LkIn)(req.inData))
+}
+
+func doSetLkw(server *Server, req *request) {
+	req.status = server.fileSystem.SetLkw((*LkIn)(req.inData))
+}
+
+func doInterrupt(server *Server, req *request) {
+	input := (*InterruptIn)(req.inData)
+	if !server.interrupt(input.Unique) {
+		// The request may still be in transit in another
+		// reader; ask the kernel to resend the interrupt.
+		req.status = Status(syscall.EAGAIN)
+		return
+	}
+	req.status = OK
 }
 
 func doDestroy(server *Server, req *request) {
@@ -349,6 +477,17 @@ func doFallocate(server *Server, req *request) {
 	req.status = server.fileSystem.Fallocate((*FallocateIn)(req.inData))
 }
 
+func doLseek(server *Server, req *request) {
+	req.status = server.fileSystem.Lseek((*LseekIn)(req.inData), (*LseekOut)(req.outData))
+}
+
+func doCopyFileRange(server *Server, req *request) {
+	n, status := server.fileSystem.CopyFileRange((*CopyFileRangeIn)(req.inData))
+	o := (*WriteOut)(req.outData)
+	o.Size = n
+	req.status = status
+}
+
 ////////////////////////////////////////////////////////////////
 
 type operationFunc func(*Server, *request)
@@ -363,6 +502,10 @@ type operationHandler struct {
 	DecodeOut   castPointerFunc
 	FileNames   int
 	FileNameOut bool
+
+	// Set for requests that move file data, see
+	// MountOptions.MaxDataHandlers.
+	DataOp bool
 }
 
 var operationHandlers []*operationHandler
@@ -375,8 +518,12 @@ func operationName(op int32) string {
 	return h.Name
 }
 
+// unknownHandler stands in for opcodes outside the table, so they
+// can be answered with ENOSYS.
+var unknownHandler = &operationHandler{Name: "UNKNOWN"}
+
 func getHandler(o int32) *operationHandler {
-	if o >= _OPCODE_COUNT {
+	if o < 0 || o >= _OPCODE_COUNT {
 		return nil
 	}
 	return operationHandlers[o]
@@ -393,199 +540,251 @@ func init() {
 		operationHandlers[op].FileNameOut = true
 	}
 
+	dataOps := []int32{_OP_READ, _OP_WRITE, _OP_FLUSH, _OP_FSYNC,
+		_OP_FALLOCATE, _OP_LSEEK, _OP_COPY_FILE_RANGE}
+	for _, op := range dataOps {
+		operationHandlers[op].DataOp = true
+	}
+
 	for op, sz := range map[int32]uintptr{
-		_OP_FORGET:       unsafe.Sizeof(ForgetIn{}),
-		_OP_BATCH_FORGET: unsafe.Sizeof(_BatchForgetIn{}),
-		_OP_GETATTR:      unsafe.Sizeof(GetAttrIn{}),
-		_OP_SETATTR:      unsafe.Sizeof(SetAttrIn{}),
-		_OP_MKNOD:        unsafe.Sizeof(MknodIn{}),
-		_OP_MKDIR:        unsafe.Sizeof(MkdirIn{}),
-		_OP_RENAME:       unsafe.Sizeof(RenameIn{}),
-		_OP_LINK:         unsafe.Sizeof(LinkIn{}),
-		_OP_OPEN:         unsafe.Sizeof(OpenIn{}),
-		_OP_READ:         unsafe.Sizeof(ReadIn{}),
-		_OP_WRITE:        unsafe.Sizeof(WriteIn{}),
-		_OP_RELEASE:      unsafe.Sizeof(ReleaseIn{}),
-		_OP_FSYNC:        unsafe.Sizeof(FsyncIn{}),
-		_OP_SETXATTR:     unsafe.Sizeof(SetXAttrIn{}),
-		_OP_GETXATTR:     unsafe.Sizeof(GetXAttrIn{}),
-		_OP_LISTXATTR:    unsafe.Sizeof(GetXAttrIn{}),
-		_OP_FLUSH:        unsafe.Sizeof(FlushIn{}),
-		_OP_INIT:         unsafe.Sizeof(InitIn{}),
-		_OP_OPENDIR:      unsafe.Sizeof(OpenIn{}),
-		_OP_READDIR:      unsafe.Sizeof(ReadIn{}),
-		_OP_RELEASEDIR:   unsafe.Sizeof(ReleaseIn{}),
-		_OP_FSYNCDIR:     unsafe.Sizeof(FsyncIn{}),
-		_OP_ACCESS:       unsafe.Sizeof(AccessIn{}),
-		_OP_CREATE:       unsafe.Sizeof(CreateIn{}),
-		_OP_INTERRUPT:    unsafe.Sizeof(InterruptIn{}),
-		_OP_BMAP:         unsafe.Sizeof(_BmapIn{}),
-		_OP_IOCTL:        unsafe.Sizeof(_IoctlIn{}),
-		_OP_POLL:         unsafe.Sizeof(_PollIn{}),
-		_OP_FALLOCATE:    unsafe.Sizeof(FallocateIn{}),
-		_OP_READDIRPLUS:  unsafe.Sizeof(ReadIn{}),
+		_OP_FORGET:          unsafe.Sizeof(ForgetIn{}),
+		_OP_BATCH_FORGET:    unsafe.Sizeof(_BatchForgetIn{}),
+		_OP_GETATTR:         unsafe.Sizeof(GetAttrIn{}),
+		_OP_SETATTR:         unsafe.Sizeof(SetAttrIn{}),
+		_OP_MKNOD:           unsafe.Sizeof(MknodIn{}),
+		_OP_MKDIR:           unsafe.Sizeof(MkdirIn{}),
+		_OP_RENAME:          unsafe.Sizeof(_Rename1In{}),
+		_OP_RENAME2:         unsafe.Sizeof(RenameIn{}),
+		_OP_LINK:            unsafe.Sizeof(LinkIn{}),
+		_OP_OPEN:            unsafe.Sizeof(OpenIn{}),
+		_OP_READ:            unsafe.Sizeof(ReadIn{}),
+		_OP_WRITE:           unsafe.Sizeof(WriteIn{}),
+		_OP_RELEASE:         unsafe.Sizeof(ReleaseIn{}),
+		_OP_FSYNC:           unsafe.Sizeof(FsyncIn{}),
+		_OP_SETXATTR:        unsafe.Sizeof(SetXAttrIn{}),
+		_OP_GETXATTR:        unsafe.Sizeof(GetXAttrIn{}),
+		_OP_LISTXATTR:       unsafe.Sizeof(GetXAttrIn{}),
+		_OP_FLUSH:           unsafe.Sizeof(FlushIn{}),
+		_OP_INIT:            unsafe.Sizeof(InitIn{}),
+		_OP_OPENDIR:         unsafe.Sizeof(OpenIn{}),
+		_OP_READDIR:         unsafe.Sizeof(ReadIn{}),
+		_OP_RELEASEDIR:      unsafe.Sizeof(ReleaseIn{}),
+		_OP_FSYNCDIR:        unsafe.Sizeof(FsyncIn{}),
+		_OP_ACCESS:          unsafe.Sizeof(AccessIn{}),
+		_OP_CREATE:          unsafe.Sizeof(CreateIn{}),
+		_OP_INTERRUPT:       unsafe.Sizeof(InterruptIn{}),
+		_OP_BMAP:            unsafe.Sizeof(_BmapIn{}),
+		_OP_IOCTL:           unsafe.Sizeof(IoctlIn{}),
+		_OP_POLL:            unsafe.Sizeof(PollIn{}),
+		_OP_NOTIFY_REPLY:    unsafe.Sizeof(NotifyRetrieveIn{}),
+		_OP_FALLOCATE:       unsafe.Sizeof(FallocateIn{}),
+		_OP_READDIRPLUS:     unsafe.Sizeof(ReadIn{}),
+		_OP_LSEEK:           unsafe.Sizeof(LseekIn{}),
+		_OP_COPY_FILE_RANGE: unsafe.Sizeof(CopyFileRangeIn{}),
+		_OP_GETLK:           unsafe.Sizeof(LkIn{}),
+		_OP_SETLK:           unsafe.Sizeof(LkIn{}),
+		_OP_SETLKW:          unsafe.Sizeof(LkIn{}),
 	} {
 		operationHandlers[op].InputSize = sz
 	}
 
 	for op, sz := range map[int32]uintptr{
-		_OP_LOOKUP:        unsafe.Sizeof(EntryOut{}),
-		_OP_GETATTR:       unsafe.Sizeof(AttrOut{}),
-		_OP_SETATTR:       unsafe.Sizeof(AttrOut{}),
-		_OP_SYMLINK:       unsafe.Sizeof(EntryOut{}),
-		_OP_MKNOD:         unsafe.Sizeof(EntryOut{}),
-		_OP_MKDIR:         unsafe.Sizeof(EntryOut{}),
-		_OP_LINK:          unsafe.Sizeof(EntryOut{}),
-		_OP_OPEN:          unsafe.Sizeof(OpenOut{}),
-		_OP_WRITE:         unsafe.Sizeof(WriteOut{}),
-		_OP_STATFS:        unsafe.Sizeof(StatfsOut{}),
-		_OP_GETXATTR:      unsafe.Sizeof(GetXAttrOut{}),
-		_OP_LISTXATTR:     unsafe.Sizeof(GetXAttrOut{}),
-		_OP_INIT:          unsafe.Sizeof(InitOut{}),
-		_OP_OPENDIR:       unsafe.Sizeof(OpenOut{}),
-		_OP_CREATE:        unsafe.Sizeof(CreateOut{}),
-		_OP_BMAP:          unsafe.Sizeof(_BmapOut{}),
-		_OP_IOCTL:         unsafe.Sizeof(_IoctlOut{}),
-		_OP_POLL:          unsafe.Sizeof(_PollOut{}),
-		_OP_NOTIFY_ENTRY:  unsafe.Sizeof(NotifyInvalEntryOut{}),
-		_OP_NOTIFY_INODE:  unsafe.Sizeof(NotifyInvalInodeOut{}),
-		_OP_NOTIFY_DELETE: unsafe.Sizeof(NotifyInvalDeleteOut{}),
+		_OP_LOOKUP:          unsafe.Sizeof(EntryOut{}),
+		_OP_GETATTR:         unsafe.Sizeof(AttrOut{}),
+		_OP_SETATTR:         unsafe.Sizeof(AttrOut{}),
+		_OP_SYMLINK:         unsafe.Sizeof(EntryOut{}),
+		_OP_MKNOD:           unsafe.Sizeof(EntryOut{}),
+		_OP_MKDIR:           unsafe.Sizeof(EntryOut{}),
+		_OP_LINK:            unsafe.Sizeof(EntryOut{}),
+		_OP_OPEN:            unsafe.Sizeof(OpenOut{}),
+		_OP_WRITE:           unsafe.Sizeof(WriteOut{}),
+		_OP_STATFS:          unsafe.Sizeof(StatfsOut{}),
+		_OP_GETXATTR:        unsafe.Sizeof(GetXAttrOut{}),
+		_OP_LISTXATTR:       unsafe.Sizeof(GetXAttrOut{}),
+		_OP_INIT:            unsafe.Sizeof(InitOut{}),
+		_OP_OPENDIR:         unsafe.Sizeof(OpenOut{}),
+		_OP_CREATE:          unsafe.Sizeof(CreateOut{}),
+		_OP_BMAP:            unsafe.Sizeof(_BmapOut{}),
+		_OP_IOCTL:           unsafe.Sizeof(IoctlOut{}),
+		_OP_POLL:            unsafe.Sizeof(PollOut{}),
+		_OP_LSEEK:           unsafe.Sizeof(LseekOut{}),
+		_OP_COPY_FILE_RANGE: unsafe.Sizeof(WriteOut{}),
+		_OP_NOTIFY_ENTRY:    unsafe.Sizeof(NotifyInvalEntryOut{}),
+		_OP_NOTIFY_INODE:    unsafe.Sizeof(NotifyInvalInodeOut{}),
+		_OP_NOTIFY_DELETE:   unsafe.Sizeof(NotifyInvalDeleteOut{}),
+		_OP_NOTIFY_POLL:     unsafe.Sizeof(NotifyPollWakeupOut{}),
+		_OP_NOTIFY_STORE:    unsafe.Sizeof(NotifyStoreOut{}),
+		_OP_NOTIFY_RETRIEVE: unsafe.Sizeof(NotifyRetrieveOut{}),
+		_OP_GETLK:           unsafe.Sizeof(LkOut{}),
 	} {
 		operationHandlers[op].OutputSize = sz
 	}
 
 	for op, v := range map[int32]string{
-		_OP_LOOKUP:        "LOOKUP",
-		_OP_FORGET:        "FORGET",
-		_OP_BATCH_FORGET:  "BATCH_FORGET",
-		_OP_GETATTR:       "GETATTR",
-		_OP_SETATTR:       "SETATTR",
-		_OP_READLINK:      "READLINK",
-		_OP_SYMLINK:       "SYMLINK",
-		_OP_MKNOD:         "MKNOD",
-		_OP_MKDIR:         "MKDIR",
-		_OP_UNLINK:        "UNLINK",
-		_OP_RMDIR:         "RMDIR",
-		_OP_RENAME:        "RENAME",
-		_OP_LINK:          "LINK",
-		_OP_OPEN:          "OPEN",
-		_OP_READ:          "READ",
-		_OP_WRITE:         "WRITE",
-		_OP_STATFS:        "STATFS",
-		_OP_RELEASE:       "RELEASE",
-		_OP_FSYNC:         "FSYNC",
-		_OP_SETXATTR:      "SETXATTR",
-		_OP_GETXATTR:      "GETXATTR",
-		_OP_LISTXATTR:     "LISTXATTR",
-		_OP_REMOVEXATTR:   "REMOVEXATTR",
-		_OP_FLUSH:         "FLUSH",
-		_OP_INIT:          "INIT",
-		_OP_OPENDIR:       "OPENDIR",
-		_OP_READDIR:       "READDIR",
-		_OP_RELEASEDIR:    "RELEASEDIR",
-		_OP_FSYNCDIR:      "FSYNCDIR",
-		_OP_GETLK:         "GETLK",
-		_OP_SETLK:         "SETLK",
-		_OP_SETLKW:        "SETLKW",
-		_OP_ACCESS:        "ACCESS",
-		_OP_CREATE:        "CREATE",
-		_OP_INTERRUPT:     "INTERRUPT",
-		_OP_BMAP:          "BMAP",
-		_OP_DESTROY:       "DESTROY",
-		_OP_IOCTL:         "IOCTL",
-		_OP_POLL:          "POLL",
-		_OP_NOTIFY_ENTRY:  "NOTIFY_ENTRY",
-		_OP_NOTIFY_INODE:  "NOTIFY_INODE",
-		_OP_NOTIFY_DELETE: "NOTIFY_DELETE",
-		_OP_FALLOCATE:     "FALLOCATE",
-		_OP_READDIRPLUS:   "READDIRPLUS",
+		_OP_LOOKUP:          "LOOKUP",
+		_OP_FORGET:          "FORGET",
+		_OP_BATCH_FORGET:    "BATCH_FORGET",
+		_OP_GETATTR:         "GETATTR",
+		_OP_SETATTR:         "SETATTR",
+		_OP_READLINK:        "READLINK",
+		_OP_SYMLINK:         "SYMLINK",
+		_OP_MKNOD:           "MKNOD",
+		_OP_MKDIR:           "MKDIR",
+		_OP_UNLINK:          "UNLINK",
+		_OP_RMDIR:           "RMDIR",
+		_OP_RENAME:          "RENAME",
+		_OP_RENAME2:         "RENAME2",
+		_OP_LINK:            "LINK",
+		_OP_OPEN:            "OPEN",
+		_OP_READ:            "READ",
+		_OP_WRITE:           "WRITE",
+		_OP_STATFS:          "STATFS",
+		_OP_RELEASE:         "RELEASE",
+		_OP_FSYNC:           "FSYNC",
+		_OP_SETXATTR:        "SETXATTR",
+		_OP_GETXATTR:        "GETXATTR",
+		_OP_LISTXATTR:       "LISTXATTR",
+		_OP_REMOVEXATTR:     "REMOVEXATTR",
+		_OP_FLUSH:           "FLUSH",
+		_OP_INIT:            "INIT",
+		_OP_OPENDIR:         "OPENDIR",
+		_OP_READDIR:         "READDIR",
+		_OP_RELEASEDIR:      "RELEASEDIR",
+		_OP_FSYNCDIR:        "FSYNCDIR",
+		_OP_GETLK:           "GETLK",
+		_OP_SETLK:           "SETLK",
+		_OP_SETLKW:          "SETLKW",
+		_OP_ACCESS:          "ACCESS",
+		_OP_CREATE:          "CREATE",
+		_OP_INTERRUPT:       "INTERRUPT",
+		_OP_BMAP:            "BMAP",
+		_OP_DESTROY:         "DESTROY",
+		_OP_IOCTL:           "IOCTL",
+		_OP_POLL:            "POLL",
+		_OP_NOTIFY_ENTRY:    "NOTIFY_ENTRY",
+		_OP_NOTIFY_INODE:    "NOTIFY_INODE",
+		_OP_NOTIFY_DELETE:   "NOTIFY_DELETE",
+		_OP_NOTIFY_POLL:     "NOTIFY_POLL",
+		_OP_NOTIFY_STORE:    "NOTIFY_STORE",
+		_OP_NOTIFY_RETRIEVE: "NOTIFY_RETRIEVE",
+		_OP_NOTIFY_REPLY:    "NOTIFY_REPLY",
+		_OP_FALLOCATE:       "FALLOCATE",
+		_OP_READDIRPLUS:     "READDIRPLUS",
+		_OP_LSEEK:           "LSEEK",
+		_OP_COPY_FILE_RANGE: "COPY_FILE_RANGE",
 	} {
 		operationHandlers[op].Name = v
 	}
 
 	for op, v := range map[int32]operationFunc{
-		_OP_OPEN:         doOpen,
-		_OP_READDIR:      doReadDir,
-		_OP_WRITE:        doWrite,
-		_OP_OPENDIR:      doOpenDir,
-		_OP_CREATE:       doCreate,
-		_OP_SETATTR:      doSetattr,
-		_OP_GETXATTR:     doGetXAttr,
-		_OP_LISTXATTR:    doGetXAttr,
-		_OP_GETATTR:      doGetAttr,
-		_OP_FORGET:       doForget,
-		_OP_BATCH_FORGET: doBatchForget,
-		_OP_READLINK:     doReadlink,
-		_OP_INIT:         doInit,
-		_OP_LOOKUP:       doLookup,
-		_OP_MKNOD:        doMknod,
-		_OP_MKDIR:        doMkdir,
-		_OP_UNLINK:       doUnlink,
-		_OP_RMDIR:        doRmdir,
-		_OP_LINK:         doLink,
-		_OP_READ:         doRead,
-		_OP_FLUSH:        doFlush,
-		_OP_RELEASE:      doRelease,
-		_OP_FSYNC:        doFsync,
-		_OP_RELEASEDIR:   doReleaseDir,
-		_OP_FSYNCDIR:     doFsyncDir,
-		_OP_SETXATTR:     doSetXAttr,
-		_OP_REMOVEXATTR:  doRemoveXAttr,
-		_OP_ACCESS:       doAccess,
-		_OP_SYMLINK:      doSymlink,
-		_OP_RENAME:       doRename,
-		_OP_STATFS:       doStatFs,
-		_OP_IOCTL:        doIoctl,
-		_OP_DESTROY:      doDestroy,
-		_OP_FALLOCATE:    doFallocate,
-		_OP_READDIRPLUS:  doReadDirPlus,
+		_OP_OPEN:            doOpen,
+		_OP_READDIR:         doReadDir,
+		_OP_WRITE:           doWrite,
+		_OP_OPENDIR:         doOpenDir,
+		_OP_CREATE:          doCreate,
+		_OP_SETATTR:         doSetattr,
+		_OP_GETXATTR:        doGetXAttr,
+		_OP_LISTXATTR:       doGetXAttr,
+		_OP_GETATTR:         doGetAttr,
+		_OP_FORGET:          doForget,
+		_OP_BATCH_FORGET:    doBatchForget,
+		_OP_READLINK:        doReadlink,
+		_OP_INIT:            doInit,
+		_OP_LOOKUP:          doLookup,
+		_OP_MKNOD:           doMknod,
+		_OP_MKDIR:           doMkdir,
+		_OP_UNLINK:          doUnlink,
+		_OP_RMDIR:           doRmdir,
+		_OP_LINK:            doLink,
+		_OP_READ:            doRead,
+		_OP_FLUSH:           doFlush,
+		_OP_RELEASE:         doRelease,
+		_OP_FSYNC:           doFsync,
+		_OP_RELEASEDIR:      doReleaseDir,
+		_OP_FSYNCDIR:        doFsyncDir,
+		_OP_SETXATTR:        doSetXAttr,
+		_OP_REMOVEXATTR:     doRemoveXAttr,
+		_OP_ACCESS:          doAccess,
+		_OP_SYMLINK:         doSymlink,
+		_OP_RENAME:          doRename,
+		_OP_RENAME2:         doRename,
+		_OP_STATFS:          doStatFs,
+		_OP_IOCTL:           doIoctl,
+		_OP_POLL:            doPoll,
+		_OP_NOTIFY_REPLY:    doNotifyReply,
+		_OP_DESTROY:         doDestroy,
+		_OP_FALLOCATE:       doFallocate,
+		_OP_READDIRPLUS:     doReadDirPlus,
+		_OP_LSEEK:           doLseek,
+		_OP_COPY_FILE_RANGE: doCopyFileRange,
+		_OP_GETLK:           doGetLk,
+		_OP_SETLK:           doSetLk,
+		_OP_SETLKW:          doSetLkw,
+		_OP_INTERRUPT:       doInterrupt,
 	} {
 		operationHandlers[op].Func = v
 	}
 
 	// Outputs.
 	for op, f := range map[int32]castPointerFunc{
-		_OP_LOOKUP:        func(ptr unsafe.Pointer) interface{} { return (*EntryOut)(ptr) },
-		_OP_OPEN:          func(ptr unsafe.Pointer) interface{} { return (*OpenOut)(ptr) },
-		_OP_OPENDIR:       func(ptr unsafe.Pointer) interface{} { return (*OpenOut)(ptr) },
-		_OP_GETATTR:       func(ptr unsafe.Pointer) interface{} { return (*AttrOut)(ptr) },
-		_OP_CREATE:        func(ptr unsafe.Pointer) interface{} { return (*CreateOut)(ptr) },
-		_OP_LINK:          func(ptr unsafe.Pointer) interface{} { return (*EntryOut)(ptr) },
-		_OP_SETATTR:       func(ptr unsafe.Pointer) interface{} { return (*AttrOut)(ptr) },
-		_OP_INIT:          func(ptr unsafe.Pointer) interface{} { return (*InitOut)(ptr) },
-		_OP_MKDIR:         func(ptr unsafe.Pointer) interface{} { return (*EntryOut)(ptr) },
-		_OP_NOTIFY_ENTRY:  func(ptr unsafe.Pointer) interface{} { return (*NotifyInvalEntryOut)(ptr) },
-		_OP_NOTIFY_INODE:  func(ptr unsafe.Pointer) interface{} { return (*NotifyInvalInodeOut)(ptr) },
-		_OP_NOTIFY_DELETE: func(ptr unsafe.Pointer) interface{} { return (*NotifyInvalDeleteOut)(ptr) },
-		_OP_STATFS:        func(ptr unsafe.Pointer) interface{} { return (*StatfsOut)(ptr) },
+		_OP_LOOKUP:          func(ptr unsafe.Pointer) interface{} { return (*EntryOut)(ptr) },
+		_OP_OPEN:            func(ptr unsafe.Pointer) interface{} { return (*OpenOut)(ptr) },
+		_OP_OPENDIR:         func(ptr unsafe.Pointer) interface{} { return (*OpenOut)(ptr) },
+		_OP_GETATTR:         func(ptr unsafe.Pointer) interface{} { return (*AttrOut)(ptr) },
+		_OP_CREATE:          func(ptr unsafe.Pointer) interface{} { return (*CreateOut)(ptr) },
+		_OP_LINK:            func(ptr unsafe.Pointer) interface{} { return (*EntryOut)(ptr) },
+		_OP_SETATTR:         func(ptr unsafe.Pointer) interface{} { return (*AttrOut)(ptr) },
+		_OP_INIT:            func(ptr unsafe.Pointer) interface{} { return (*InitOut)(ptr) },
+		_OP_MKDIR:           func(ptr unsafe.Pointer) interface{} { return (*EntryOut)(ptr) },
+		_OP_NOTIFY_ENTRY:    func(ptr unsafe.Pointer) interface{} { return (*NotifyInvalEntryOut)(ptr) },
+		_OP_NOTIFY_INODE:    func(ptr unsafe.Pointer) interface{} { return (*NotifyInvalInodeOut)(ptr) },
+		_OP_NOTIFY_DELETE:   func(ptr unsafe.Pointer) interface{} { return (*NotifyInvalDeleteOut)(ptr) },
+		_OP_NOTIFY_POLL:     func(ptr unsafe.Pointer) interface{} { return (*NotifyPollWakeupOut)(ptr) },
+		_OP_NOTIFY_STORE:    func(ptr unsafe.Pointer) interface{} { return (*NotifyStoreOut)(ptr) },
+		_OP_NOTIFY_RETRIEVE: func(ptr unsafe.Pointer) interface{} { return (*NotifyRetrieveOut)(ptr) },
+		_OP_POLL:            func(ptr unsafe.Pointer) interface{} { return (*PollOut)(ptr) },
+		_OP_STATFS:          func(ptr unsafe.Pointer) interface{} { return (*StatfsOut)(ptr) },
+		_OP_GETLK:           func(ptr unsafe.Pointer) interface{} { return (*LkOut)(ptr) },
+		_OP_IOCTL:           func(ptr unsafe.Pointer) interface{} { return (*IoctlOut)(ptr) },
+		_OP_LSEEK:           func(ptr unsafe.Pointer) interface{} { return (*LseekOut)(ptr) },
+		_OP_COPY_FILE_RANGE: func(ptr unsafe.Pointer) interface{} { return (*WriteOut)(ptr) },
 	} {
 		operationHandlers[op].DecodeOut = f
 	}
 
 	// Inputs.
 	for op, f := range map[int32]castPointerFunc{
-		_OP_FLUSH:        func(ptr unsafe.Pointer) interface{} { return (*FlushIn)(ptr) },
-		_OP_GETATTR:      func(ptr unsafe.Pointer) interface{} { return (*GetAttrIn)(ptr) },
-		_OP_GETXATTR:     func(ptr unsafe.Pointer) interface{} { return (*GetXAttrIn)(ptr) },
-		_OP_LISTXATTR:    func(ptr unsafe.Pointer) interface{} { return (*GetXAttrIn)(ptr) },
-		_OP_SETATTR:      func(ptr unsafe.Pointer) interface{} { return (*SetAttrIn)(ptr) },
-		_OP_INIT:         func(ptr unsafe.Pointer) interface{} { return (*InitIn)(ptr) },
-		_OP_IOCTL:        func(ptr unsafe.Pointer) interface{} { return (*_IoctlIn)(ptr) },
-		_OP_OPEN:         func(ptr unsafe.Pointer) interface{} { return (*OpenIn)(ptr) },
-		_OP_MKNOD:        func(ptr unsafe.Pointer) interface{} { return (*MknodIn)(ptr) },
-		_OP_CREATE:       func(ptr unsafe.Pointer) interface{} { return (*CreateIn)(ptr) },
-		_OP_READ:         func(ptr unsafe.Pointer) interface{} { return (*ReadIn)(ptr) },
-		_OP_READDIR:      func(ptr unsafe.Pointer) interface{} { return (*ReadIn)(ptr) },
-		_OP_ACCESS:       func(ptr unsafe.Pointer) interface{} { return (*AccessIn)(ptr) },
-		_OP_FORGET:       func(ptr unsafe.Pointer) interface{} { return (*ForgetIn)(ptr) },
-		_OP_BATCH_FORGET: func(ptr unsafe.Pointer) interface{} { return (*_BatchForgetIn)(ptr) },
-		_OP_LINK:         func(ptr unsafe.Pointer) interface{} { return (*LinkIn)(ptr) },
-		_OP_MKDIR:        func(ptr unsafe.Pointer) interface{} { return (*MkdirIn)(ptr) },
-		_OP_RELEASE:      func(ptr unsafe.Pointer) interface{} { return (*ReleaseIn)(ptr) },
-		_OP_RELEASEDIR:   func(ptr unsafe.Pointer) interface{} { return (*ReleaseIn)(ptr) },
-		_OP_FALLOCATE:    func(ptr unsafe.Pointer) interface{} { return (*FallocateIn)(ptr) },
-		_OP_READDIRPLUS:  func(ptr unsafe.Pointer) interface{} { return (*ReadIn)(ptr) },
-		_OP_RENAME:       func(ptr unsafe.Pointer) interface{} { return (*RenameIn)(ptr) },
+		_OP_FLUSH:           func(ptr unsafe.Pointer) interface{} { return (*FlushIn)(ptr) },
+		_OP_GETATTR:         func(ptr unsafe.Pointer) interface{} { return (*GetAttrIn)(ptr) },
+		_OP_GETXATTR:        func(ptr unsafe.Pointer) interface{} { return (*GetXAttrIn)(ptr) },
+		_OP_LISTXATTR:       func(ptr unsafe.Pointer) interface{} { return (*GetXAttrIn)(ptr) },
+		_OP_SETATTR:         func(ptr unsafe.Pointer) interface{} { return (*SetAttrIn)(ptr) },
+		_OP_INIT:            func(ptr unsafe.Pointer) interface{} { return (*InitIn)(ptr) },
+		_OP_IOCTL:           func(ptr unsafe.Pointer) interface{} { return (*IoctlIn)(ptr) },
+		_OP_POLL:            func(ptr unsafe.Pointer) interface{} { return (*PollIn)(ptr) },
+		_OP_NOTIFY_REPLY:    func(ptr unsafe.Pointer) interface{} { return (*NotifyRetrieveIn)(ptr) },
+		_OP_OPEN:            func(ptr unsafe.Pointer) interface{} { return (*OpenIn)(ptr) },
+		_OP_MKNOD:           func(ptr unsafe.Pointer) interface{} { return (*MknodIn)(ptr) },
+		_OP_CREATE:          func(ptr unsafe.Pointer) interface{} { return (*CreateIn)(ptr) },
+		_OP_READ:            func(ptr unsafe.Pointer) interface{} { return (*ReadIn)(ptr) },
+		_OP_READDIR:         func(ptr unsafe.Pointer) interface{} { return (*ReadIn)(ptr) },
+		_OP_ACCESS:          func(ptr unsafe.Pointer) interface{} { return (*AccessIn)(ptr) },
+		_OP_FORGET:          func(ptr unsafe.Pointer) interface{} { return (*ForgetIn)(ptr) },
+		_OP_BATCH_FORGET:    func(ptr unsafe.Pointer) interface{} { return (*_BatchForgetIn)(ptr) },
+		_OP_LINK:            func(ptr unsafe.Pointer) interface{} { return (*LinkIn)(ptr) },
+		_OP_MKDIR:           func(ptr unsafe.Pointer) interface{} { return (*MkdirIn)(ptr) },
+		_OP_RELEASE:         func(ptr unsafe.Pointer) interface{} { return (*ReleaseIn)(ptr) },
+		_OP_RELEASEDIR:      func(ptr unsafe.Pointer) interface{} { return (*ReleaseIn)(ptr) },
+		_OP_FALLOCATE:       func(ptr unsafe.Pointer) interface{} { return (*FallocateIn)(ptr) },
+		_OP_READDIRPLUS:     func(ptr unsafe.Pointer) interface{} { return (*ReadIn)(ptr) },
+		_OP_LSEEK:           func(ptr unsafe.Pointer) interface{} { return (*LseekIn)(ptr) },
+		_OP_COPY_FILE_RANGE: func(ptr unsafe.Pointer) interface{} { return (*CopyFileRangeIn)(ptr) },
+		_OP_RENAME:          func(ptr unsafe.Pointer) interface{} { return (*RenameIn)(ptr) },
+		_OP_RENAME2:         func(ptr unsafe.Pointer) interface{} { return (*RenameIn)(ptr) },
+		_OP_GETLK:           func(ptr unsafe.Pointer) interface{} { return (*LkIn)(ptr) },
+		_OP_SETLK:           func(ptr unsafe.Pointer) interface{} { return (*LkIn)(ptr) },
+		_OP_SETLKW:          func(ptr unsafe.Pointer) interface{} { return (*LkIn)(ptr) },
+		_OP_INTERRUPT:       func(ptr unsafe.Pointer) interface{} { return (*InterruptIn)(ptr) },
 	} {
 		operationHandlers[op].DecodeIn = f
 	}
@@ -600,6 +799,7 @@ func init() {
 		_OP_MKNOD:       1,
 		_OP_REMOVEXATTR: 1,
 		_OP_RENAME:      2,
+		_OP_RENAME2:     2,
 		_OP_RMDIR:       1,
 		_OP_SYMLINK:     2,
 		_OP_UNLINK:      1,
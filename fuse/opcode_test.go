@@ -0,0 +1,70 @@
+package fuse
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func initRequest(minor uint32, flags uint32) *request {
+	req := &request{}
+	req.setInput(make([]byte, unsafe.Sizeof(InitIn{})))
+	in := (*InitIn)(unsafe.Pointer(&req.inputBuf[0]))
+	in.Length = uint32(len(req.inputBuf))
+	in.Opcode = _OP_INIT
+	in.Major = _FUSE_KERNEL_VERSION
+	in.Minor = minor
+	in.Flags = flags
+	req.parse()
+	return req
+}
+
+func TestInitNegotiation(t *testing.T) {
+	ms := &Server{
+		opts: &MountOptions{
+			MaxWrite:             MAX_KERNEL_WRITE_MAX_PAGES,
+			EnableParallelDirOps: true,
+			EnableSymlinkCache:   true,
+		},
+	}
+	all := uint32(CAP_ASYNC_READ | CAP_PARALLEL_DIROPS | CAP_CACHE_SYMLINKS |
+		CAP_MAX_PAGES | CAP_WRITEBACK_CACHE)
+
+	req := initRequest(28, all)
+	doInit(ms, req)
+	out := (*InitOut)(req.outData)
+	if want := uint32(CAP_ASYNC_READ | CAP_PARALLEL_DIROPS | CAP_CACHE_SYMLINKS | CAP_MAX_PAGES); out.Flags != want {
+		t.Errorf("got flags %s, want %s", FlagString(initFlagNames, int64(out.Flags), ""),
+			FlagString(initFlagNames, int64(want), ""))
+	}
+	if out.MaxWrite != MAX_KERNEL_WRITE_MAX_PAGES || out.MaxPages != MAX_KERNEL_WRITE_MAX_PAGES/PAGESIZE {
+		t.Errorf("got MaxWrite %d MaxPages %d", out.MaxWrite, out.MaxPages)
+	}
+	if got, want := len(req.serializeHeader(0)), int(sizeOfOutHeader+unsafe.Sizeof(InitOut{})); got != want {
+		t.Errorf("got reply size %d, want %d", got, want)
+	}
+
+	// A repeated INIT is refused.
+	req = initRequest(28, all)
+	doInit(ms, req)
+	if req.status != EINVAL {
+		t.Errorf("repeated INIT: got %v, want EINVAL", req.status)
+	}
+
+	// A kernel that does not know about the new capabilities.
+	ms.kernelSettings = InitIn{}
+	req = initRequest(21, CAP_ASYNC_READ)
+	doInit(ms, req)
+	out = (*InitOut)(req.outData)
+	if out.Minor != 21 || out.Flags != CAP_ASYNC_READ {
+		t.Errorf("got minor %d flags %s", out.Minor, FlagString(initFlagNames, int64(out.Flags), ""))
+	}
+	if out.MaxWrite != MAX_KERNEL_WRITE || out.MaxPages != 0 {
+		t.Errorf("got MaxWrite %d MaxPages %d", out.MaxWrite, out.MaxPages)
+	}
+	if ms.opts.MaxWrite != MAX_KERNEL_WRITE || ms.readBufSize != MAX_KERNEL_WRITE+PAGESIZE {
+		t.Errorf("got MaxWrite option %d, read buffers of %d bytes", ms.opts.MaxWrite, ms.readBufSize)
+	}
+	if got, want := len(req.serializeHeader(0)), int(sizeOfOutHeader)+_COMPAT_22_INIT_OUT_SIZE; got != want {
+		t.Errorf("got reply size %d, want %d", got, want)
+	}
+}
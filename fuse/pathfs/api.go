@@ -42,7 +42,11 @@ type FileSystem interface {
 	Link(oldName string, newName string, context *fuse.Context) (code fuse.Status)
 	Mkdir(name string, mode uint32, context *fuse.Context) fuse.Status
 	Mknod(name string, mode uint32, dev uint32, context *fuse.Context) fuse.Status
-	Rename(oldName string, newName string, context *fuse.Context) (code fuse.Status)
+
+	// Rename takes renameat2(2) flags, ie. a combination of
+	// fuse.RENAME_NOREPLACE and fuse.RENAME_EXCHANGE. Return
+	// EINVAL, not ENOSYS, for flags that are not supported.
+	Rename(oldName string, newName string, flags uint32, context *fuse.Context) (code fuse.Status)
 	Rmdir(name string, context *fuse.Context) (code fuse.Status)
 	Unlink(name string, context *fuse.Context) (code fuse.Status)
 
@@ -61,6 +65,19 @@ type FileSystem interface {
 	Open(name string, flags uint32, context *fuse.Context) (file nodefs.File, code fuse.Status)
 	Create(name string, flags uint32, mode uint32, context *fuse.Context) (file nodefs.File, code fuse.Status)
 
+	// Lseek and CopyFileRange are only called if the
+	// nodefs.File returned from Open or Create does not implement
+	// them (ie. returns ENOSYS).
+	Lseek(name string, off uint64, whence uint32, context *fuse.Context) (uint64, fuse.Status)
+	CopyFileRange(nameIn string, offIn uint64, nameOut string, offOut uint64, size uint64, flags uint64, context *fuse.Context) (written uint32, code fuse.Status)
+
+	// File locking, only called if the mount enables locks, and
+	// the nodefs.File returned from Open or Create does not
+	// implement locking itself (ie. returns ENOSYS).
+	GetLk(name string, owner uint64, lk *fuse.FileLock, flags uint32, out *fuse.FileLock, context *fuse.Context) (code fuse.Status)
+	SetLk(name string, owner uint64, lk *fuse.FileLock, flags uint32, context *fuse.Context) (code fuse.Status)
+	SetLkw(name string, owner uint64, lk *fuse.FileLock, flags uint32, context *fuse.Context) (code fuse.Status)
+
 	// Directory handling
 	OpenDir(name string, context *fuse.Context) (stream []fuse.DirEntry, code fuse.Status)
 
@@ -63,7 +63,7 @@ func (fs *defaultFileSystem) Symlink(value string, linkName string, context *fus
 	return fuse.ENOSYS
 }
 
-func (fs *defaultFileSystem) Rename(oldName string, newName string, context *fuse.Context) (code fuse.Status) {
+func (fs *defaultFileSystem) Rename(oldName string, newName string, flags uint32, context *fuse.Context) (code fuse.Status) {
 	return fuse.ENOSYS
 }
 
@@ -109,6 +109,26 @@ func (fs *defaultFileSystem) Utimens(name string, Atime *time.Time, Mtime *time.
 	return fuse.ENOSYS
 }
 
+func (fs *defaultFileSystem) Lseek(name string, off uint64, whence uint32, context *fuse.Context) (uint64, fuse.Status) {
+	return 0, fuse.ENOSYS
+}
+
+func (fs *defaultFileSystem) CopyFileRange(nameIn string, offIn uint64, nameOut string, offOut uint64, size uint64, flags uint64, context *fuse.Context) (uint32, fuse.Status) {
+	return 0, fuse.ENOSYS
+}
+
+func (fs *defaultFileSystem) GetLk(name string, owner uint64, lk *fuse.FileLock, flags uint32, out *fuse.FileLock, context *fuse.Context) (code fuse.Status) {
+	return fuse.ENOSYS
+}
+
+func (fs *defaultFileSystem) SetLk(name string, owner uint64, lk *fuse.FileLock, flags uint32, context *fuse.Context) (code fuse.Status) {
+	return fuse.ENOSYS
+}
+
+func (fs *defaultFileSystem) SetLkw(name string, owner uint64, lk *fuse.FileLock, flags uint32, context *fuse.Context) (code fuse.Status) {
+	return fuse.ENOSYS
+}
+
 func (fs *defaultFileSystem) String() string {
 	return "defaultFileSystem"
 }
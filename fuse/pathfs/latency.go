@@ -0,0 +1,187 @@
+package pathfs
+
+import (
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+)
+
+// LatencyMap records latencies per operation and path, eg.
+// benchmark.LatencyMap.
+type LatencyMap interface {
+	AddPath(name, path string, dt time.Duration)
+}
+
+type latencyFileSystem struct {
+	// Should be public so people reusing can access the wrapped
+	// FS.
+	FS        FileSystem
+	latencies LatencyMap
+}
+
+// NewLatencyFileSystem is a wrapper that records the latency of each
+// operation, under the name of the FileSystem method and the path it
+// was called for. Operations on open files are not recorded.
+func NewLatencyFileSystem(pfs FileSystem, latencies LatencyMap) FileSystem {
+	return &latencyFileSystem{
+		FS:        pfs,
+		latencies: latencies,
+	}
+}
+
+func (fs *latencyFileSystem) timed(name, path string) func() {
+	start := time.Now()
+	return func() { fs.latencies.AddPath(name, path, time.Now().Sub(start)) }
+}
+
+func (fs *latencyFileSystem) String() string {
+	return fs.FS.String()
+}
+
+func (fs *latencyFileSystem) SetDebug(debug bool) {
+	fs.FS.SetDebug(debug)
+}
+
+func (fs *latencyFileSystem) StatFs(name string) *fuse.StatfsOut {
+	defer fs.timed("StatFs", name)()
+	return fs.FS.StatFs(name)
+}
+
+func (fs *latencyFileSystem) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse.Status) {
+	defer fs.timed("GetAttr", name)()
+	return fs.FS.GetAttr(name, context)
+}
+
+func (fs *latencyFileSystem) Readlink(name string, context *fuse.Context) (string, fuse.Status) {
+	defer fs.timed("Readlink", name)()
+	return fs.FS.Readlink(name, context)
+}
+
+func (fs *latencyFileSystem) Mknod(name string, mode uint32, dev uint32, context *fuse.Context) fuse.Status {
+	defer fs.timed("Mknod", name)()
+	return fs.FS.Mknod(name, mode, dev, context)
+}
+
+func (fs *latencyFileSystem) Mkdir(name string, mode uint32, context *fuse.Context) fuse.Status {
+	defer fs.timed("Mkdir", name)()
+	return fs.FS.Mkdir(name, mode, context)
+}
+
+func (fs *latencyFileSystem) Unlink(name string, context *fuse.Context) (code fuse.Status) {
+	defer fs.timed("Unlink", name)()
+	return fs.FS.Unlink(name, context)
+}
+
+func (fs *latencyFileSystem) Rmdir(name string, context *fuse.Context) (code fuse.Status) {
+	defer fs.timed("Rmdir", name)()
+	return fs.FS.Rmdir(name, context)
+}
+
+func (fs *latencyFileSystem) Symlink(value string, linkName string, context *fuse.Context) (code fuse.Status) {
+	defer fs.timed("Symlink", linkName)()
+	return fs.FS.Symlink(value, linkName, context)
+}
+
+func (fs *latencyFileSystem) Rename(oldName string, newName string, flags uint32, context *fuse.Context) (code fuse.Status) {
+	defer fs.timed("Rename", oldName)()
+	return fs.FS.Rename(oldName, newName, flags, context)
+}
+
+func (fs *latencyFileSystem) Link(oldName string, newName string, context *fuse.Context) (code fuse.Status) {
+	defer fs.timed("Link", oldName)()
+	return fs.FS.Link(oldName, newName, context)
+}
+
+func (fs *latencyFileSystem) Chmod(name string, mode uint32, context *fuse.Context) (code fuse.Status) {
+	defer fs.timed("Chmod", name)()
+	return fs.FS.Chmod(name, mode, context)
+}
+
+func (fs *latencyFileSystem) Chown(name string, uid uint32, gid uint32, context *fuse.Context) (code fuse.Status) {
+	defer fs.timed("Chown", name)()
+	return fs.FS.Chown(name, uid, gid, context)
+}
+
+func (fs *latencyFileSystem) Truncate(name string, offset uint64, context *fuse.Context) (code fuse.Status) {
+	defer fs.timed("Truncate", name)()
+	return fs.FS.Truncate(name, offset, context)
+}
+
+func (fs *latencyFileSystem) Open(name string, flags uint32, context *fuse.Context) (file nodefs.File, code fuse.Status) {
+	defer fs.timed("Open", name)()
+	return fs.FS.Open(name, flags, context)
+}
+
+func (fs *latencyFileSystem) OpenDir(name string, context *fuse.Context) (stream []fuse.DirEntry, status fuse.Status) {
+	defer fs.timed("OpenDir", name)()
+	return fs.FS.OpenDir(name, context)
+}
+
+func (fs *latencyFileSystem) OnMount(nodeFs *PathNodeFs) {
+	fs.FS.OnMount(nodeFs)
+}
+
+func (fs *latencyFileSystem) OnUnmount() {
+	fs.FS.OnUnmount()
+}
+
+func (fs *latencyFileSystem) Access(name string, mode uint32, context *fuse.Context) (code fuse.Status) {
+	defer fs.timed("Access", name)()
+	return fs.FS.Access(name, mode, context)
+}
+
+func (fs *latencyFileSystem) Create(name string, flags uint32, mode uint32, context *fuse.Context) (file nodefs.File, code fuse.Status) {
+	defer fs.timed("Create", name)()
+	return fs.FS.Create(name, flags, mode, context)
+}
+
+func (fs *latencyFileSystem) Utimens(name string, Atime *time.Time, Mtime *time.Time, context *fuse.Context) (code fuse.Status) {
+	defer fs.timed("Utimens", name)()
+	return fs.FS.Utimens(name, Atime, Mtime, context)
+}
+
+func (fs *latencyFileSystem) GetXAttr(name string, attr string, context *fuse.Context) ([]byte, fuse.Status) {
+	defer fs.timed("GetXAttr", name)()
+	return fs.FS.GetXAttr(name, attr, context)
+}
+
+func (fs *latencyFileSystem) SetXAttr(name string, attr string, data []byte, flags int, context *fuse.Context) fuse.Status {
+	defer fs.timed("SetXAttr", name)()
+	return fs.FS.SetXAttr(name, attr, data, flags, context)
+}
+
+func (fs *latencyFileSystem) ListXAttr(name string, context *fuse.Context) ([]string, fuse.Status) {
+	defer fs.timed("ListXAttr", name)()
+	return fs.FS.ListXAttr(name, context)
+}
+
+func (fs *latencyFileSystem) RemoveXAttr(name string, attr string, context *fuse.Context) fuse.Status {
+	defer fs.timed("RemoveXAttr", name)()
+	return fs.FS.RemoveXAttr(name, attr, context)
+}
+
+func (fs *latencyFileSystem) Lseek(name string, off uint64, whence uint32, context *fuse.Context) (uint64, fuse.Status) {
+	defer fs.timed("Lseek", name)()
+	return fs.FS.Lseek(name, off, whence, context)
+}
+
+func (fs *latencyFileSystem) CopyFileRange(nameIn string, offIn uint64, nameOut string, offOut uint64, size uint64, flags uint64, context *fuse.Context) (uint32, fuse.Status) {
+	defer fs.timed("CopyFileRange", nameIn)()
+	return fs.FS.CopyFileRange(nameIn, offIn, nameOut, offOut, size, flags, context)
+}
+
+func (fs *latencyFileSystem) GetLk(name string, owner uint64, lk *fuse.FileLock, flags uint32, out *fuse.FileLock, context *fuse.Context) (code fuse.Status) {
+	defer fs.timed("GetLk", name)()
+	return fs.FS.GetLk(name, owner, lk, flags, out, context)
+}
+
+func (fs *latencyFileSystem) SetLk(name string, owner uint64, lk *fuse.FileLock, flags uint32, context *fuse.Context) (code fuse.Status) {
+	defer fs.timed("SetLk", name)()
+	return fs.FS.SetLk(name, owner, lk, flags, context)
+}
+
+func (fs *latencyFileSystem) SetLkw(name string, owner uint64, lk *fuse.FileLock, flags uint32, context *fuse.Context) (code fuse.Status) {
+	defer fs.timed("SetLkw", name)()
+	return fs.FS.SetLkw(name, owner, lk, flags, context)
+}
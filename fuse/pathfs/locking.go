@@ -78,9 +78,9 @@ func (fs *lockingFileSystem) Symlink(value string, linkName string, context *fus
 	return fs.FS.Symlink(value, linkName, context)
 }
 
-func (fs *lockingFileSystem) Rename(oldName string, newName string, context *fuse.Context) (code fuse.Status) {
+func (fs *lockingFileSystem) Rename(oldName string, newName string, flags uint32, context *fuse.Context) (code fuse.Status) {
 	defer fs.locked()()
-	return fs.FS.Rename(oldName, newName, context)
+	return fs.FS.Rename(oldName, newName, flags, context)
 }
 
 func (fs *lockingFileSystem) Link(oldName string, newName string, context *fuse.Context) (code fuse.Status) {
@@ -161,3 +161,29 @@ func (fs *lockingFileSystem) RemoveXAttr(name string, attr string, context *fuse
 	defer fs.locked()()
 	return fs.FS.RemoveXAttr(name, attr, context)
 }
+
+func (fs *lockingFileSystem) Lseek(name string, off uint64, whence uint32, context *fuse.Context) (uint64, fuse.Status) {
+	defer fs.locked()()
+	return fs.FS.Lseek(name, off, whence, context)
+}
+
+func (fs *lockingFileSystem) CopyFileRange(nameIn string, offIn uint64, nameOut string, offOut uint64, size uint64, flags uint64, context *fuse.Context) (uint32, fuse.Status) {
+	defer fs.locked()()
+	return fs.FS.CopyFileRange(nameIn, offIn, nameOut, offOut, size, flags, context)
+}
+
+func (fs *lockingFileSystem) GetLk(name string, owner uint64, lk *fuse.FileLock, flags uint32, out *fuse.FileLock, context *fuse.Context) (code fuse.Status) {
+	defer fs.locked()()
+	return fs.FS.GetLk(name, owner, lk, flags, out, context)
+}
+
+func (fs *lockingFileSystem) SetLk(name string, owner uint64, lk *fuse.FileLock, flags uint32, context *fuse.Context) (code fuse.Status) {
+	defer fs.locked()()
+	return fs.FS.SetLk(name, owner, lk, flags, context)
+}
+
+// SetLkw is not serialized, since it may wait for a lock release
+// that has to go through this file system too.
+func (fs *lockingFileSystem) SetLkw(name string, owner uint64, lk *fuse.FileLock, flags uint32, context *fuse.Context) (code fuse.Status) {
+	return fs.FS.SetLkw(name, owner, lk, flags, context)
+}
@@ -6,7 +6,6 @@ import (
 	"os"
 	"path/filepath"
 	"syscall"
-	"time"
 
 	"github.com/hanwen/go-fuse/fuse"
 	"github.com/hanwen/go-fuse/fuse/nodefs"
@@ -118,18 +117,6 @@ func (fs *loopbackFileSystem) Truncate(path string, offset uint64, context *fuse
 	return fuse.ToStatus(os.Truncate(fs.GetPath(path), int64(offset)))
 }
 
-func (fs *loopbackFileSystem) Utimens(path string, Atime *time.Time, Mtime *time.Time, context *fuse.Context) (code fuse.Status) {
-	var a time.Time
-	if Atime != nil {
-		a = *Atime
-	}
-	var m time.Time
-	if Mtime != nil {
-		m = *Mtime
-	}
-	return fuse.ToStatus(os.Chtimes(fs.GetPath(path), a, m))
-}
-
 func (fs *loopbackFileSystem) Readlink(name string, context *fuse.Context) (out string, code fuse.Status) {
 	f, err := os.Readlink(fs.GetPath(name))
 	return f, fuse.ToStatus(err)
@@ -156,15 +143,37 @@ func (fs *loopbackFileSystem) Symlink(pointedTo string, linkName string, context
 	return fuse.ToStatus(os.Symlink(pointedTo, fs.GetPath(linkName)))
 }
 
-func (fs *loopbackFileSystem) Rename(oldPath string, newPath string, context *fuse.Context) (codee fuse.Status) {
-	err := os.Rename(fs.GetPath(oldPath), fs.GetPath(newPath))
-	return fuse.ToStatus(err)
-}
-
 func (fs *loopbackFileSystem) Link(orig string, newName string, context *fuse.Context) (code fuse.Status) {
 	return fuse.ToStatus(os.Link(fs.GetPath(orig), fs.GetPath(newName)))
 }
 
+func (fs *loopbackFileSystem) Lseek(name string, off uint64, whence uint32, context *fuse.Context) (uint64, fuse.Status) {
+	f, err := os.Open(fs.GetPath(name))
+	if err != nil {
+		return 0, fuse.ToStatus(err)
+	}
+	lf := nodefs.NewLoopbackFile(f)
+	defer lf.Release()
+	return lf.Lseek(off, whence)
+}
+
+func (fs *loopbackFileSystem) CopyFileRange(nameIn string, offIn uint64, nameOut string, offOut uint64, size uint64, flags uint64, context *fuse.Context) (uint32, fuse.Status) {
+	in, err := os.Open(fs.GetPath(nameIn))
+	if err != nil {
+		return 0, fuse.ToStatus(err)
+	}
+	lin := nodefs.NewLoopbackFile(in)
+	defer lin.Release()
+
+	out, err := os.OpenFile(fs.GetPath(nameOut), os.O_WRONLY, 0)
+	if err != nil {
+		return 0, fuse.ToStatus(err)
+	}
+	lout := nodefs.NewLoopbackFile(out)
+	defer lout.Release()
+	return lin.CopyFileRange(offIn, lout, offOut, size, flags)
+}
+
 func (fs *loopbackFileSystem) Access(name string, mode uint32, context *fuse.Context) (code fuse.Status) {
 	return fuse.ToStatus(syscall.Access(fs.GetPath(name), mode))
 }
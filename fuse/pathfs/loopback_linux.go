@@ -2,7 +2,9 @@ package pathfs
 
 import (
 	"fmt"
+	"os"
 	"syscall"
+	"time"
 
 	"github.com/hanwen/go-fuse/fuse"
 )
@@ -25,6 +27,13 @@ func (fs *loopbackFileSystem) StatFs(name string) *fuse.StatfsOut {
 	return nil
 }
 
+func (fs *loopbackFileSystem) Rename(oldPath string, newPath string, flags uint32, context *fuse.Context) (code fuse.Status) {
+	if flags == 0 {
+		return fuse.ToStatus(os.Rename(fs.GetPath(oldPath), fs.GetPath(newPath)))
+	}
+	return fuse.ToStatus(sysRenameat2(fs.GetPath(oldPath), fs.GetPath(newPath), flags))
+}
+
 func (fs *loopbackFileSystem) ListXAttr(name string, context *fuse.Context) ([]string, fuse.Status) {
 	data, err := listXAttr(fs.GetPath(name))
 
@@ -46,3 +55,19 @@ func (fs *loopbackFileSystem) GetXAttr(name string, attr string, context *fuse.C
 
 	return data, fuse.ToStatus(err)
 }
+
+const _UTIME_OMIT = ((1 << 30) - 2)
+
+func utimeToTimespec(t *time.Time) syscall.Timespec {
+	if t == nil {
+		return syscall.Timespec{Nsec: _UTIME_OMIT}
+	}
+	return syscall.NsecToTimespec(t.UnixNano())
+}
+
+// Utimens leaves times that are nil untouched. This matters for the
+// writeback cache, where the kernel updates only the mtime.
+func (fs *loopbackFileSystem) Utimens(path string, Atime *time.Time, Mtime *time.Time, context *fuse.Context) (code fuse.Status) {
+	ts := []syscall.Timespec{utimeToTimespec(Atime), utimeToTimespec(Mtime)}
+	return fuse.ToStatus(syscall.UtimesNano(fs.GetPath(path), ts))
+}
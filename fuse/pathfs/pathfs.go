@@ -465,12 +465,21 @@ func (n *pathInode) Symlink(name string, content string, context *fuse.Context)
 	return
 }
 
-func (n *pathInode) Rename(oldName string, newParent nodefs.Node, newName string, context *fuse.Context) (code fuse.Status) {
+func (n *pathInode) Rename(oldName string, newParent nodefs.Node, newName string, flags uint32, context *fuse.Context) (code fuse.Status) {
 	p := newParent.(*pathInode)
 	oldPath := filepath.Join(n.GetPath(), oldName)
 	newPath := filepath.Join(p.GetPath(), newName)
-	code = n.fs.Rename(oldPath, newPath, context)
-	if code.Ok() {
+	code = n.fs.Rename(oldPath, newPath, flags, context)
+	if code.Ok() && flags&fuse.RENAME_EXCHANGE != 0 {
+		ch := n.rmChild(oldName)
+		other := p.rmChild(newName)
+		if ch != nil {
+			p.addChild(newName, ch)
+		}
+		if other != nil {
+			n.addChild(oldName, other)
+		}
+	} else if code.Ok() {
 		ch := n.rmChild(oldName)
 		p.rmChild(newName)
 		p.addChild(newName, ch)
@@ -683,3 +692,65 @@ func (n *pathInode) Fallocate(file nodefs.File, off uint64, size uint64, mode ui
 
 	return code
 }
+
+func (n *pathInode) Lseek(file nodefs.File, off uint64, whence uint32, context *fuse.Context) (res uint64, code fuse.Status) {
+	code = fuse.ENOSYS
+	if file != nil {
+		res, code = file.Lseek(off, whence)
+	}
+	if code == fuse.ENOSYS {
+		res, code = n.fs.Lseek(n.GetPath(), off, whence, context)
+	}
+	return res, code
+}
+
+func (n *pathInode) CopyFileRange(file nodefs.File, offIn uint64, out *nodefs.Inode, outFile nodefs.File, offOut uint64, size uint64, flags uint64, context *fuse.Context) (written uint32, code fuse.Status) {
+	code = fuse.ENOSYS
+	if file != nil && outFile != nil {
+		written, code = file.CopyFileRange(offIn, outFile, offOut, size, flags)
+	}
+	if code != fuse.ENOSYS {
+		return written, code
+	}
+	// The kernel only sends COPY_FILE_RANGE within a mount, but
+	// the output may belong to another file system mounted
+	// within it.
+	outNode, ok := out.Node().(*pathInode)
+	if !ok || outNode.pathFs != n.pathFs {
+		return 0, fuse.ENOSYS
+	}
+	return n.fs.CopyFileRange(n.GetPath(), offIn, outNode.GetPath(), offOut, size, flags, context)
+}
+
+func (n *pathInode) GetLk(file nodefs.File, owner uint64, lk *fuse.FileLock, flags uint32, out *fuse.FileLock, context *fuse.Context) (code fuse.Status) {
+	code = fuse.ENOSYS
+	if file != nil {
+		code = file.GetLk(owner, lk, flags, out)
+	}
+	if code == fuse.ENOSYS {
+		code = n.fs.GetLk(n.GetPath(), owner, lk, flags, out, context)
+	}
+	return code
+}
+
+func (n *pathInode) SetLk(file nodefs.File, owner uint64, lk *fuse.FileLock, flags uint32, context *fuse.Context) (code fuse.Status) {
+	code = fuse.ENOSYS
+	if file != nil {
+		code = file.SetLk(owner, lk, flags)
+	}
+	if code == fuse.ENOSYS {
+		code = n.fs.SetLk(n.GetPath(), owner, lk, flags, context)
+	}
+	return code
+}
+
+func (n *pathInode) SetLkw(file nodefs.File, owner uint64, lk *fuse.FileLock, flags uint32, context *fuse.Context) (code fuse.Status) {
+	code = fuse.ENOSYS
+	if file != nil {
+		code = file.SetLkw(owner, lk, flags)
+	}
+	if code == fuse.ENOSYS {
+		code = n.fs.SetLkw(n.GetPath(), owner, lk, flags, context)
+	}
+	return code
+}
@@ -55,8 +55,8 @@ func (fs *prefixFileSystem) Symlink(value string, linkName string, context *fuse
 	return fs.FileSystem.Symlink(value, fs.prefixed(linkName), context)
 }
 
-func (fs *prefixFileSystem) Rename(oldName string, newName string, context *fuse.Context) (code fuse.Status) {
-	return fs.FileSystem.Rename(fs.prefixed(oldName), fs.prefixed(newName), context)
+func (fs *prefixFileSystem) Rename(oldName string, newName string, flags uint32, context *fuse.Context) (code fuse.Status) {
+	return fs.FileSystem.Rename(fs.prefixed(oldName), fs.prefixed(newName), flags, context)
 }
 
 func (fs *prefixFileSystem) Link(oldName string, newName string, context *fuse.Context) (code fuse.Status) {
@@ -119,6 +119,26 @@ func (fs *prefixFileSystem) RemoveXAttr(name string, attr string, context *fuse.
 	return fs.FileSystem.RemoveXAttr(fs.prefixed(name), attr, context)
 }
 
+func (fs *prefixFileSystem) Lseek(name string, off uint64, whence uint32, context *fuse.Context) (uint64, fuse.Status) {
+	return fs.FileSystem.Lseek(fs.prefixed(name), off, whence, context)
+}
+
+func (fs *prefixFileSystem) CopyFileRange(nameIn string, offIn uint64, nameOut string, offOut uint64, size uint64, flags uint64, context *fuse.Context) (uint32, fuse.Status) {
+	return fs.FileSystem.CopyFileRange(fs.prefixed(nameIn), offIn, fs.prefixed(nameOut), offOut, size, flags, context)
+}
+
+func (fs *prefixFileSystem) GetLk(name string, owner uint64, lk *fuse.FileLock, flags uint32, out *fuse.FileLock, context *fuse.Context) (code fuse.Status) {
+	return fs.FileSystem.GetLk(fs.prefixed(name), owner, lk, flags, out, context)
+}
+
+func (fs *prefixFileSystem) SetLk(name string, owner uint64, lk *fuse.FileLock, flags uint32, context *fuse.Context) (code fuse.Status) {
+	return fs.FileSystem.SetLk(fs.prefixed(name), owner, lk, flags, context)
+}
+
+func (fs *prefixFileSystem) SetLkw(name string, owner uint64, lk *fuse.FileLock, flags uint32, context *fuse.Context) (code fuse.Status) {
+	return fs.FileSystem.SetLkw(fs.prefixed(name), owner, lk, flags, context)
+}
+
 func (fs *prefixFileSystem) String() string {
 	return fmt.Sprintf("prefixFileSystem(%s,%s)", fs.FileSystem.String(), fs.Prefix)
 }
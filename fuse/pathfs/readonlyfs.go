@@ -46,10 +46,14 @@ func (fs *readonlyFileSystem) Symlink(value string, linkName string, context *fu
 	return fuse.EPERM
 }
 
-func (fs *readonlyFileSystem) Rename(oldName string, newName string, context *fuse.Context) (code fuse.Status) {
+func (fs *readonlyFileSystem) Rename(oldName string, newName string, flags uint32, context *fuse.Context) (code fuse.Status) {
 	return fuse.EPERM
 }
 
+func (fs *readonlyFileSystem) CopyFileRange(nameIn string, offIn uint64, nameOut string, offOut uint64, size uint64, flags uint64, context *fuse.Context) (uint32, fuse.Status) {
+	return 0, fuse.EPERM
+}
+
 func (fs *readonlyFileSystem) Link(oldName string, newName string, context *fuse.Context) (code fuse.Status) {
 	return fuse.EPERM
 }
@@ -8,6 +8,9 @@ import (
 
 var _zero uintptr
 
+// Not in the syscall package.
+const _AT_FDCWD = -0x64
+
 func getXAttr(path string, attr string, dest []byte) (value []byte, err error) {
 	sz, err := sysGetxattr(path, attr, dest)
 	for sz > cap(dest) && err == nil {
@@ -108,3 +111,25 @@ func sysListxattr(path string, dest []byte) (sz int, err error) {
 	}
 	return
 }
+
+func sysRenameat2(oldPath string, newPath string, flags uint32) (err error) {
+	if _SYS_RENAMEAT2 == 0 {
+		return syscall.EINVAL
+	}
+	var _p0 *byte
+	_p0, err = syscall.BytePtrFromString(oldPath)
+	if err != nil {
+		return
+	}
+	var _p1 *byte
+	_p1, err = syscall.BytePtrFromString(newPath)
+	if err != nil {
+		return
+	}
+	cwd := _AT_FDCWD
+	_, _, e1 := syscall.Syscall6(_SYS_RENAMEAT2, uintptr(cwd), uintptr(unsafe.Pointer(_p0)), uintptr(cwd), uintptr(unsafe.Pointer(_p1)), uintptr(flags), 0)
+	if e1 != 0 {
+		err = e1
+	}
+	return
+}
@@ -0,0 +1,4 @@
+package pathfs
+
+// Not in the syscall package.
+const _SYS_RENAMEAT2 = 276
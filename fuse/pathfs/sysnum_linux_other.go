@@ -0,0 +1,7 @@
+// +build linux,!amd64,!386,!arm,!arm64
+
+package pathfs
+
+// We don't know the number on this architecture, so flagged renames
+// report EINVAL.
+const _SYS_RENAMEAT2 = 0
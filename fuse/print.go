@@ -14,6 +14,7 @@ var FuseOpenFlagNames map[int64]string
 var accessFlagName map[int64]string
 var writeFlagNames map[int64]string
 var readFlagNames map[int64]string
+var renameFlagNames map[int64]string
 
 func init() {
 	writeFlagNames = map[int64]string{
@@ -23,25 +24,41 @@ func init() {
 	readFlagNames = map[int64]string{
 		READ_LOCKOWNER: "LOCKOWNER",
 	}
+	renameFlagNames = map[int64]string{
+		RENAME_NOREPLACE: "NOREPLACE",
+		RENAME_EXCHANGE:  "EXCHANGE",
+		RENAME_WHITEOUT:  "WHITEOUT",
+	}
 	initFlagNames = map[int64]string{
-		CAP_ASYNC_READ:       "ASYNC_READ",
-		CAP_POSIX_LOCKS:      "POSIX_LOCKS",
-		CAP_FILE_OPS:         "FILE_OPS",
-		CAP_ATOMIC_O_TRUNC:   "ATOMIC_O_TRUNC",
-		CAP_EXPORT_SUPPORT:   "EXPORT_SUPPORT",
-		CAP_BIG_WRITES:       "BIG_WRITES",
-		CAP_DONT_MASK:        "DONT_MASK",
-		CAP_SPLICE_WRITE:     "SPLICE_WRITE",
-		CAP_SPLICE_MOVE:      "SPLICE_MOVE",
-		CAP_SPLICE_READ:      "SPLICE_READ",
-		CAP_FLOCK_LOCKS:      "FLOCK_LOCKS",
-		CAP_IOCTL_DIR:        "IOCTL_DIR",
-		CAP_AUTO_INVAL_DATA:  "AUTO_INVAL_DATA",
-		CAP_READDIRPLUS:      "READDIRPLUS",
-		CAP_READDIRPLUS_AUTO: "READDIRPLUS_AUTO",
+		CAP_ASYNC_READ:         "ASYNC_READ",
+		CAP_POSIX_LOCKS:        "POSIX_LOCKS",
+		CAP_FILE_OPS:           "FILE_OPS",
+		CAP_ATOMIC_O_TRUNC:     "ATOMIC_O_TRUNC",
+		CAP_EXPORT_SUPPORT:     "EXPORT_SUPPORT",
+		CAP_BIG_WRITES:         "BIG_WRITES",
+		CAP_DONT_MASK:          "DONT_MASK",
+		CAP_SPLICE_WRITE:       "SPLICE_WRITE",
+		CAP_SPLICE_MOVE:        "SPLICE_MOVE",
+		CAP_SPLICE_READ:        "SPLICE_READ",
+		CAP_FLOCK_LOCKS:        "FLOCK_LOCKS",
+		CAP_IOCTL_DIR:          "IOCTL_DIR",
+		CAP_AUTO_INVAL_DATA:    "AUTO_INVAL_DATA",
+		CAP_READDIRPLUS:        "READDIRPLUS",
+		CAP_READDIRPLUS_AUTO:   "READDIRPLUS_AUTO",
+		CAP_ASYNC_DIO:          "ASYNC_DIO",
+		CAP_WRITEBACK_CACHE:    "WRITEBACK_CACHE",
+		CAP_NO_OPEN_SUPPORT:    "NO_OPEN_SUPPORT",
+		CAP_PARALLEL_DIROPS:    "PARALLEL_DIROPS",
+		CAP_HANDLE_KILLPRIV:    "HANDLE_KILLPRIV",
+		CAP_POSIX_ACL:          "POSIX_ACL",
+		CAP_ABORT_ERROR:        "ABORT_ERROR",
+		CAP_MAX_PAGES:          "MAX_PAGES",
+		CAP_CACHE_SYMLINKS:     "CACHE_SYMLINKS",
+		CAP_NO_OPENDIR_SUPPORT: "NO_OPENDIR_SUPPORT",
 	}
 	releaseFlagNames = map[int64]string{
-		RELEASE_FLUSH: "FLUSH",
+		RELEASE_FLUSH:        "FLUSH",
+		RELEASE_FLOCK_UNLOCK: "FLOCK_UNLOCK",
 	}
 	OpenFlagNames = map[int64]string{
 		int64(os.O_WRONLY):        "WRONLY",
@@ -62,6 +79,7 @@ func init() {
 		FOPEN_DIRECT_IO:   "DIRECT",
 		FOPEN_KEEP_CACHE:  "CACHE",
 		FOPEN_NONSEEKABLE: "NONSEEK",
+		FOPEN_CACHE_DIR:   "CACHE_DIR",
 	}
 	accessFlagName = map[int64]string{
 		X_OK: "x",
@@ -106,7 +124,7 @@ func (me *MknodIn) string() string {
 }
 
 func (me *RenameIn) string() string {
-	return fmt.Sprintf("{%d}", me.Newdir)
+	return fmt.Sprintf("{i%d %s}", me.Newdir, FlagString(renameFlagNames, int64(me.Flags), "0"))
 }
 
 func (me *SetAttrIn) string() string {
@@ -129,6 +147,9 @@ func (me *SetAttrIn) string() string {
 	if me.Valid&FATTR_MTIME != 0 {
 		s = append(s, fmt.Sprintf("mtime %d.%09d", me.Mtime, me.Mtimensec))
 	}
+	if me.Valid&FATTR_CTIME != 0 {
+		s = append(s, fmt.Sprintf("ctime %d.%09d", me.Ctime, me.Ctimensec))
+	}
 	if me.Valid&FATTR_MTIME != 0 {
 		s = append(s, fmt.Sprintf("fh %d", me.Fh))
 	}
@@ -159,10 +180,10 @@ func (me *InitIn) String() string {
 }
 
 func (me *InitOut) string() string {
-	return fmt.Sprintf("{%d.%d Ra 0x%x %s %d/%d Wr 0x%x}",
+	return fmt.Sprintf("{%d.%d Ra 0x%x %s %d/%d Wr 0x%x Pg %d}",
 		me.Major, me.Minor, me.MaxReadAhead,
 		FlagString(initFlagNames, int64(me.Flags), ""),
-		me.CongestionThreshold, me.MaxBackground, me.MaxWrite)
+		me.CongestionThreshold, me.MaxBackground, me.MaxWrite, me.MaxPages)
 }
 
 func (me *SetXAttrIn) string() string {
@@ -230,6 +251,75 @@ func (f *FallocateIn) string() string {
 		f.Fh, f.Offset, f.Length, f.Mode)
 }
 
+func (in *LseekIn) string() string {
+	return fmt.Sprintf("{Fh %d off %d whence %d}", in.Fh, in.Offset, in.Whence)
+}
+
+func (o *LseekOut) string() string {
+	return fmt.Sprintf("{off %d}", o.Offset)
+}
+
+func (in *CopyFileRangeIn) string() string {
+	return fmt.Sprintf("{Fh %d off %d => i%d Fh %d off %d sz %d flags %x}",
+		in.FhIn, in.OffIn, in.NodeIdOut, in.FhOut, in.OffOut, in.Len, in.Flags)
+}
+
+func (o *WriteOut) string() string {
+	return fmt.Sprintf("{%d bytes}", o.Size)
+}
+
+func (in *InterruptIn) string() string {
+	return fmt.Sprintf("{ix %d}", in.Unique)
+}
+
+func (lk *FileLock) string() string {
+	return fmt.Sprintf("{%d-%d %d pid %d}", lk.Start, lk.End, lk.Typ, lk.Pid)
+}
+
+func (in *LkIn) string() string {
+	return fmt.Sprintf("{Fh %d owner %x %v fl 0x%x}",
+		in.Fh, in.Owner, in.Lk.string(), in.LkFlags)
+}
+
+func (out *LkOut) string() string {
+	return fmt.Sprintf("{%v}", out.Lk.string())
+}
+
+func (in *IoctlIn) string() string {
+	return fmt.Sprintf("{Fh %d cmd 0x%x arg 0x%x in %d out %d fl 0x%x}",
+		in.Fh, in.Cmd, in.Arg, in.InSize, in.OutSize, in.Flags)
+}
+
+func (out *IoctlOut) string() string {
+	return fmt.Sprintf("{result %d}", out.Result)
+}
+
+func (in *PollIn) string() string {
+	return fmt.Sprintf("{Fh %d kh %d ev 0x%x fl 0x%x}",
+		in.Fh, in.Kh, in.Events, in.Flags)
+}
+
+func (out *PollOut) string() string {
+	return fmt.Sprintf("{rev 0x%x}", out.Revents)
+}
+
+func (n *NotifyPollWakeupOut) string() string {
+	return fmt.Sprintf("{kh %d}", n.Kh)
+}
+
+func (o *NotifyStoreOut) string() string {
+	return fmt.Sprintf("{nodeid %d off %d sz %d}", o.Nodeid, o.Offset, o.Size)
+}
+
+func (o *NotifyRetrieveOut) string() string {
+	return fmt.Sprintf("{notifyUnique %d nodeid %d off %d sz %d}",
+		o.NotifyUnique, o.Nodeid, o.Offset, o.Size)
+}
+
+func (in *NotifyRetrieveIn) string() string {
+	return fmt.Sprintf("{off %d sz %d}", in.Offset, in.Size)
+}
+
 // Print pretty prints FUSE data types for kernel communication
 func Print(obj interface{}) string {
 	t, ok := obj.(interface {
@@ -0,0 +1,410 @@
+package fuse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"unsafe"
+)
+
+// A recording is a sequence of records, each consisting of a 4 byte
+// little-endian length, a kind byte, and a raw FUSE message of that
+// length in host byte order.
+const (
+	recordRequest      = 'Q'
+	recordReply        = 'R'
+	recordNotification = 'N'
+)
+
+type recorder struct {
+	mu  sync.Mutex
+	w   io.Writer
+	err error
+}
+
+// SetRecorder makes the server write all requests it reads, and
+// all replies and notifications it sends, to w. The recording can be
+// fed to Replay. Recording disables splicing, so spliced data is
+// recorded too. Call it before Serve; passing nil switches recording
+// off.
+func (ms *Server) SetRecorder(w io.Writer) {
+	if w == nil {
+		ms.recorder = nil
+		return
+	}
+	ms.recorder = &recorder{w: w}
+}
+
+func (r *recorder) record(kind byte, parts ...[]byte) {
+	var hdr [5]byte
+	sz := 0
+	for _, p := range parts {
+		sz += len(p)
+	}
+	binary.LittleEndian.PutUint32(hdr[:], uint32(sz))
+	hdr[4] = kind
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	for _, p := range append([][]byte{hdr[:]}, parts...) {
+		if _, err := r.w.Write(p); err != nil {
+			log.Printf("recording stopped: %v", err)
+			r.err = err
+			return
+		}
+	}
+}
+
+type record struct {
+	kind byte
+	data []byte
+}
+
+func readRecords(r io.Reader) ([]record, error) {
+	var result []record
+	for {
+		var hdr [5]byte
+		if _, err := io.ReadFull(r, hdr[:]); err == io.EOF {
+			return result, nil
+		} else if err != nil {
+			return nil, err
+		}
+		data := make([]byte, binary.LittleEndian.Uint32(hdr[:]))
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		result = append(result, record{hdr[4], data})
+	}
+}
+
+// ReplayOptions configures Replay.
+type ReplayOptions struct {
+	// Options for the Server that answers the replayed requests.
+	MountOptions *MountOptions
+
+	// Equal reports whether a reply matches the recorded one.
+	// Both include the OutHeader. This can be used to ignore
+	// fields that vary between runs, like timestamps. If nil,
+	// replies must be identical.
+	Equal func(opcode string, recorded, replayed []byte) bool
+
+	// If set, receives the events of the replayed requests, eg.
+	// to collect metrics.
+	Tracer Tracer
+}
+
+// ReplayMismatch describes a reply that differs from the recording.
+type ReplayMismatch struct {
+	Opcode string
+	Unique uint64
+
+	// The recorded and the replayed reply, including the
+	// OutHeader.
+	Recorded []byte
+	Replayed []byte
+}
+
+func (m *ReplayMismatch) String() string {
+	return fmt.Sprintf("%s (unique %d): recorded %x, replayed %x",
+		m.Opcode, m.Unique, m.Recorded, m.Replayed)
+}
+
+// replayIDs maps the node IDs and file handles of a recording to
+// the ones that the replayed file system hands out. IDs that were
+// not handed out in the recording, like the root, map to themselves.
+type replayIDs struct {
+	nodes   map[uint64]uint64
+	handles map[uint64]uint64
+}
+
+func (m *replayIDs) node(id *uint64) {
+	if r, ok := m.nodes[*id]; ok {
+		*id = r
+	}
+}
+
+func (m *replayIDs) handle(fh *uint64) {
+	if r, ok := m.handles[*fh]; ok {
+		*fh = r
+	}
+}
+
+// request translates the IDs in a recorded request in place.
+func (m *replayIDs) request(msg []byte) {
+	h := (*InHeader)(unsafe.Pointer(&msg[0]))
+	handler := getHandler(h.Opcode)
+	if handler == nil || len(msg) < int(handler.InputSize) {
+		// The Server will refuse it.
+		return
+	}
+	m.node(&h.NodeId)
+
+	ptr := unsafe.Pointer(&msg[0])
+	switch h.Opcode {
+	case _OP_BATCH_FORGET:
+		in := (*_BatchForgetIn)(ptr)
+		entries := msg[unsafe.Sizeof(*in):]
+		sz := int(unsafe.Sizeof(_ForgetOne{}))
+		for i := 0; i < int(in.Count) && (i+1)*sz <= len(entries); i++ {
+			m.node(&(*_ForgetOne)(unsafe.Pointer(&entries[i*sz])).NodeId)
+		}
+	case _OP_RENAME, _OP_RENAME2:
+		m.node(&(*RenameIn)(ptr).Newdir)
+	case _OP_LINK:
+		m.node(&(*LinkIn)(ptr).Oldnodeid)
+	case _OP_GETATTR:
+		if fh := (*GetAttrIn)(ptr).fhField(); fh != nil {
+			m.handle(fh)
+		}
+	case _OP_SETATTR:
+		m.handle(&(*SetAttrIn)(ptr).Fh)
+	case _OP_READ, _OP_READDIR, _OP_READDIRPLUS:
+		m.handle(&(*ReadIn)(ptr).Fh)
+	case _OP_WRITE:
+		m.handle(&(*WriteIn)(ptr).Fh)
+	case _OP_RELEASE, _OP_RELEASEDIR:
+		m.handle(&(*ReleaseIn)(ptr).Fh)
+	case _OP_FLUSH:
+		m.handle(&(*FlushIn)(ptr).Fh)
+	case _OP_FSYNC, _OP_FSYNCDIR:
+		m.handle(&(*FsyncIn)(ptr).Fh)
+	case _OP_GETLK, _OP_SETLK, _OP_SETLKW:
+		m.handle(&(*LkIn)(ptr).Fh)
+	case _OP_FALLOCATE:
+		m.handle(&(*FallocateIn)(ptr).Fh)
+	case _OP_LSEEK:
+		m.handle(&(*LseekIn)(ptr).Fh)
+	case _OP_IOCTL:
+		m.handle(&(*IoctlIn)(ptr).Fh)
+	case _OP_POLL:
+		m.handle(&(*PollIn)(ptr).Fh)
+	case _OP_COPY_FILE_RANGE:
+		in := (*CopyFileRangeIn)(ptr)
+		m.handle(&in.FhIn)
+		m.node(&in.NodeIdOut)
+		m.handle(&in.FhOut)
+	}
+}
+
+// reply learns the IDs handed out in a replayed reply, and puts the
+// recorded IDs in their place, so the replies can be compared.
+func (m *replayIDs) reply(opcode int32, recorded, replayed []byte) {
+	if len(recorded) != len(replayed) ||
+		(*OutHeader)(unsafe.Pointer(&recorded[0])).Status != 0 ||
+		(*OutHeader)(unsafe.Pointer(&replayed[0])).Status != 0 {
+		return
+	}
+	rec := recorded[sizeOfOutHeader:]
+	rep := replayed[sizeOfOutHeader:]
+	switch opcode {
+	case _OP_LOOKUP, _OP_MKNOD, _OP_MKDIR, _OP_SYMLINK, _OP_LINK:
+		m.entry(rec, rep)
+	case _OP_CREATE:
+		if len(rep) >= int(unsafe.Sizeof(CreateOut{})) {
+			m.entry(rec, rep)
+			m.learnHandle(&(*CreateOut)(unsafe.Pointer(&rec[0])).OpenOut,
+				&(*CreateOut)(unsafe.Pointer(&rep[0])).OpenOut)
+		}
+	case _OP_OPEN, _OP_OPENDIR:
+		if len(rep) >= int(unsafe.Sizeof(OpenOut{})) {
+			m.learnHandle((*OpenOut)(unsafe.Pointer(&rec[0])),
+				(*OpenOut)(unsafe.Pointer(&rep[0])))
+		}
+	case _OP_READDIRPLUS:
+		entrySize := int(unsafe.Sizeof(EntryOut{}))
+		for len(rep) >= entrySize+direntSize {
+			m.entry(rec, rep)
+			d := (*_Dirent)(unsafe.Pointer(&rep[entrySize]))
+			n := entrySize + direntSize + int(d.NameLen)
+			n += (8 - n&7) & 7
+			if n > len(rep) {
+				break
+			}
+			rec, rep = rec[n:], rep[n:]
+		}
+	}
+}
+
+// entry handles the EntryOut at the start of rec and rep.
+func (m *replayIDs) entry(rec, rep []byte) {
+	if len(rep) < int(unsafe.Sizeof(EntryOut{})) {
+		return
+	}
+	r := (*EntryOut)(unsafe.Pointer(&rec[0]))
+	p := (*EntryOut)(unsafe.Pointer(&rep[0]))
+	if r.NodeId == 0 || p.NodeId == 0 {
+		// Negative entries.
+		return
+	}
+	m.nodes[r.NodeId] = p.NodeId
+	p.NodeId = r.NodeId
+}
+
+func (m *replayIDs) learnHandle(rec, rep *OpenOut) {
+	m.handles[rec.Fh] = rep.Fh
+	rep.Fh = rec.Fh
+}
+
+// Replay feeds the requests of a recording made with
+// Server.SetRecorder to fs, and compares the replies with the
+// recorded ones. Requests are sent one at a time, in the order they
+// were recorded, so the outcome does not depend on scheduling; for
+// requests without a reply, like FORGET, Replay waits until fs has
+// handled them. INTERRUPT requests are skipped, as the requests they
+// refer to have been answered by the time they are replayed.
+// Notifications sent by fs are ignored.
+//
+// Node IDs and file handles that fs hands out in replies to LOOKUP,
+// CREATE, OPEN and the like need not match the recorded ones: Replay
+// translates them in the requests that follow, and compares replies
+// as if fs had handed out the recorded ones.
+func Replay(recording io.Reader, fs RawFileSystem, opts *ReplayOptions) ([]ReplayMismatch, error) {
+	if opts == nil {
+		opts = &ReplayOptions{}
+	}
+	equal := opts.Equal
+	if equal == nil {
+		equal = func(op string, a, b []byte) bool { return bytes.Equal(a, b) }
+	}
+
+	records, err := readRecords(recording)
+	if err != nil {
+		return nil, err
+	}
+	replies := map[uint64][]byte{}
+	for _, r := range records {
+		if r.kind == recordReply && len(r.data) >= int(sizeOfOutHeader) {
+			replies[(*OutHeader)(unsafe.Pointer(&r.data[0])).Unique] = r.data
+		}
+	}
+
+	client, conn := net.Pipe()
+	ms := NewServerStream(fs, conn, opts.MountOptions)
+	handled := &replayTracer{done: map[uint64]bool{}}
+	handled.cond = sync.NewCond(&handled.mu)
+	ms.SetTracer(MultiTracer(opts.Tracer, handled))
+	done := make(chan struct{})
+	go func() {
+		ms.Serve()
+		handled.stop()
+		close(done)
+	}()
+	defer func() {
+		client.Close()
+		<-done
+	}()
+
+	ids := &replayIDs{
+		nodes:   map[uint64]uint64{},
+		handles: map[uint64]uint64{},
+	}
+	var mismatches []ReplayMismatch
+	for _, r := range records {
+		if r.kind != recordRequest || len(r.data) < int(unsafe.Sizeof(InHeader{})) {
+			continue
+		}
+		msg := append([]byte(nil), r.data...)
+		h := (*InHeader)(unsafe.Pointer(&msg[0]))
+		if h.Opcode == _OP_INTERRUPT {
+			continue
+		}
+		ids.request(msg)
+		if _, err := client.Write(msg); err != nil {
+			return mismatches, err
+		}
+		want, ok := replies[h.Unique]
+		if !ok {
+			if noReply(h.Opcode) {
+				handled.wait(h.Unique)
+			}
+			continue
+		}
+		got, err := readReplyTo(client, h.Unique)
+		if err != nil {
+			return mismatches, err
+		}
+		ids.reply(h.Opcode, want, got)
+		if op := operationName(h.Opcode); !equal(op, want, got) {
+			mismatches = append(mismatches, ReplayMismatch{
+				Opcode:   op,
+				Unique:   h.Unique,
+				Recorded: want,
+				Replayed: got,
+			})
+		}
+	}
+	return mismatches, nil
+}
+
+// noReply returns true for requests that the Server does not answer.
+func noReply(opcode int32) bool {
+	return opcode == _OP_FORGET || opcode == _OP_BATCH_FORGET ||
+		opcode == _OP_NOTIFY_REPLY
+}
+
+// replayTracer tells Replay when requests that are not answered have
+// been handled.
+type replayTracer struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	done    map[uint64]bool
+	stopped bool
+}
+
+func (t *replayTracer) Trace(ev *TraceEvent) {
+	if opcode := opcodeByName(ev.Opcode); opcode < 0 || !noReply(opcode) {
+		return
+	}
+	t.mu.Lock()
+	t.done[ev.Unique] = true
+	t.cond.Broadcast()
+	t.mu.Unlock()
+}
+
+// wait waits until the request with the given unique is handled, or
+// the Server stops.
+func (t *replayTracer) wait(unique uint64) {
+	t.mu.Lock()
+	for !t.done[unique] && !t.stopped {
+		t.cond.Wait()
+	}
+	delete(t.done, unique)
+	t.mu.Unlock()
+}
+
+func (t *replayTracer) stop() {
+	t.mu.Lock()
+	t.stopped = true
+	t.cond.Broadcast()
+	t.mu.Unlock()
+}
+
+// readReplyTo reads messages from a stream until it finds the reply
+// to the request with the given unique.
+func readReplyTo(r io.Reader, unique uint64) ([]byte, error) {
+	for {
+		hdr := make([]byte, sizeOfOutHeader)
+		if _, err := io.ReadFull(r, hdr); err != nil {
+			return nil, err
+		}
+		h := (*OutHeader)(unsafe.Pointer(&hdr[0]))
+		if int(h.Length) < len(hdr) {
+			return nil, fmt.Errorf("bad reply length %d", h.Length)
+		}
+		msg := make([]byte, h.Length)
+		copy(msg, hdr)
+		if _, err := io.ReadFull(r, msg[len(hdr):]); err != nil {
+			return nil, err
+		}
+		if h.Unique == unique {
+			return msg, nil
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package fuse
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestRecordReplay(t *testing.T) {
+	client, conn := net.Pipe()
+	ms := NewServerStream(&attrFS{NewDefaultRawFileSystem()}, conn, nil)
+	var recording bytes.Buffer
+	ms.SetRecorder(&recording)
+	done := make(chan struct{})
+	go func() {
+		ms.Serve()
+		close(done)
+	}()
+
+	client.Write(initMessage(1))
+	readReply(t, client)
+	ms.WaitMount()
+	client.Write(getAttrMessage(2, FUSE_ROOT_ID))
+	readReply(t, client)
+	client.Write(getAttrMessage(3, 42))
+	readReply(t, client)
+	go ms.InodeNotify(42, 0, -1)
+	readReply(t, client)
+	client.Close()
+	<-done
+
+	records, err := readRecords(bytes.NewReader(recording.Bytes()))
+	if err != nil {
+		t.Fatalf("readRecords: %v", err)
+	}
+	var kinds string
+	for _, r := range records {
+		kinds += string(r.kind)
+	}
+	if kinds != "QRQRQRN" {
+		t.Errorf("got records %q, want %q", kinds, "QRQRQRN")
+	}
+
+	mismatches, err := Replay(bytes.NewReader(recording.Bytes()), &attrFS{NewDefaultRawFileSystem()}, nil)
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if len(mismatches) != 0 {
+		t.Errorf("replay into the same file system: got mismatches %v", mismatches)
+	}
+
+	// The default file system does not implement GETATTR.
+	mismatches, err = Replay(bytes.NewReader(recording.Bytes()), NewDefaultRawFileSystem(), nil)
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if len(mismatches) != 2 || mismatches[0].Opcode != "GETATTR" || mismatches[0].Unique != 2 ||
+		mismatches[1].Unique != 3 {
+		t.Errorf("replay into another file system: got mismatches %v", mismatches)
+	}
+
+	tracer := &opTracer{}
+	ignoreGetAttr := &ReplayOptions{
+		Equal: func(op string, recorded, replayed []byte) bool {
+			return op == "GETATTR" || bytes.Equal(recorded, replayed)
+		},
+		Tracer: tracer,
+	}
+	mismatches, err = Replay(bytes.NewReader(recording.Bytes()), NewDefaultRawFileSystem(), ignoreGetAttr)
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if len(mismatches) != 0 {
+		t.Errorf("replay with custom Equal: got mismatches %v", mismatches)
+	}
+	if want := []string{"INIT", "GETATTR", "GETATTR"}; !reflect.DeepEqual(tracer.ops, want) {
+		t.Errorf("replay with Tracer: got events %v, want %v", tracer.ops, want)
+	}
+}
+
+// idFS hands out node IDs and file handles starting at base, so
+// replays into a new idFS with another base get other IDs.
+type idFS struct {
+	RawFileSystem
+	mu    sync.Mutex
+	next  uint64
+	nodes map[uint64]bool
+	fhs   map[uint64]bool
+}
+
+func newIDFS(base uint64) *idFS {
+	return &idFS{
+		RawFileSystem: NewDefaultRawFileSystem(),
+		next:          base,
+		nodes:         map[uint64]bool{},
+		fhs:           map[uint64]bool{},
+	}
+}
+
+func (fs *idFS) Lookup(header *InHeader, name string, out *EntryOut) Status {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.next++
+	fs.nodes[fs.next] = true
+	out.NodeId = fs.next
+	out.Mode = S_IFREG | 0644
+	return OK
+}
+
+// Forget is slow, so requests sent after a FORGET overtake it,
+// unless the sender waits for it.
+func (fs *idFS) Forget(nodeid, nlookup uint64) {
+	time.Sleep(10 * time.Millisecond)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	delete(fs.nodes, nodeid)
+}
+
+func (fs *idFS) GetAttr(input *GetAttrIn, out *AttrOut) Status {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if !fs.nodes[input.NodeId] {
+		return ENOENT
+	}
+	out.Mode = S_IFREG | 0644
+	return OK
+}
+
+func (fs *idFS) Open(input *OpenIn, out *OpenOut) Status {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if !fs.nodes[input.NodeId] {
+		return ENOENT
+	}
+	fs.next++
+	fs.fhs[fs.next] = true
+	out.Fh = fs.next
+	return OK
+}
+
+func (fs *idFS) Read(input *ReadIn, buf []byte) (ReadResult, Status) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if !fs.fhs[input.Fh] {
+		return nil, EBADF
+	}
+	return ReadResultData([]byte("data")), OK
+}
+
+func TestReplayTranslatesIDs(t *testing.T) {
+	client, conn := net.Pipe()
+	fs := newIDFS(100)
+	ms := NewServerStream(fs, conn, nil)
+	var recording bytes.Buffer
+	ms.SetRecorder(&recording)
+	done := make(chan struct{})
+	go func() {
+		ms.Serve()
+		close(done)
+	}()
+
+	client.Write(initMessage(1))
+	readReply(t, client)
+	ms.WaitMount()
+
+	client.Write(withUnique(message(_OP_LOOKUP, 0, []byte("file\x00")), 2))
+	_, data := readReply(t, client)
+	node := (*EntryOut)(unsafe.Pointer(&data[0])).NodeId
+
+	client.Write(getAttrMessage(3, node))
+	readReply(t, client)
+
+	open := message(_OP_OPEN, unsafe.Sizeof(OpenIn{}), nil)
+	(*OpenIn)(unsafe.Pointer(&open[0])).NodeId = node
+	client.Write(withUnique(open, 4))
+	_, data = readReply(t, client)
+	fh := (*OpenOut)(unsafe.Pointer(&data[0])).Fh
+
+	read := withUnique(readMessage(4096), 5)
+	(*ReadIn)(unsafe.Pointer(&read[0])).NodeId = node
+	(*ReadIn)(unsafe.Pointer(&read[0])).Fh = fh
+	client.Write(read)
+	if h, _ := readReply(t, client); h.Status != 0 {
+		t.Fatalf("READ failed: %v", Status(-h.Status))
+	}
+
+	forget := withUnique(message(_OP_FORGET, unsafe.Sizeof(ForgetIn{}), nil), 6)
+	(*ForgetIn)(unsafe.Pointer(&forget[0])).NodeId = node
+	(*ForgetIn)(unsafe.Pointer(&forget[0])).Nlookup = 1
+	client.Write(forget)
+	for forgotten := false; !forgotten; {
+		fs.mu.Lock()
+		forgotten = !fs.nodes[node]
+		fs.mu.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+
+	// FORGET is not answered, so Replay must wait for it to be
+	// handled before sending this.
+	client.Write(getAttrMessage(7, node))
+	if h, _ := readReply(t, client); h.Status != -int32(ENOENT) {
+		t.Fatalf("GETATTR after FORGET: got %+v", h)
+	}
+	client.Close()
+	<-done
+
+	for i := 0; i < 10; i++ {
+		mismatches, err := Replay(bytes.NewReader(recording.Bytes()), newIDFS(200), nil)
+		if err != nil {
+			t.Fatalf("Replay: %v", err)
+		}
+		if len(mismatches) != 0 {
+			t.Fatalf("replay with other IDs: got mismatches %v", mismatches)
+		}
+	}
+}
@@ -35,9 +35,36 @@ type request struct {
 	// Start timestamp for timing info.
 	startTime time.Time
 
+	// The goroutine handling the request, and whether the
+	// watchdog has reported it, if SlowRequestThreshold is set.
+	// Protected by Server.inflight.
+	goroutine    uint64
+	slowReported bool
+
+	// Set if the request waited for a handler, see scheduler.
+	queued bool
+
 	// All information pertaining to opcode of this request.
 	handler *operationHandler
 
+	// The queue this request was read from; nil for
+	// notifications.
+	queue *readQueue
+
+	// For spliced WRITE requests, the pipe holding the payload.
+	writePipe *WritePipe
+
+	// For RENAME, the input widened to the layout of RENAME2.
+	// inHeader points into it, so the file system and the
+	// Server see the same header.
+	renameIn RenameIn
+
+	// Closed when the kernel interrupts this request; created on
+	// demand by Server.Context. Both are protected by
+	// Server.inflight.
+	cancel      chan struct{}
+	interrupted bool
+
 	// Request storage. For large inputs and outputs, use data
 	// obtained through bufferpool.
 	bufferPoolInputBuf  []byte
@@ -66,8 +93,11 @@ func (r *request) clear() {
 	r.flatData = nil
 	r.fdData = nil
 	r.startTime = time.Time{}
+	r.goroutine = 0
+	r.queued = false
 	r.handler = nil
 	r.readResult = nil
+	r.writePipe = nil
 }
 
 func (r *request) InputDebug() string {
@@ -131,10 +161,14 @@ func (r *request) setInput(input []byte) bool {
 	return true
 }
 
+// parse splits up the input buffer. Malformed messages get status
+// EINVAL and unknown opcodes ENOSYS. If even the header is truncated,
+// inHeader stays nil, and the request cannot be answered.
 func (r *request) parse() {
 	inHSize := int(unsafe.Sizeof(InHeader{}))
 	if len(r.inputBuf) < inHSize {
 		log.Printf("Short read for input header: %v", r.inputBuf)
+		r.status = EINVAL
 		return
 	}
 
@@ -144,13 +178,21 @@ func (r *request) parse() {
 	r.handler = getHandler(r.inHeader.Opcode)
 	if r.handler == nil {
 		log.Printf("Unknown opcode %d", r.inHeader.Opcode)
+		r.handler = unknownHandler
 		r.status = ENOSYS
 		return
 	}
 
+	if int(r.inHeader.Length) != len(r.inputBuf) {
+		log.Printf("Length mismatch for %v: header says %d, got %d bytes",
+			operationName(r.inHeader.Opcode), r.inHeader.Length, len(r.inputBuf))
+		r.status = EINVAL
+		return
+	}
+
 	if len(r.arg) < int(r.handler.InputSize) {
 		log.Printf("Short read for %v: %v", operationName(r.inHeader.Opcode), r.arg)
-		r.status = EIO
+		r.status = EINVAL
 		return
 	}
 
@@ -161,27 +203,99 @@ func (r *request) parse() {
 		r.arg = r.arg[inHSize:]
 	}
 
-	count := r.handler.FileNames
-	if count > 0 {
-		if count == 1 {
-			r.filenames = []string{string(r.arg[:len(r.arg)-1])}
-		} else {
-			names := bytes.SplitN(r.arg[:len(r.arg)-1], []byte{0}, count)
-			r.filenames = make([]string, len(names))
-			for i, n := range names {
-				r.filenames[i] = string(n)
-			}
-			if len(names) != count {
-				log.Println("filename argument mismatch", names, count)
-				r.status = EIO
-			}
+	if count := r.handler.FileNames; count > 0 {
+		r.filenames = parseNames(r.arg, count)
+		if r.filenames == nil {
+			log.Printf("Malformed names for %v: %q", operationName(r.inHeader.Opcode), r.arg)
+			r.status = EINVAL
+			return
 		}
+	} else if msg := r.checkArg(); msg != "" {
+		log.Printf("Malformed %v: %s", operationName(r.inHeader.Opcode), msg)
+		r.status = EINVAL
+		return
+	}
+
+	if r.inHeader.Opcode == _OP_RENAME {
+		in := (*_Rename1In)(r.inData)
+		r.renameIn = RenameIn{InHeader: in.InHeader, Newdir: in.Newdir}
+		r.inHeader = &r.renameIn.InHeader
+		r.inData = unsafe.Pointer(&r.renameIn)
 	}
 
-	copy(r.outBuf[:r.handler.OutputSize], zeroOutBuf[:r.handler.OutputSize])
+	// Zero the output struct, which follows the header, so replies
+	// do not carry data of earlier requests.
+	outSize := sizeOfOutHeader + r.handler.OutputSize
+	copy(r.outBuf[:outSize], zeroOutBuf[:outSize])
 	r.outData = unsafe.Pointer(&r.outBuf[sizeOfOutHeader])
 }
 
+// parseNames splits buf into count non-empty, NUL terminated
+// names. It returns nil if buf holds anything else.
+func parseNames(buf []byte, count int) []string {
+	if len(buf) == 0 || buf[len(buf)-1] != 0 {
+		return nil
+	}
+	split := bytes.Split(buf[:len(buf)-1], []byte{0})
+	if len(split) != count {
+		return nil
+	}
+	names := make([]string, count)
+	for i, n := range split {
+		if len(n) == 0 {
+			return nil
+		}
+		names[i] = string(n)
+	}
+	return names
+}
+
+// checkArg verifies the data following the fixed size input of
+// opcodes without filenames. It returns a description of the problem,
+// or "" if the data is well-formed.
+func (r *request) checkArg() string {
+	// The number of bytes that should follow the fixed size input.
+	payload := 0
+	switch r.inHeader.Opcode {
+	case _OP_INIT:
+		// Newer kernels send a larger InitIn.
+		return ""
+	case _OP_NOTIFY_REPLY:
+		// doNotifyReply checks the data against the retrieve.
+		return ""
+	case _OP_WRITE:
+		payload = int((*WriteIn)(r.inData).Size)
+	case _OP_SETXATTR:
+		i := bytes.IndexByte(r.arg, 0)
+		if i <= 0 {
+			return "missing attribute name"
+		}
+		payload = i + 1 + int((*SetXAttrIn)(r.inData).Size)
+	case _OP_IOCTL:
+		in := (*IoctlIn)(r.inData)
+		if in.OutSize > MAX_KERNEL_WRITE_MAX_PAGES {
+			return fmt.Sprintf("output size %d too large", in.OutSize)
+		}
+		payload = int(in.InSize)
+	case _OP_BATCH_FORGET:
+		in := (*_BatchForgetIn)(r.inData)
+		want := uint64(in.Count) * uint64(unsafe.Sizeof(_ForgetOne{}))
+		if want != uint64(len(r.arg)) {
+			return fmt.Sprintf("%d entries, got %d bytes", in.Count, len(r.arg))
+		}
+		return ""
+	case _OP_READ, _OP_READDIR, _OP_READDIRPLUS:
+		// The kernel never reads more than it allows for writes.
+		if in := (*ReadIn)(r.inData); in.Size > MAX_KERNEL_WRITE_MAX_PAGES {
+			return fmt.Sprintf("read size %d too large", in.Size)
+		}
+	}
+	if payload != len(r.arg) {
+		return fmt.Sprintf("want %d bytes of data, got %d", payload, len(r.arg))
+	}
+	return ""
+}
+
 func (r *request) serializeHeader(dataSize int) (header []byte) {
 	dataLength := r.handler.OutputSize
 	if r.outData == nil || r.status > OK {
@@ -5,5 +5,5 @@ const outputHeaderSize = 160
 const (
 	_FUSE_KERNEL_VERSION   = 7
 	_MINIMUM_MINOR_VERSION = 12
-	_OUR_MINOR_VERSION     = 21
+	_OUR_MINOR_VERSION     = 28
 )
@@ -0,0 +1,182 @@
+package fuse
+
+import (
+	"io"
+	"testing"
+	"unsafe"
+)
+
+// message builds a request of the given opcode, with a zeroed fixed
+// size input of inSize bytes (including the header), followed by
+// data.
+func message(opcode int32, inSize uintptr, data []byte) []byte {
+	if inSize == 0 {
+		inSize = unsafe.Sizeof(InHeader{})
+	}
+	buf := make([]byte, int(inSize)+len(data))
+	copy(buf[inSize:], data)
+	h := (*InHeader)(unsafe.Pointer(&buf[0]))
+	h.Length = uint32(len(buf))
+	h.Opcode = opcode
+	h.Unique = 1
+	h.NodeId = FUSE_ROOT_ID
+	return buf
+}
+
+func writeMessage(size uint32, data []byte) []byte {
+	buf := message(_OP_WRITE, unsafe.Sizeof(WriteIn{}), data)
+	(*WriteIn)(unsafe.Pointer(&buf[0])).Size = size
+	return buf
+}
+
+func setXAttrMessage(size uint32, data []byte) []byte {
+	buf := message(_OP_SETXATTR, unsafe.Sizeof(SetXAttrIn{}), data)
+	(*SetXAttrIn)(unsafe.Pointer(&buf[0])).Size = size
+	return buf
+}
+
+func batchForgetMessage(count uint32, entries int) []byte {
+	buf := message(_OP_BATCH_FORGET, unsafe.Sizeof(_BatchForgetIn{}),
+		make([]byte, entries*int(unsafe.Sizeof(_ForgetOne{}))))
+	(*_BatchForgetIn)(unsafe.Pointer(&buf[0])).Count = count
+	return buf
+}
+
+func readMessage(size uint32) []byte {
+	buf := message(_OP_READ, unsafe.Sizeof(ReadIn{}), nil)
+	(*ReadIn)(unsafe.Pointer(&buf[0])).Size = size
+	return buf
+}
+
+func parseMessage(buf []byte) *request {
+	req := &request{}
+	req.setInput(buf)
+	req.parse()
+	return req
+}
+
+func TestParse(t *testing.T) {
+	getAttrSize := unsafe.Sizeof(GetAttrIn{})
+	renameSize := unsafe.Sizeof(_Rename1In{})
+	badLength := message(_OP_GETATTR, getAttrSize, nil)
+	(*InHeader)(unsafe.Pointer(&badLength[0])).Length++
+
+	for _, tc := range []struct {
+		name string
+		buf  []byte
+		want Status
+	}{
+		{"getattr", message(_OP_GETATTR, getAttrSize, nil), OK},
+		{"unknown opcode", message(_OPCODE_COUNT+1, 0, nil), ENOSYS},
+		{"negative opcode", message(-1, 0, nil), ENOSYS},
+		{"length mismatch", badLength, EINVAL},
+		{"truncated input", message(_OP_GETATTR, 0, nil), EINVAL},
+		{"trailing bytes", message(_OP_GETATTR, getAttrSize, []byte{1}), EINVAL},
+		{"larger init", message(_OP_INIT, unsafe.Sizeof(InitIn{})+48, nil), OK},
+		{"lookup", message(_OP_LOOKUP, 0, []byte("a\x00")), OK},
+		{"lookup without name", message(_OP_LOOKUP, 0, nil), EINVAL},
+		{"lookup empty name", message(_OP_LOOKUP, 0, []byte{0}), EINVAL},
+		{"lookup unterminated", message(_OP_LOOKUP, 0, []byte("a")), EINVAL},
+		{"lookup two names", message(_OP_LOOKUP, 0, []byte("a\x00b\x00")), EINVAL},
+		{"rename", message(_OP_RENAME, renameSize, []byte("a\x00b\x00")), OK},
+		{"rename one name", message(_OP_RENAME, renameSize, []byte("a\x00")), EINVAL},
+		{"rename three names", message(_OP_RENAME, renameSize, []byte("a\x00b\x00c\x00")), EINVAL},
+		{"write", writeMessage(3, []byte("abc")), OK},
+		{"write short", writeMessage(4, []byte("abc")), EINVAL},
+		{"write long", writeMessage(2, []byte("abc")), EINVAL},
+		{"setxattr", setXAttrMessage(3, []byte("user.x\x00abc")), OK},
+		{"setxattr no name", setXAttrMessage(3, []byte("abc")), EINVAL},
+		{"setxattr short", setXAttrMessage(4, []byte("user.x\x00abc")), EINVAL},
+		{"batch forget", batchForgetMessage(2, 2), OK},
+		{"batch forget short", batchForgetMessage(3, 2), EINVAL},
+		{"batch forget huge", batchForgetMessage(1<<31, 0), EINVAL},
+		{"read", readMessage(4096), OK},
+		{"read too large", readMessage(1 << 31), EINVAL},
+	} {
+		req := parseMessage(tc.buf)
+		if req.inHeader == nil {
+			t.Errorf("%s: header not parsed", tc.name)
+			continue
+		}
+		if req.status != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, req.status, tc.want)
+		}
+		if req.handler == nil {
+			t.Errorf("%s: no handler", tc.name)
+		}
+	}
+
+	if req := parseMessage(make([]byte, 10)); req.inHeader != nil || req.status != EINVAL {
+		t.Errorf("short header: got %v, header %v", req.status, req.inHeader)
+	}
+}
+
+func TestParseRename(t *testing.T) {
+	buf := message(_OP_RENAME, unsafe.Sizeof(_Rename1In{}), []byte("a\x00b\x00"))
+	(*_Rename1In)(unsafe.Pointer(&buf[0])).Newdir = 7
+	req := parseMessage(buf)
+	if !req.status.Ok() {
+		t.Fatalf("parse: %v", req.status)
+	}
+	in := (*RenameIn)(req.inData)
+	if &in.InHeader != req.inHeader {
+		t.Errorf("RenameIn does not embed the request header")
+	}
+	if in.Newdir != 7 || in.Flags != 0 || in.Unique != 1 {
+		t.Errorf("got %v", in)
+	}
+
+	ms := &Server{}
+	ms.registerInflight(req, 0)
+	defer ms.unregisterInflight(req)
+	ms.interrupt(1)
+	if !ms.Context(&in.InHeader).Interrupted() {
+		t.Errorf("interrupt did not reach the RENAME")
+	}
+}
+
+type nullStream struct{}
+
+func (nullStream) Read([]byte) (int, error)    { return 0, io.EOF }
+func (nullStream) Write(b []byte) (int, error) { return len(b), nil }
+
+func FuzzParse(f *testing.F) {
+	for _, seed := range [][]byte{
+		initMessage(1),
+		getAttrMessage(2, FUSE_ROOT_ID),
+		message(_OP_LOOKUP, 0, []byte("file\x00")),
+		message(_OP_SYMLINK, 0, []byte("link\x00target\x00")),
+		message(_OP_RENAME2, unsafe.Sizeof(RenameIn{}), []byte("a\x00b\x00")),
+		writeMessage(3, []byte("abc")),
+		setXAttrMessage(1, []byte("user.x\x00v")),
+		batchForgetMessage(1, 1),
+		readMessage(4096),
+		message(_OP_IOCTL, unsafe.Sizeof(IoctlIn{}), nil),
+		message(_OP_NOTIFY_REPLY, unsafe.Sizeof(NotifyRetrieveIn{}), []byte("data")),
+	} {
+		f.Add(seed)
+	}
+
+	ms := NewServerStream(NewDefaultRawFileSystem(), nullStream{}, nil)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		req := parseMessage(append([]byte(nil), data...))
+		if req.inHeader == nil {
+			if len(data) >= int(unsafe.Sizeof(InHeader{})) {
+				t.Fatalf("header not parsed from %d bytes", len(data))
+			}
+			return
+		}
+		if req.status.Ok() {
+			if req.handler.FileNames != len(req.filenames) {
+				t.Fatalf("got %d names, want %d", len(req.filenames), req.handler.FileNames)
+			}
+			req.InputDebug()
+		}
+
+		// Run the handlers too, as they look at the data that
+		// follows the fixed size input.
+		req = &request{}
+		req.setInput(append([]byte(nil), data...))
+		ms.handleRequest(req)
+	})
+}
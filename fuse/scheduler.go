@@ -0,0 +1,298 @@
+package fuse
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"unsafe"
+)
+
+// HandlerStats describes the requests that are being handled, and
+// the requests that wait for a handler because of the limits in
+// MountOptions.
+type HandlerStats struct {
+	// Requests being handled, and how many of them are data
+	// requests.
+	Active     int
+	ActiveData int
+
+	// Requests waiting for a handler, and how many of them are
+	// data requests.
+	Queued     int
+	QueuedData int
+
+	// The largest number of requests that waited at the same time.
+	MaxQueued int
+
+	// The number of requests that had to wait.
+	TotalQueued uint64
+}
+
+func (s HandlerStats) String() string {
+	return fmt.Sprintf("active %d (data %d) queued %d (data %d, max %d, total %d)",
+		s.Active, s.ActiveData, s.Queued, s.QueuedData, s.MaxQueued, s.TotalQueued)
+}
+
+type pendingRequest struct {
+	req *request
+	op  int32
+}
+
+// The default for MountOptions.MaxQueued.
+const _DEFAULT_MAX_QUEUED = 256
+
+// scheduler bounds the number of requests that are handled
+// concurrently. Requests that would exceed a limit are queued, and
+// the goroutine that read them goes back to reading, so queued
+// requests do not hold on to goroutines. A handler that finishes
+// picks up queued requests, metadata requests first. If the queue
+// is full, the reader waits for room instead.
+type scheduler struct {
+	maxHandlers int
+	maxData     int
+	maxQueued   int
+	// By opcode; 0 is no limit.
+	opLimits []int
+
+	mu       sync.Mutex
+	stats    HandlerStats
+	activeOp []int
+	metadata []pendingRequest
+	data     []pendingRequest
+
+	// Signaled when queued requests are taken.
+	taken *sync.Cond
+}
+
+func newScheduler(opts *MountOptions) *scheduler {
+	s := &scheduler{
+		maxHandlers: opts.MaxHandlers,
+		maxData:     opts.MaxDataHandlers,
+		maxQueued:   opts.MaxQueued,
+		opLimits:    make([]int, _OPCODE_COUNT),
+		activeOp:    make([]int, _OPCODE_COUNT),
+	}
+	if s.maxQueued <= 0 {
+		s.maxQueued = _DEFAULT_MAX_QUEUED
+	}
+	s.taken = sync.NewCond(&s.mu)
+	for name, limit := range opts.OpcodeLimits {
+		op := opcodeByName(name)
+		if op < 0 {
+			log.Printf("OpcodeLimits: unknown opcode %q", name)
+			continue
+		}
+		s.opLimits[op] = limit
+	}
+	return s
+}
+
+// opcodeByName returns the opcode with the given name, or -1.
+func opcodeByName(name string) int32 {
+	for op, h := range operationHandlers {
+		if h.Name == name {
+			return int32(op)
+		}
+	}
+	return -1
+}
+
+// peekOpcode returns the opcode of an unparsed request, or -1 if
+// the request is too short or the opcode unknown.
+func peekOpcode(req *request) int32 {
+	if len(req.inputBuf) < int(unsafe.Sizeof(InHeader{})) {
+		return -1
+	}
+	op := (*InHeader)(unsafe.Pointer(&req.inputBuf[0])).Opcode
+	if getHandler(op) == nil {
+		return -1
+	}
+	return op
+}
+
+// unlimited returns true for requests that are never queued: they
+// are cheap, and queueing them could deadlock the protocol. SETLKW
+// waits for another process to release a lock, so it must not take
+// the slot that the release would need.
+func unlimited(op int32) bool {
+	switch op {
+	case -1, _OP_INIT, _OP_DESTROY, _OP_FORGET, _OP_BATCH_FORGET,
+		_OP_INTERRUPT, _OP_NOTIFY_REPLY, _OP_SETLKW:
+		return true
+	}
+	return false
+}
+
+func isDataOp(op int32) bool {
+	return op >= 0 && operationHandlers[op].DataOp
+}
+
+func (s *scheduler) canAdmit(op int32) bool {
+	if s.maxHandlers > 0 && s.stats.Active >= s.maxHandlers {
+		return false
+	}
+	if s.maxData > 0 && isDataOp(op) && s.stats.ActiveData >= s.maxData {
+		return false
+	}
+	if l := s.opLimits[op]; l > 0 && s.activeOp[op] >= l {
+		return false
+	}
+	return true
+}
+
+func (s *scheduler) admit(op int32) {
+	s.stats.Active++
+	if isDataOp(op) {
+		s.stats.ActiveData++
+	}
+	s.activeOp[op]++
+}
+
+func (s *scheduler) release(op int32) {
+	s.stats.Active--
+	if isDataOp(op) {
+		s.stats.ActiveData--
+	}
+	s.activeOp[op]--
+}
+
+func (s *scheduler) enqueue(req *request, op int32) {
+	if isDataOp(op) {
+		s.data = append(s.data, pendingRequest{req, op})
+		s.stats.QueuedData++
+	} else {
+		s.metadata = append(s.metadata, pendingRequest{req, op})
+	}
+	s.stats.Queued++
+	s.stats.TotalQueued++
+	if s.stats.Queued > s.stats.MaxQueued {
+		s.stats.MaxQueued = s.stats.Queued
+	}
+}
+
+// takeAdmissible admits and removes the queued requests that fit
+// within the limits now, metadata requests first.
+func (s *scheduler) takeAdmissible() []pendingRequest {
+	if s.stats.Queued == 0 {
+		return nil
+	}
+	var result []pendingRequest
+	s.metadata = s.take(s.metadata, &result)
+	s.data = s.take(s.data, &result)
+	if len(result) > 0 {
+		s.taken.Broadcast()
+	}
+	return result
+}
+
+// take moves the admissible requests of q to result, and returns
+// the rest.
+func (s *scheduler) take(q []pendingRequest, result *[]pendingRequest) []pendingRequest {
+	kept := q[:0]
+	for _, p := range q {
+		if !s.canAdmit(p.op) {
+			kept = append(kept, p)
+			continue
+		}
+		s.admit(p.op)
+		*result = append(*result, p)
+		s.stats.Queued--
+		if isDataOp(p.op) {
+			s.stats.QueuedData--
+		}
+	}
+	for i := len(kept); i < len(q); i++ {
+		q[i] = pendingRequest{}
+	}
+	return kept
+}
+
+// dispatch handles req, or queues it if that would exceed the
+// limits. It is called by the reader of req, which only starts
+// another reader if it handles req itself.
+func (ms *Server) dispatch(req *request) {
+	ms.drain.received()
+	s := ms.scheduler
+	op := peekOpcode(req)
+	if unlimited(op) {
+		ms.startReader(req.queue)
+		ms.handleRequest(req)
+		return
+	}
+
+	s.mu.Lock()
+	if !s.canAdmit(op) {
+		ms.compactInput(req)
+		// INTERRUPT must find the request while it waits.
+		req.inHeader = (*InHeader)(unsafe.Pointer(&req.inputBuf[0]))
+		req.queued = true
+		ms.registerInflight(req, 0)
+		for s.stats.Queued >= s.maxQueued && !s.canAdmit(op) {
+			s.taken.Wait()
+		}
+		if !s.canAdmit(op) {
+			s.enqueue(req, op)
+			s.mu.Unlock()
+			return
+		}
+	}
+	s.admit(op)
+	s.mu.Unlock()
+	ms.startReader(req.queue)
+	ms.runAdmitted(req, op)
+}
+
+// compactInput copies the message of a request that is about to be
+// queued out of its read buffer, which is MaxWrite plus a page, and
+// returns the buffer to the pool. The queue then only holds on to
+// the bytes of its messages.
+func (ms *Server) compactInput(req *request) {
+	buf := req.bufferPoolInputBuf
+	if buf == nil {
+		// Small messages are copied already.
+		return
+	}
+	req.inputBuf = make([]byte, len(buf))
+	copy(req.inputBuf, buf)
+	req.bufferPoolInputBuf = nil
+
+	q := req.queue
+	q.mu.Lock()
+	q.readPool = append(q.readPool, buf[:cap(buf)])
+	q.outstandingReadBufs--
+	q.mu.Unlock()
+}
+
+// runAdmitted handles an admitted request, and then the queued
+// requests that its slot frees up.
+func (ms *Server) runAdmitted(req *request, op int32) {
+	s := ms.scheduler
+	for {
+		ms.handleRequest(req)
+
+		s.mu.Lock()
+		s.release(op)
+		next := s.takeAdmissible()
+		s.mu.Unlock()
+
+		if len(next) == 0 {
+			return
+		}
+		for _, p := range next[1:] {
+			ms.loops.Add(1)
+			go func(p pendingRequest) {
+				defer ms.loops.Done()
+				ms.runAdmitted(p.req, p.op)
+			}(p)
+		}
+		req, op = next[0].req, next[0].op
+	}
+}
+
+// HandlerStats returns the number of requests that are being
+// handled, and that wait for a handler.
+func (ms *Server) HandlerStats() HandlerStats {
+	ms.scheduler.mu.Lock()
+	defer ms.scheduler.mu.Unlock()
+	return ms.scheduler.stats
+}
@@ -0,0 +1,287 @@
+package fuse
+
+import (
+	"net"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// slowReadFS blocks reads until release is closed.
+type slowReadFS struct {
+	attrFS
+	release chan struct{}
+}
+
+func (fs *slowReadFS) Read(input *ReadIn, buf []byte) (ReadResult, Status) {
+	<-fs.release
+	return ReadResultData([]byte("data")), OK
+}
+
+func withUnique(buf []byte, unique uint64) []byte {
+	(*InHeader)(unsafe.Pointer(&buf[0])).Unique = unique
+	return buf
+}
+
+func waitStats(t *testing.T, ms *Server, ok func(s HandlerStats) bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !ok(ms.HandlerStats()) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out; stats: %v", ms.HandlerStats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMaxDataHandlers(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	fs := &slowReadFS{
+		attrFS:  attrFS{NewDefaultRawFileSystem()},
+		release: make(chan struct{}),
+	}
+	ms := NewServerStream(fs, conn, &MountOptions{
+		MaxHandlers:     2,
+		MaxDataHandlers: 1,
+	})
+	go ms.Serve()
+
+	client.Write(initMessage(1))
+	readReply(t, client)
+	ms.WaitMount()
+
+	client.Write(withUnique(readMessage(4096), 2))
+	waitStats(t, ms, func(s HandlerStats) bool { return s.ActiveData == 1 })
+	client.Write(withUnique(readMessage(4096), 4))
+	waitStats(t, ms, func(s HandlerStats) bool { return s.QueuedData == 1 })
+
+	// The second read waits, but metadata requests get through.
+	client.Write(getAttrMessage(3, FUSE_ROOT_ID))
+	if h, _ := readReply(t, client); h.Unique != 3 || h.Status != 0 {
+		t.Fatalf("got GETATTR reply %+v", h)
+	}
+
+	close(fs.release)
+	for i := 0; i < 2; i++ {
+		if h, data := readReply(t, client); h.Status != 0 || string(data) != "data" {
+			t.Errorf("got READ reply %+v %q", h, data)
+		}
+	}
+	waitStats(t, ms, func(s HandlerStats) bool { return s.Active == 0 })
+	if s := ms.HandlerStats(); s.Queued != 0 || s.MaxQueued != 1 || s.TotalQueued != 1 {
+		t.Errorf("got stats %v", s)
+	}
+}
+
+// lockFS blocks SETLKW until a SETLK releases the lock.
+type lockFS struct {
+	attrFS
+	unlocked chan struct{}
+}
+
+func (fs *lockFS) SetLkw(input *LkIn) Status {
+	<-fs.unlocked
+	return OK
+}
+
+func (fs *lockFS) SetLk(input *LkIn) Status {
+	close(fs.unlocked)
+	return OK
+}
+
+func TestBlockedLocksDoNotFillHandlers(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	fs := &lockFS{
+		attrFS:   attrFS{NewDefaultRawFileSystem()},
+		unlocked: make(chan struct{}),
+	}
+	ms := NewServerStream(fs, conn, &MountOptions{MaxHandlers: 1})
+	go ms.Serve()
+
+	client.Write(initMessage(1))
+	readReply(t, client)
+	ms.WaitMount()
+
+	for _, unique := range []uint64{2, 4} {
+		client.Write(withUnique(message(_OP_SETLKW, unsafe.Sizeof(LkIn{}), nil), unique))
+	}
+	// The unlock must be admitted, although two lock requests wait.
+	client.Write(withUnique(message(_OP_SETLK, unsafe.Sizeof(LkIn{}), nil), 6))
+
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	got := map[uint64]int32{}
+	for i := 0; i < 3; i++ {
+		h, _ := readReply(t, client)
+		got[h.Unique] = h.Status
+	}
+	if len(got) != 3 || got[2] != 0 || got[4] != 0 || got[6] != 0 {
+		t.Errorf("got replies %v", got)
+	}
+	if s := ms.HandlerStats(); s.TotalQueued != 0 {
+		t.Errorf("got stats %v, want nothing queued", s)
+	}
+}
+
+func TestQueuedRequestReleasesReadBuffer(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	fs := &slowReadFS{
+		attrFS:  attrFS{NewDefaultRawFileSystem()},
+		release: make(chan struct{}),
+	}
+	ms := NewServerStream(fs, conn, &MountOptions{MaxDataHandlers: 1})
+	go ms.Serve()
+
+	client.Write(initMessage(1))
+	readReply(t, client)
+	ms.WaitMount()
+
+	client.Write(withUnique(readMessage(4096), 2))
+	waitStats(t, ms, func(s HandlerStats) bool { return s.ActiveData == 1 })
+	write := withUnique(writeMessage(4096, make([]byte, 4096)), 4)
+	client.Write(write)
+	waitStats(t, ms, func(s HandlerStats) bool { return s.QueuedData == 1 })
+
+	ms.scheduler.mu.Lock()
+	req := ms.scheduler.data[0].req
+	if cap(req.inputBuf) != len(write) || req.bufferPoolInputBuf != nil {
+		t.Errorf("queued WRITE of %d bytes holds a buffer of %d", len(write), cap(req.inputBuf))
+	}
+	ms.scheduler.mu.Unlock()
+
+	close(fs.release)
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	got := map[uint64]bool{}
+	for i := 0; i < 2; i++ {
+		h, _ := readReply(t, client)
+		got[h.Unique] = true
+	}
+	if !got[2] || !got[4] {
+		t.Errorf("got replies for %v", got)
+	}
+}
+
+func TestOpcodeLimits(t *testing.T) {
+	s := newScheduler(&MountOptions{
+		OpcodeLimits: map[string]int{"LOOKUP": 1},
+	})
+	if !s.canAdmit(_OP_LOOKUP) {
+		t.Fatal("cannot admit first LOOKUP")
+	}
+	s.admit(_OP_LOOKUP)
+	if s.canAdmit(_OP_LOOKUP) {
+		t.Error("admitted second LOOKUP")
+	}
+	if !s.canAdmit(_OP_GETATTR) {
+		t.Error("cannot admit GETATTR")
+	}
+	s.release(_OP_LOOKUP)
+	if !s.canAdmit(_OP_LOOKUP) {
+		t.Error("cannot admit LOOKUP after release")
+	}
+}
+
+func TestQueuedInterrupt(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	fs := &slowReadFS{
+		attrFS:  attrFS{NewDefaultRawFileSystem()},
+		release: make(chan struct{}),
+	}
+	ms := NewServerStream(fs, conn, &MountOptions{MaxDataHandlers: 1})
+	go ms.Serve()
+
+	client.Write(initMessage(1))
+	readReply(t, client)
+	ms.WaitMount()
+
+	client.Write(withUnique(readMessage(4096), 2))
+	waitStats(t, ms, func(s HandlerStats) bool { return s.ActiveData == 1 })
+	client.Write(withUnique(readMessage(4096), 4))
+	waitStats(t, ms, func(s HandlerStats) bool { return s.QueuedData == 1 })
+
+	intr := message(_OP_INTERRUPT, unsafe.Sizeof(InterruptIn{}), nil)
+	(*InterruptIn)(unsafe.Pointer(&intr[0])).Unique = 4
+	client.Write(withUnique(intr, 6))
+
+	// Successful interrupts are not answered, so the next reply
+	// is GETATTR.
+	client.Write(getAttrMessage(3, FUSE_ROOT_ID))
+	if h, _ := readReply(t, client); h.Unique != 3 {
+		t.Fatalf("got reply %+v, want GETATTR", h)
+	}
+
+	close(fs.release)
+	got := map[uint64]int32{}
+	for i := 0; i < 2; i++ {
+		h, _ := readReply(t, client)
+		got[h.Unique] = h.Status
+	}
+	if got[2] != 0 || got[4] != -int32(EINTR) {
+		t.Errorf("got statuses %v, want READ 4 to fail with EINTR", got)
+	}
+}
+
+func TestMaxQueued(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	fs := &slowReadFS{
+		attrFS:  attrFS{NewDefaultRawFileSystem()},
+		release: make(chan struct{}),
+	}
+	ms := NewServerStream(fs, conn, &MountOptions{
+		MaxDataHandlers: 1,
+		MaxQueued:       1,
+	})
+	go ms.Serve()
+
+	client.Write(initMessage(1))
+	readReply(t, client)
+	ms.WaitMount()
+
+	client.Write(withUnique(readMessage(4096), 2))
+	waitStats(t, ms, func(s HandlerStats) bool { return s.ActiveData == 1 })
+	client.Write(withUnique(readMessage(4096), 4))
+	waitStats(t, ms, func(s HandlerStats) bool { return s.QueuedData == 1 })
+
+	// The queue is full, so readers wait with the READ they read,
+	// and reading stops once every reader holds one.
+	sent := 2
+	for {
+		written := make(chan struct{})
+		go func(unique uint64) {
+			client.Write(withUnique(readMessage(4096), unique))
+			close(written)
+		}(uint64(2 * (sent + 1)))
+		select {
+		case <-written:
+			sent++
+			if sent > 10 {
+				t.Fatal("server keeps reading while the queue is full")
+			}
+			continue
+		case <-time.After(50 * time.Millisecond):
+		}
+		break
+	}
+	if s := ms.HandlerStats(); s.Queued != 1 {
+		t.Errorf("got stats %v", s)
+	}
+
+	close(fs.release)
+	got := map[uint64]bool{}
+	for i := 0; i < sent+1; i++ {
+		h, _ := readReply(t, client)
+		if h.Status != 0 {
+			t.Errorf("got reply %+v", h)
+		}
+		got[h.Unique] = true
+	}
+	if len(got) != sent+1 {
+		t.Errorf("got replies for %v", got)
+	}
+	if s := ms.HandlerStats(); s.MaxQueued != 1 {
+		t.Errorf("got stats %v", s)
+	}
+}
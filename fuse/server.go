@@ -2,19 +2,27 @@ package fuse
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 	"unsafe"
+
+	"github.com/hanwen/go-fuse/splice"
 )
 
 const (
-	// The kernel caps writes at 128k.
+	// The kernel caps writes at 128k, unless it supports
+	// CAP_MAX_PAGES.
 	MAX_KERNEL_WRITE = 128 * 1024
+
+	// The kernel caps writes at 1M if it supports CAP_MAX_PAGES.
+	MAX_KERNEL_WRITE_MAX_PAGES = 1024 * 1024
 )
 
 // Server contains the logic for reading from the FUSE device and
@@ -22,29 +30,72 @@ const (
 type Server struct {
 	// Empty if unmounted.
 	mountPoint string
+
+	// Device number of the mount, which names its fusectl
+	// directory. 0 if unknown.
+	mountDev uint64
+
 	fileSystem RawFileSystem
 
 	// I/O with kernel and daemon.
 	mountFd int
 
+	// If set, messages are read from and written to stream rather
+	// than mountFd. See NewServerStream.
+	stream        io.ReadWriter
+	streamReadMu  sync.Mutex
+	streamWriteMu sync.Mutex
+
+	// Set if the channel is not a FUSE device, so it cannot take
+	// spliced replies or be cloned.
+	notDevice bool
+
+	// Channels that requests are read from. The first one uses
+	// mountFd; others are clones of it.
+	queues []*readQueue
+
 	// Dump debug info onto stdout.
 	debug bool
 
+	// Counts requests and open files, for Shutdown.
+	drain drainState
+
+	// Requests being handled, for INTERRUPT.
+	inflight inflightTable
+
 	latencies LatencyMap
+	tracer    Tracer
+	recorder  *recorder
 
 	opts *MountOptions
 
+	// Size of the buffers that requests are read into. INIT
+	// lowers it if the kernel cannot take large writes. Accessed
+	// atomically.
+	readBufSize int64
+
 	started chan struct{}
 
-	reqMu               sync.Mutex
-	reqPool             []*request
-	readPool            [][]byte
-	reqReaders          int
-	outstandingReadBufs int
-	kernelSettings      InitIn
+	reqMu          sync.Mutex
+	kernelSettings InitIn
+
+	// Outstanding InodeRetrieveCache calls, by notify unique.
+	// retrieveDone is set once Serve has returned, and the kernel
+	// will not answer anymore.
+	retrieveMu   sync.Mutex
+	retrieveNext uint64
+	retrieveTab  map[uint64]*retrieveCacheRequest
+	retrieveDone bool
 
 	canSplice bool
-	loops     sync.WaitGroup
+
+	// Set if requests are spliced from the device, see
+	// MountOptions.EnableSpliceWrites.
+	spliceWrites bool
+	loops        sync.WaitGroup
+
+	// Enforces MountOptions.MaxHandlers and related limits.
+	scheduler *scheduler
 }
 
 func (ms *Server) SetDebug(dbg bool) {
@@ -76,16 +127,19 @@ func (ms *Server) RecordLatencies(l LatencyMap) {
 	ms.latencies = l
 }
 
-// Unmount calls fusermount -u on the mount. This has the effect of
-// shutting down the filesystem. After the Server is unmounted, it
-// should be discarded.
+// Unmount calls fusermount -u on the mount, or umount2(2) for
+// MountOptions.DirectMount and when running as root. This has the
+// effect of shutting down the filesystem. After the Server is
+// unmounted, it should be discarded. If files are still open, it
+// fails with an error wrapping ErrBusy; see Shutdown for waiting for
+// them to be closed.
 func (ms *Server) Unmount() (err error) {
 	if ms.mountPoint == "" {
 		return nil
 	}
 	delay := time.Duration(0)
 	for try := 0; try < 5; try++ {
-		err = unmount(ms.mountPoint)
+		err = unmount(ms.mountPoint, ms.opts)
 		if err == nil {
 			break
 		}
@@ -105,8 +159,9 @@ func (ms *Server) Unmount() (err error) {
 	return err
 }
 
-// NewServer creates a server and attaches it to the given directory.
-func NewServer(fs RawFileSystem, mountPoint string, opts *MountOptions) (*Server, error) {
+// newServer returns a Server for fs, with the options filled in.
+// The caller must set up the channel to the kernel.
+func newServer(fs RawFileSystem, opts *MountOptions) *Server {
 	if opts == nil {
 		opts = &MountOptions{
 			MaxBackground: _DEFAULT_BACKGROUND_TASKS,
@@ -126,31 +181,31 @@ func NewServer(fs RawFileSystem, mountPoint string, opts *MountOptions) (*Server
 	if o.MaxWrite == 0 {
 		o.MaxWrite = 1 << 16
 	}
-	if o.MaxWrite > MAX_KERNEL_WRITE {
-		o.MaxWrite = MAX_KERNEL_WRITE
+	if o.MaxWrite > MAX_KERNEL_WRITE_MAX_PAGES {
+		o.MaxWrite = MAX_KERNEL_WRITE_MAX_PAGES
 	}
-	opts = &o
-	ms := &Server{
-		fileSystem: fs,
-		started:    make(chan struct{}),
-		opts:       &o,
+	if o.MaxReaders <= 0 {
+		o.MaxReaders = _MAX_READERS
 	}
-
-	optStrs := opts.Options
-	if opts.AllowOther {
-		optStrs = append(optStrs, "allow_other")
+	return &Server{
+		fileSystem:  fs,
+		started:     make(chan struct{}),
+		opts:        &o,
+		mountFd:     -1,
+		scheduler:   newScheduler(&o),
+		readBufSize: int64(o.MaxWrite + PAGESIZE),
 	}
+}
 
-	name := opts.Name
-	if name == "" {
-		name = ms.fileSystem.String()
-		l := len(name)
-		if l > _MAX_NAME_LEN {
-			l = _MAX_NAME_LEN
-		}
-		name = strings.Replace(name[:l], ",", ";", -1)
+// NewServer creates a server and attaches it to the given directory.
+func NewServer(fs RawFileSystem, mountPoint string, opts *MountOptions) (*Server, error) {
+	ms := newServer(fs, opts)
+	opts = ms.opts
+
+	optStrs, err := opts.optionStrings(ms.fileSystem.String())
+	if err != nil {
+		return nil, err
 	}
-	optStrs = append(optStrs, "subtype="+name)
 
 	mountPoint = filepath.Clean(mountPoint)
 	if !filepath.IsAbs(mountPoint) {
@@ -160,92 +215,266 @@ func NewServer(fs RawFileSystem, mountPoint string, opts *MountOptions) (*Server
 		}
 		mountPoint = filepath.Clean(filepath.Join(cwd, mountPoint))
 	}
-	fd, err := mount(mountPoint, strings.Join(optStrs, ","))
+	if opts.CleanupStaleMount {
+		if _, err := CleanupStaleMount(mountPoint); err != nil {
+			return nil, err
+		}
+	}
+	fd, err := mount(mountPoint, opts, strings.Join(optStrs, ","))
 	if err != nil {
 		return nil, err
 	}
 
 	ms.fileSystem.Init(ms)
 	ms.mountPoint = mountPoint
+	ms.mountDev = mountDevice(mountPoint)
+	ms.mountFd = fd
+	ms.setupQueues()
+	return ms, nil
+}
+
+// NewServerFd creates a server for a FUSE channel that was opened
+// elsewhere, eg. a /dev/fuse descriptor handed over by a mount
+// helper or a supervisor process. The fd must keep message
+// boundaries, so besides /dev/fuse, a SOCK_SEQPACKET socket works.
+//
+// The Server takes ownership of fd, and closes it when Serve
+// returns. Since the Server did not mount the file system, Unmount
+// does nothing; Serve returns once the kernel or the peer closes the
+// channel.
+func NewServerFd(fs RawFileSystem, fd int, opts *MountOptions) (*Server, error) {
+	var st syscall.Stat_t
+	if err := syscall.Fstat(fd, &st); err != nil {
+		return nil, os.NewSyscallError("fstat", err)
+	}
+
+	ms := newServer(fs, opts)
 	ms.mountFd = fd
+	ms.notDevice = uint32(st.Mode)&syscall.S_IFMT != syscall.S_IFCHR
+	ms.fileSystem.Init(ms)
+	ms.setupQueues()
 	return ms, nil
 }
 
+// NewServerStream creates a server that speaks the FUSE protocol over
+// a byte stream, eg. a pipe or a TCP connection. Messages in either
+// direction are delimited by the length field of their header.
+//
+// Serve returns when reading from rw returns io.EOF. If rw
+// implements io.Closer, it is closed when Serve returns. Unmount does
+// nothing.
+func NewServerStream(fs RawFileSystem, rw io.ReadWriter, opts *MountOptions) *Server {
+	ms := newServer(fs, opts)
+	ms.stream = rw
+	ms.notDevice = true
+	ms.fileSystem.Init(ms)
+	ms.setupQueues()
+	return ms
+}
+
+// readQueue is a channel to the kernel, with its own readers and
+// pools, so readers of different queues do not contend.
+type readQueue struct {
+	fd int
+
+	mu                  sync.Mutex
+	reqPool             []*request
+	readPool            [][]byte
+	readers             int
+	outstandingReadBufs int
+}
+
+// setupQueues clones the device for each extra queue asked for in
+// the options. If the kernel does not support cloning, we use a
+// single queue.
+func (ms *Server) setupQueues() {
+	// Readers consult the splice settings without locking, so
+	// they must be fixed before Serve starts them.
+	ms.setSplice()
+
+	ms.queues = []*readQueue{{fd: ms.mountFd}}
+	if ms.notDevice {
+		return
+	}
+	for len(ms.queues) < ms.opts.Queues {
+		fd, err := cloneDevice(ms.mountFd)
+		if err != nil {
+			log.Printf("cloning FUSE device failed, using %d queue(s): %v",
+				len(ms.queues), err)
+			return
+		}
+		ms.queues = append(ms.queues, &readQueue{fd: fd})
+	}
+}
+
 // DebugData returns internal status information for debugging
 // purposes.
 func (ms *Server) DebugData() string {
 	s := ms.opts.Buffers.String()
 
 	var r int
-	ms.reqMu.Lock()
-	r = len(ms.readPool) + ms.reqReaders
-	ms.reqMu.Unlock()
+	for _, q := range ms.queues {
+		q.mu.Lock()
+		r += len(q.readPool) + q.readers
+		q.mu.Unlock()
+	}
 
-	s += fmt.Sprintf(" read buffers: %d (sz %d )",
-		r, ms.opts.MaxWrite/PAGESIZE+1)
+	s += fmt.Sprintf(" read buffers: %d (sz %d ) queues: %d handlers: %v",
+		r, atomic.LoadInt64(&ms.readBufSize)/PAGESIZE, len(ms.queues), ms.HandlerStats())
+	for _, r := range ms.SlowRequests() {
+		s += fmt.Sprintf("\nslow request: %v\n%s", &r, r.Stack)
+	}
 	return s
 }
 
 // What is a good number?  Maybe the number of CPUs?
 const _MAX_READERS = 2
 
+// replyFd returns the fd to write the reply for req to. The kernel
+// only accepts replies on the queue that the request was read from.
+func (ms *Server) replyFd(req *request) int {
+	if req.queue != nil {
+		return req.queue.fd
+	}
+	return ms.mountFd
+}
+
 // Returns a new request, or error. In case exitIdle is given, returns
 // nil, OK if we have too many readers already.
-func (ms *Server) readRequest(exitIdle bool) (req *request, code Status) {
+func (ms *Server) readRequest(q *readQueue, exitIdle bool) (req *request, code Status) {
 	var dest []byte
 
-	ms.reqMu.Lock()
-	if ms.reqReaders > _MAX_READERS {
-		ms.reqMu.Unlock()
+	q.mu.Lock()
+	if q.readers > ms.opts.MaxReaders {
+		q.mu.Unlock()
 		return nil, OK
 	}
-	l := len(ms.reqPool)
+	l := len(q.reqPool)
 	if l > 0 {
-		req = ms.reqPool[l-1]
-		ms.reqPool = ms.reqPool[:l-1]
+		req = q.reqPool[l-1]
+		q.reqPool = q.reqPool[:l-1]
 	} else {
 		req = new(request)
 	}
-	l = len(ms.readPool)
+	l = len(q.readPool)
 	if l > 0 {
-		dest = ms.readPool[l-1]
-		ms.readPool = ms.readPool[:l-1]
+		dest = q.readPool[l-1]
+		q.readPool = q.readPool[:l-1]
+	}
+	if sz := int(atomic.LoadInt64(&ms.readBufSize)); len(dest) != sz {
+		// Buffers from before INIT may be too large.
+		dest = make([]byte, sz)
+	}
+	q.outstandingReadBufs++
+	q.readers++
+	q.mu.Unlock()
+
+	var n int
+	var err error
+	var pipe *WritePipe
+	if ms.stream != nil {
+		n, err = ms.readStream(dest)
+	} else if ms.spliceWrites && ms.recorder == nil {
+		n, pipe, err = ms.readSplice(q.fd, dest)
 	} else {
-		dest = make([]byte, ms.opts.MaxWrite+PAGESIZE)
+		n, err = syscall.Read(q.fd, dest)
+		if err == nil && n == 0 {
+			// The peer closed a socket channel.
+			err = io.EOF
+		}
 	}
-	ms.outstandingReadBufs++
-	ms.reqReaders++
-	ms.reqMu.Unlock()
-
-	n, err := syscall.Read(ms.mountFd, dest)
 	if err != nil {
-		code = ToStatus(err)
-		ms.reqMu.Lock()
-		ms.reqPool = append(ms.reqPool, req)
-		ms.reqReaders--
-		ms.reqMu.Unlock()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			code = ENODEV
+		} else {
+			code = ToStatus(err)
+		}
+		q.mu.Lock()
+		q.reqPool = append(q.reqPool, req)
+		q.readers--
+		q.mu.Unlock()
 		return nil, code
 	}
 
-	if ms.latencies != nil {
+	if ms.latencies != nil || ms.tracer != nil || ms.opts.SlowRequestThreshold > 0 {
 		req.startTime = time.Now()
 	}
 	gobbled := req.setInput(dest[:n])
+	req.queue = q
+	req.writePipe = pipe
 
-	ms.reqMu.Lock()
+	q.mu.Lock()
 	if !gobbled {
-		ms.outstandingReadBufs--
-		ms.readPool = append(ms.readPool, dest)
+		q.outstandingReadBufs--
+		q.readPool = append(q.readPool, dest)
 		dest = nil
 	}
-	ms.reqReaders--
-	if ms.reqReaders <= 0 {
+	q.readers--
+	q.mu.Unlock()
+
+	return req, OK
+}
+
+// startReader starts a reader for q if there is none, so requests
+// keep being read while the calling goroutine handles one.
+func (ms *Server) startReader(q *readQueue) {
+	q.mu.Lock()
+	if q.readers <= 0 {
 		ms.loops.Add(1)
-		go ms.loop(true)
+		go ms.loop(q, true)
 	}
-	ms.reqMu.Unlock()
+	q.mu.Unlock()
+}
 
-	return req, OK
+// readStream reads a single message from the stream into dest.
+func (ms *Server) readStream(dest []byte) (int, error) {
+	ms.streamReadMu.Lock()
+	defer ms.streamReadMu.Unlock()
+
+	hdrSize := int(unsafe.Sizeof(InHeader{}))
+	if _, err := io.ReadFull(ms.stream, dest[:hdrSize]); err != nil {
+		return 0, err
+	}
+	n := int((*InHeader)(unsafe.Pointer(&dest[0])).Length)
+	if n < hdrSize || n > len(dest) {
+		// We can't find the next message, so give up on
+		// the stream.
+		log.Printf("bad message length %d on stream", n)
+		return 0, syscall.EIO
+	}
+	if _, err := io.ReadFull(ms.stream, dest[hdrSize:n]); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// writeStream writes a reply or notification to the stream as a
+// single message.
+func (ms *Server) writeStream(req *request, header []byte) Status {
+	if req.fdData != nil {
+		sz := req.flatDataSize()
+		buf := ms.allocOut(req, uint32(sz))
+		req.flatData, req.status = req.fdData.Bytes(buf)
+		header = req.serializeHeader(len(req.flatData))
+	}
+
+	msg := header
+	if len(req.flatData) > 0 {
+		msg = make([]byte, 0, len(header)+len(req.flatData))
+		msg = append(msg, header...)
+		msg = append(msg, req.flatData...)
+	}
+
+	ms.streamWriteMu.Lock()
+	_, err := ms.stream.Write(msg)
+	ms.streamWriteMu.Unlock()
+	if req.readResult != nil {
+		req.readResult.Done()
+	}
+	if err != nil {
+		return EIO
+	}
+	return OK
 }
 
 // returnRequest returns a request to the pool of unused requests.
@@ -257,19 +486,26 @@ func (ms *Server) returnRequest(req *request) {
 		req.bufferPoolOutputBuf = nil
 	}
 
+	if req.writePipe != nil {
+		splice.Done(req.writePipe.pair)
+	}
+	q := req.queue
 	req.clear()
-	ms.reqMu.Lock()
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
 	if req.bufferPoolOutputBuf != nil {
-		ms.readPool = append(ms.readPool, req.bufferPoolInputBuf)
-		ms.outstandingReadBufs--
+		q.readPool = append(q.readPool, req.bufferPoolInputBuf)
+		q.outstandingReadBufs--
 		req.bufferPoolInputBuf = nil
 	}
-	ms.reqPool = append(ms.reqPool, req)
-	ms.reqMu.Unlock()
+	q.reqPool = append(q.reqPool, req)
+	q.mu.Unlock()
 }
 
 func (ms *Server) recordStats(req *request) {
-	if ms.latencies != nil {
+	if ms.latencies != nil && req.inHeader != nil {
 		dt := time.Now().Sub(req.startTime)
 		opname := operationName(req.inHeader.Opcode)
 		ms.latencies.Add(opname, dt)
@@ -282,20 +518,47 @@ func (ms *Server) recordStats(req *request) {
 //
 // Each filesystem operation executes in a separate goroutine.
 func (ms *Server) Serve() {
+	if ms.opts.SlowRequestThreshold > 0 && ms.opts.OnSlowRequest != nil {
+		stop := make(chan struct{})
+		defer close(stop)
+		go ms.watchdog(stop)
+	}
+	for _, q := range ms.queues[1:] {
+		ms.loops.Add(1)
+		go ms.loop(q, false)
+	}
 	ms.loops.Add(1)
-	ms.loop(false)
+	ms.loop(ms.queues[0], false)
 	ms.loops.Wait()
 
+	// The kernel will not answer outstanding retrieves anymore.
+	ms.retrieveMu.Lock()
+	for unique, r := range ms.retrieveTab {
+		r.status = ENODEV
+		close(r.ready)
+		delete(ms.retrieveTab, unique)
+	}
+	ms.retrieveDone = true
+	ms.retrieveMu.Unlock()
+
 	ms.reqMu.Lock()
-	syscall.Close(ms.mountFd)
+	if ms.stream != nil {
+		if c, ok := ms.stream.(io.Closer); ok {
+			c.Close()
+		}
+	} else {
+		for _, q := range ms.queues {
+			syscall.Close(q.fd)
+		}
+	}
 	ms.reqMu.Unlock()
 }
 
-func (ms *Server) loop(exitIdle bool) {
+func (ms *Server) loop(q *readQueue, exitIdle bool) {
 	defer ms.loops.Done()
 exit:
 	for {
-		req, errNo := ms.readRequest(exitIdle)
+		req, errNo := ms.readRequest(q, exitIdle)
 		switch errNo {
 		case OK:
 			if req == nil {
@@ -311,15 +574,22 @@ exit:
 			break exit
 		}
 
-		ms.handleRequest(req)
+		ms.dispatch(req)
 	}
 }
 
 func (ms *Server) handleRequest(req *request) {
+	if ms.recorder != nil {
+		ms.recorder.record(recordRequest, req.inputBuf)
+	}
 	req.parse()
-	if req.handler == nil {
-		req.status = ENOSYS
+	if req.inHeader == nil {
+		// Without a header, we cannot reply.
+		ms.drain.done(req)
+		ms.returnRequest(req)
+		return
 	}
+	ms.drain.admit(req)
 
 	if req.status.Ok() && ms.debug {
 		log.Println(req.InputDebug())
@@ -330,15 +600,45 @@ func (ms *Server) handleRequest(req *request) {
 		req.status = ENOSYS
 	}
 
+	// Queued requests were registered by dispatch.
+	registered := req.queued
 	if req.status.Ok() {
-		req.handler.Func(ms, req)
+		// The unique of a NOTIFY_REPLY is chosen by us, and
+		// may equal that of a kernel request.
+		interruptible := req.inHeader.Opcode != _OP_FORGET &&
+			req.inHeader.Opcode != _OP_BATCH_FORGET &&
+			req.inHeader.Opcode != _OP_INTERRUPT &&
+			req.inHeader.Opcode != _OP_NOTIFY_REPLY
+		if interruptible {
+			var goroutine uint64
+			if ms.opts.SlowRequestThreshold > 0 {
+				goroutine = goroutineID()
+			}
+			ms.registerInflight(req, goroutine)
+			registered = true
+		}
+		if req.queued && ms.interrupted(req) {
+			// The caller gave up while the request waited
+			// for a handler.
+			req.status = EINTR
+		} else {
+			req.handler.Func(ms, req)
+		}
+	}
+	if registered {
+		ms.unregisterInflight(req)
 	}
 
+	ms.drain.handled(req)
 	errNo := ms.write(req)
 	if errNo != 0 {
 		log.Printf("writer: Write/Writev failed, err: %v. opcode: %v",
 			errNo, operationName(req.inHeader.Opcode))
 	}
+	if ms.tracer != nil {
+		ms.trace(req, req.status)
+	}
+	ms.drain.done(req)
 	ms.returnRequest(req)
 }
 
@@ -355,8 +655,14 @@ func (ms *Server) allocOut(req *request, size uint32) []byte {
 }
 
 func (ms *Server) write(req *request) Status {
-	// Forget does not wait for reply.
-	if req.inHeader.Opcode == _OP_FORGET || req.inHeader.Opcode == _OP_BATCH_FORGET {
+	// Forget and the answer to a retrieve do not wait for reply.
+	if req.inHeader.Opcode == _OP_FORGET || req.inHeader.Opcode == _OP_BATCH_FORGET ||
+		req.inHeader.Opcode == _OP_NOTIFY_REPLY {
+		return OK
+	}
+	// Interrupts are only answered if the kernel should retry
+	// them.
+	if req.inHeader.Opcode == _OP_INTERRUPT && req.status.Ok() {
 		return OK
 	}
 
@@ -369,9 +675,35 @@ func (ms *Server) write(req *request) Status {
 		return OK
 	}
 
+	if ms.recorder != nil && req.fdData != nil {
+		// Read the data into memory rather than splicing it,
+		// so it can be recorded.
+		buf := ms.allocOut(req, uint32(req.flatDataSize()))
+		req.flatData, req.status = req.fdData.Bytes(buf)
+		req.fdData = nil
+		header = req.serializeHeader(len(req.flatData))
+	}
+
 	s := ms.systemWrite(req, header)
+	if ms.recorder != nil {
+		kind := byte(recordReply)
+		if req.inHeader.Opcode >= _OP_NOTIFY_ENTRY {
+			kind = recordNotification
+		}
+		ms.recorder.record(kind, header, req.flatData)
+	}
+	if ms.tracer != nil && req.inHeader.Opcode >= _OP_NOTIFY_ENTRY {
+		ms.trace(req, s)
+	}
 	if req.inHeader.Opcode == _OP_INIT {
-		close(ms.started)
+		ms.reqMu.Lock()
+		select {
+		case <-ms.started:
+			// A repeated INIT; doInit has refused it.
+		default:
+			close(ms.started)
+		}
+		ms.reqMu.Unlock()
 	}
 	return s
 }
@@ -479,6 +811,149 @@ func (ms *Server) EntryNotify(parent uint64, name string) Status {
 	return result
 }
 
+// PollNotify wakes up the poll waiters registered under the kernel
+// handle kh, which was passed in a PollIn that had
+// FUSE_POLL_SCHEDULE_NOTIFY set. The kernel will then poll the file
+// again.
+func (ms *Server) PollNotify(kh uint64) Status {
+	req := request{
+		inHeader: &InHeader{
+			Opcode: _OP_NOTIFY_POLL,
+		},
+		handler: operationHandlers[_OP_NOTIFY_POLL],
+		status:  NOTIFY_POLL,
+	}
+	req.outData = unsafe.Pointer(&NotifyPollWakeupOut{Kh: kh})
+
+	// Protect against concurrent close.
+	ms.reqMu.Lock()
+	result := ms.write(&req)
+	ms.reqMu.Unlock()
+
+	if ms.debug {
+		log.Printf("Response: POLL_NOTIFY: %v", result)
+	}
+	return result
+}
+
+// InodeNotifyStoreCache stores data in the kernel's page cache for
+// the inode, starting at offset. The file size is extended if
+// needed. This way, the file system can make data available before it
+// is read.
+func (ms *Server) InodeNotifyStoreCache(node uint64, offset int64, data []byte) Status {
+	if ms.kernelSettings.Minor < 15 {
+		return ENOSYS
+	}
+
+	req := request{
+		inHeader: &InHeader{
+			Opcode: _OP_NOTIFY_STORE,
+		},
+		handler: operationHandlers[_OP_NOTIFY_STORE],
+		status:  NOTIFY_STORE,
+	}
+	req.outData = unsafe.Pointer(&NotifyStoreOut{
+		Nodeid: node,
+		Offset: uint64(offset),
+		Size:   uint32(len(data)),
+	})
+	req.flatData = data
+
+	// Protect against concurrent close.
+	ms.reqMu.Lock()
+	result := ms.write(&req)
+	ms.reqMu.Unlock()
+
+	if ms.debug {
+		log.Printf("Response: STORE_NOTIFY: %v", result)
+	}
+	return result
+}
+
+// retrieveCacheRequest is an InodeRetrieveCache call waiting for the
+// kernel's answer.
+type retrieveCacheRequest struct {
+	dest   []byte
+	n      int
+	status Status
+	ready  chan struct{}
+}
+
+// InodeRetrieveCache reads data cached by the kernel for the inode,
+// starting at offset, into dest. It returns how many bytes were
+// cached; this stops at the first page that is not in the cache.
+//
+// It waits for the kernel to answer until cancel is closed, and then
+// returns EINTR. If Serve returns first, it returns ENODEV.
+func (ms *Server) InodeRetrieveCache(node uint64, offset int64, dest []byte, cancel <-chan struct{}) (n int, st Status) {
+	if ms.kernelSettings.Minor < 15 {
+		return 0, ENOSYS
+	}
+
+	r := &retrieveCacheRequest{
+		dest:  dest,
+		ready: make(chan struct{}),
+	}
+	ms.retrieveMu.Lock()
+	if ms.retrieveDone {
+		ms.retrieveMu.Unlock()
+		return 0, ENODEV
+	}
+	if ms.retrieveTab == nil {
+		ms.retrieveTab = map[uint64]*retrieveCacheRequest{}
+	}
+	ms.retrieveNext++
+	unique := ms.retrieveNext
+	ms.retrieveTab[unique] = r
+	ms.retrieveMu.Unlock()
+
+	req := request{
+		inHeader: &InHeader{
+			Opcode: _OP_NOTIFY_RETRIEVE,
+		},
+		handler: operationHandlers[_OP_NOTIFY_RETRIEVE],
+		status:  NOTIFY_RETRIEVE,
+	}
+	req.outData = unsafe.Pointer(&NotifyRetrieveOut{
+		NotifyUnique: unique,
+		Nodeid:       node,
+		Offset:       uint64(offset),
+		Size:         uint32(len(dest)),
+	})
+
+	// Protect against concurrent close.
+	ms.reqMu.Lock()
+	result := ms.write(&req)
+	ms.reqMu.Unlock()
+
+	if ms.debug {
+		log.Printf("Response: RETRIEVE_NOTIFY: %v", result)
+	}
+	if !result.Ok() {
+		ms.retrieveMu.Lock()
+		delete(ms.retrieveTab, unique)
+		ms.retrieveMu.Unlock()
+		return 0, result
+	}
+
+	// The kernel answers with a NOTIFY_REPLY, which is handled
+	// by doNotifyReply.
+	select {
+	case <-r.ready:
+	case <-cancel:
+		ms.retrieveMu.Lock()
+		_, pending := ms.retrieveTab[unique]
+		delete(ms.retrieveTab, unique)
+		ms.retrieveMu.Unlock()
+		if pending {
+			return 0, EINTR
+		}
+		// The reply is being copied into dest.
+		<-r.ready
+	}
+	return r.n, r.status
+}
+
 var defaultBufferPool BufferPool
 
 func init() {
@@ -4,9 +4,16 @@ import (
 	"syscall"
 )
 
+func cloneDevice(fd int) (int, error) {
+	return -1, syscall.ENOSYS
+}
+
 func (ms *Server) systemWrite(req *request, header []byte) Status {
+	if ms.stream != nil {
+		return ms.writeStream(req, header)
+	}
 	if req.flatDataSize() == 0 {
-		_, err := syscall.Write(ms.mountFd, Write(header))
+		_, err := syscall.Write(ms.replyFd(req), Write(header))
 		return ToStatus(err)
 	}
 
@@ -17,7 +24,7 @@ func (ms *Server) systemWrite(req *request, header []byte) Status {
 		header = req.serializeHeader(len(req.flatData))
 	}
 
-	_, err := writev(int(ms.mountFd), [][]byte{header, req.flatData})
+	_, err := writev(ms.replyFd(req), [][]byte{header, req.flatData})
 	if req.readResult != nil {
 		req.readResult.Done()
 	}
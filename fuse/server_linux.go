@@ -3,11 +3,35 @@ package fuse
 import (
 	"log"
 	"syscall"
+	"unsafe"
 )
 
+// _IOR(229, 0, uint32)
+const _FUSE_DEV_IOC_CLONE = 0x8004e500
+
+// cloneDevice opens a new /dev/fuse descriptor that is attached to
+// the same connection as fd.
+func cloneDevice(fd int) (int, error) {
+	newFd, err := syscall.Open("/dev/fuse", syscall.O_RDWR|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, err
+	}
+	src := uint32(fd)
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(newFd),
+		_FUSE_DEV_IOC_CLONE, uintptr(unsafe.Pointer(&src)))
+	if errno != 0 {
+		syscall.Close(newFd)
+		return -1, errno
+	}
+	return newFd, nil
+}
+
 func (ms *Server) systemWrite(req *request, header []byte) Status {
+	if ms.stream != nil {
+		return ms.writeStream(req, header)
+	}
 	if req.flatDataSize() == 0 {
-		_, err := syscall.Write(ms.mountFd, header)
+		_, err := syscall.Write(ms.replyFd(req), header)
 		return ToStatus(err)
 	}
 
@@ -27,7 +51,7 @@ func (ms *Server) systemWrite(req *request, header []byte) Status {
 		header = req.serializeHeader(len(req.flatData))
 	}
 
-	_, err := writev(ms.mountFd, [][]byte{header, req.flatData})
+	_, err := writev(ms.replyFd(req), [][]byte{header, req.flatData})
 	if req.readResult != nil {
 		req.readResult.Done()
 	}
@@ -0,0 +1,45 @@
+package fuse
+
+import (
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+func TestServeFd(t *testing.T) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_SEQPACKET, 0)
+	if err != nil {
+		t.Fatalf("Socketpair: %v", err)
+	}
+	client := fds[0]
+	defer syscall.Close(client)
+
+	ms, err := NewServerFd(&attrFS{NewDefaultRawFileSystem()}, fds[1], nil)
+	if err != nil {
+		t.Fatalf("NewServerFd: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		ms.Serve()
+		close(done)
+	}()
+
+	buf := make([]byte, 4096)
+	for i, msg := range [][]byte{initMessage(1), getAttrMessage(2, FUSE_ROOT_ID)} {
+		if _, err := syscall.Write(client, msg); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		n, err := syscall.Read(client, buf)
+		if err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+		h := (*OutHeader)(unsafe.Pointer(&buf[0]))
+		if int(h.Length) != n || h.Unique != uint64(i+1) || h.Status != 0 {
+			t.Fatalf("got reply %+v, read %d bytes", h, n)
+		}
+	}
+
+	// Closing our end makes reads return EOF, which ends Serve.
+	syscall.Shutdown(client, syscall.SHUT_RDWR)
+	<-done
+}
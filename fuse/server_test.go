@@ -0,0 +1,242 @@
+package fuse
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// attrFS answers GetAttr for the root.
+type attrFS struct {
+	RawFileSystem
+}
+
+func (fs *attrFS) GetAttr(input *GetAttrIn, out *AttrOut) Status {
+	if input.NodeId != FUSE_ROOT_ID {
+		return ENOENT
+	}
+	out.Mode = S_IFDIR | 0755
+	return OK
+}
+
+func initMessage(unique uint64) []byte {
+	buf := make([]byte, unsafe.Sizeof(InitIn{}))
+	in := (*InitIn)(unsafe.Pointer(&buf[0]))
+	in.Length = uint32(len(buf))
+	in.Opcode = _OP_INIT
+	in.Unique = unique
+	in.Major = _FUSE_KERNEL_VERSION
+	in.Minor = _OUR_MINOR_VERSION
+	return buf
+}
+
+func getAttrMessage(unique uint64, nodeid uint64) []byte {
+	buf := make([]byte, unsafe.Sizeof(GetAttrIn{}))
+	in := (*GetAttrIn)(unsafe.Pointer(&buf[0]))
+	in.Length = uint32(len(buf))
+	in.Opcode = _OP_GETATTR
+	in.Unique = unique
+	in.NodeId = nodeid
+	return buf
+}
+
+// readReply reads one length delimited reply from a stream.
+func readReply(t *testing.T, r io.Reader) (*OutHeader, []byte) {
+	buf := make([]byte, sizeOfOutHeader)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatalf("reading reply header: %v", err)
+	}
+	h := (*OutHeader)(unsafe.Pointer(&buf[0]))
+	data := make([]byte, int(h.Length)-len(buf))
+	if _, err := io.ReadFull(r, data); err != nil {
+		t.Fatalf("reading reply data: %v", err)
+	}
+	return h, data
+}
+
+func TestServeStream(t *testing.T) {
+	client, conn := net.Pipe()
+	ms := NewServerStream(&attrFS{NewDefaultRawFileSystem()}, conn, &MountOptions{Queues: 4})
+	if len(ms.queues) != 1 {
+		t.Errorf("stream server has %d queues, want 1", len(ms.queues))
+	}
+	done := make(chan struct{})
+	go func() {
+		ms.Serve()
+		close(done)
+	}()
+
+	if _, err := client.Write(initMessage(1)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	h, data := readReply(t, client)
+	if h.Unique != 1 || h.Status != 0 || len(data) != int(unsafe.Sizeof(InitOut{})) {
+		t.Fatalf("got INIT reply %+v, %d bytes", h, len(data))
+	}
+	ms.WaitMount()
+
+	if _, err := client.Write(getAttrMessage(2, FUSE_ROOT_ID)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	h, data = readReply(t, client)
+	if h.Unique != 2 || h.Status != 0 {
+		t.Fatalf("got GETATTR reply %+v", h)
+	}
+	if out := (*AttrOut)(unsafe.Pointer(&data[0])); out.Mode != S_IFDIR|0755 {
+		t.Errorf("got mode %o", out.Mode)
+	}
+
+	if _, err := client.Write(getAttrMessage(3, 42)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if h, _ = readReply(t, client); h.Unique != 3 || Status(-h.Status) != ENOENT {
+		t.Errorf("got GETATTR reply %+v, want ENOENT", h)
+	}
+
+	client.Close()
+	<-done
+}
+
+// readNotify reads a notification from a stream, and returns the
+// header, the structured data and the rest.
+func readNotify(t *testing.T, r io.Reader, code Status, sz uintptr) (*OutHeader, unsafe.Pointer, []byte) {
+	h, data := readReply(t, r)
+	if h.Unique != 0 || Status(-h.Status) != code || len(data) < int(sz) {
+		t.Fatalf("got notification %+v with %d bytes, want code %d", h, len(data), code)
+	}
+	return h, unsafe.Pointer(&data[0]), data[sz:]
+}
+
+func TestStoreRetrieveCacheStream(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	ms := NewServerStream(NewDefaultRawFileSystem(), conn, nil)
+	go ms.Serve()
+
+	client.Write(initMessage(1))
+	readReply(t, client)
+	ms.WaitMount()
+
+	go ms.InodeNotifyStoreCache(42, 100, []byte("hello"))
+	_, p, data := readNotify(t, client, NOTIFY_STORE, unsafe.Sizeof(NotifyStoreOut{}))
+	if st := (*NotifyStoreOut)(p); st.Nodeid != 42 || st.Offset != 100 || st.Size != 5 || string(data) != "hello" {
+		t.Errorf("got store %v %q", st.string(), data)
+	}
+
+	type result struct {
+		n    int
+		code Status
+	}
+	dest := make([]byte, 10)
+	done := make(chan result, 1)
+	go func() {
+		n, code := ms.InodeRetrieveCache(42, 100, dest, nil)
+		done <- result{n, code}
+	}()
+	_, p, _ = readNotify(t, client, NOTIFY_RETRIEVE, unsafe.Sizeof(NotifyRetrieveOut{}))
+	rt := (*NotifyRetrieveOut)(p)
+	if rt.Nodeid != 42 || rt.Offset != 100 || rt.Size != 10 {
+		t.Errorf("got retrieve %v", rt.string())
+	}
+
+	payload := []byte("hello")
+	buf := make([]byte, unsafe.Sizeof(NotifyRetrieveIn{}), int(unsafe.Sizeof(NotifyRetrieveIn{}))+len(payload))
+	in := (*NotifyRetrieveIn)(unsafe.Pointer(&buf[0]))
+	in.Opcode = _OP_NOTIFY_REPLY
+	in.Unique = rt.NotifyUnique
+	in.NodeId = 42
+	in.Offset = 100
+	in.Size = uint32(len(payload))
+	buf = append(buf, payload...)
+	in = (*NotifyRetrieveIn)(unsafe.Pointer(&buf[0]))
+	in.Length = uint32(len(buf))
+	if _, err := client.Write(buf); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	select {
+	case r := <-done:
+		if !r.code.Ok() || string(dest[:r.n]) != "hello" {
+			t.Errorf("got %q, %v", dest[:r.n], r.code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("InodeRetrieveCache did not return")
+	}
+}
+
+func TestRetrieveCacheCancel(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	ms := NewServerStream(NewDefaultRawFileSystem(), conn, nil)
+	served := make(chan struct{})
+	go func() {
+		ms.Serve()
+		close(served)
+	}()
+
+	client.Write(initMessage(1))
+	readReply(t, client)
+	ms.WaitMount()
+
+	retrieve := func(cancel <-chan struct{}) <-chan Status {
+		done := make(chan Status, 1)
+		go func() {
+			_, code := ms.InodeRetrieveCache(42, 0, make([]byte, 10), cancel)
+			done <- code
+		}()
+		readNotify(t, client, NOTIFY_RETRIEVE, unsafe.Sizeof(NotifyRetrieveOut{}))
+		return done
+	}
+	wait := func(done <-chan Status, want Status) {
+		select {
+		case code := <-done:
+			if code != want {
+				t.Errorf("got %v, want %v", code, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("InodeRetrieveCache did not return")
+		}
+	}
+
+	// The kernel does not answer; the caller gives up.
+	cancel := make(chan struct{})
+	done := retrieve(cancel)
+	close(cancel)
+	wait(done, EINTR)
+
+	// The connection goes away while waiting.
+	done = retrieve(nil)
+	client.Close()
+	<-served
+	wait(done, ENODEV)
+
+	ms.retrieveMu.Lock()
+	n := len(ms.retrieveTab)
+	ms.retrieveMu.Unlock()
+	if n != 0 {
+		t.Errorf("%d retrieves left in the table", n)
+	}
+	if _, code := ms.InodeRetrieveCache(42, 0, make([]byte, 10), nil); code != ENODEV {
+		t.Errorf("retrieve after Serve returned: got %v, want ENODEV", code)
+	}
+}
+
+func TestNotifyReplyKeepsInflight(t *testing.T) {
+	ms := NewServerStream(NewDefaultRawFileSystem(), nullStream{}, nil)
+	live := &request{}
+	live.setInput(message(_OP_GETATTR, unsafe.Sizeof(GetAttrIn{}), nil))
+	live.inHeader = (*InHeader)(unsafe.Pointer(&live.inputBuf[0]))
+	ms.registerInflight(live, 0)
+	defer ms.unregisterInflight(live)
+
+	// Both have unique 1.
+	reply := &request{queue: ms.queues[0]}
+	reply.setInput(message(_OP_NOTIFY_REPLY, unsafe.Sizeof(NotifyRetrieveIn{}), nil))
+	ms.handleRequest(reply)
+
+	if !ms.interrupt(1) {
+		t.Error("NOTIFY_REPLY unregistered the kernel request with its unique")
+	}
+}
@@ -0,0 +1,120 @@
+package fuse
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ErrBusy is returned, possibly wrapped, by Unmount and Shutdown if
+// the kernel refuses to unmount because files are still in use.
+var ErrBusy = errors.New("fuse: file system is busy")
+
+// Open handles and requests, counted for Shutdown.
+type drainState struct {
+	shuttingDown int32
+	handles      int64
+	requests     int64
+}
+
+// received is called when a request is read, so requests that wait
+// for a handler count as in flight too.
+func (d *drainState) received() {
+	atomic.AddInt64(&d.requests, 1)
+}
+
+// admit is called before handling req. It refuses new opens once
+// Shutdown has been called.
+func (d *drainState) admit(req *request) {
+	if atomic.LoadInt32(&d.shuttingDown) == 0 || !req.status.Ok() {
+		return
+	}
+	switch req.inHeader.Opcode {
+	case _OP_OPEN, _OP_OPENDIR, _OP_CREATE:
+		req.status = Status(syscall.ESHUTDOWN)
+	}
+}
+
+// handled is called after req has been handled, before replying.
+func (d *drainState) handled(req *request) {
+	if !req.status.Ok() {
+		return
+	}
+	switch req.inHeader.Opcode {
+	case _OP_OPEN, _OP_OPENDIR, _OP_CREATE:
+		atomic.AddInt64(&d.handles, 1)
+	case _OP_RELEASE, _OP_RELEASEDIR:
+		atomic.AddInt64(&d.handles, -1)
+	}
+}
+
+// done is called after replying to req.
+func (d *drainState) done(req *request) {
+	atomic.AddInt64(&d.requests, -1)
+}
+
+// OpenHandles returns the number of files and directories that the
+// kernel has open on the file system.
+func (ms *Server) OpenHandles() int {
+	return int(atomic.LoadInt64(&ms.drain.handles))
+}
+
+// Shutdown unmounts the file system gracefully. It makes new opens
+// fail with ESHUTDOWN, and waits up to timeout for the requests in
+// flight to finish and for the open files to be closed. Then it
+// unmounts. If the wait times out, or the kernel refuses the unmount
+// because the mount is in use, the mount is detached lazily
+// (MNT_DETACH, or fusermount -z): it disappears from the file system
+// tree, so a new server can be mounted in its place, but this Server
+// keeps serving the open files until they are closed. In that case,
+// Shutdown returns an error wrapping ErrBusy.
+//
+// For a Server that did not mount the file system itself (see
+// NewServerFd), Shutdown only waits.
+func (ms *Server) Shutdown(timeout time.Duration) error {
+	atomic.StoreInt32(&ms.drain.shuttingDown, 1)
+
+	deadline := time.Now().Add(timeout)
+	drained := ms.drained()
+	for !drained && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		drained = ms.drained()
+	}
+
+	if ms.mountPoint == "" {
+		if !drained {
+			return ms.busyError()
+		}
+		return nil
+	}
+
+	if drained {
+		err := unmount(ms.mountPoint, ms.opts)
+		if err == nil {
+			ms.loops.Wait()
+			ms.mountPoint = ""
+			return nil
+		}
+		if !errors.Is(err, ErrBusy) {
+			return err
+		}
+	}
+
+	if err := unmountLazy(ms.mountPoint, ms.opts); err != nil {
+		return fmt.Errorf("lazy unmount: %v", err)
+	}
+	ms.mountPoint = ""
+	return ms.busyError()
+}
+
+func (ms *Server) drained() bool {
+	return atomic.LoadInt64(&ms.drain.requests) == 0 &&
+		atomic.LoadInt64(&ms.drain.handles) == 0
+}
+
+func (ms *Server) busyError() error {
+	return fmt.Errorf("%w: %d requests in flight, %d open files",
+		ErrBusy, atomic.LoadInt64(&ms.drain.requests), atomic.LoadInt64(&ms.drain.handles))
+}
@@ -0,0 +1,91 @@
+package fuse
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+type openFS struct {
+	attrFS
+}
+
+func (fs *openFS) Open(input *OpenIn, out *OpenOut) Status {
+	return OK
+}
+
+func TestShutdownDrain(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	ms := NewServerStream(&openFS{attrFS{NewDefaultRawFileSystem()}}, conn, nil)
+	go ms.Serve()
+
+	client.Write(initMessage(1))
+	readReply(t, client)
+	ms.WaitMount()
+
+	client.Write(withUnique(message(_OP_OPEN, unsafe.Sizeof(OpenIn{}), nil), 2))
+	if h, _ := readReply(t, client); h.Status != 0 {
+		t.Fatalf("OPEN: got status %d", h.Status)
+	}
+	if n := ms.OpenHandles(); n != 1 {
+		t.Errorf("got %d open handles, want 1", n)
+	}
+
+	if err := ms.Shutdown(20 * time.Millisecond); !errors.Is(err, ErrBusy) {
+		t.Errorf("Shutdown with open file: got %v, want ErrBusy", err)
+	}
+
+	client.Write(withUnique(message(_OP_OPEN, unsafe.Sizeof(OpenIn{}), nil), 3))
+	if h, _ := readReply(t, client); h.Status != -int32(syscall.ESHUTDOWN) {
+		t.Errorf("OPEN during shutdown: got status %d, want %d", h.Status, -int32(syscall.ESHUTDOWN))
+	}
+	client.Write(withUnique(getAttrMessage(4, FUSE_ROOT_ID), 4))
+	if h, _ := readReply(t, client); h.Status != 0 {
+		t.Errorf("GETATTR during shutdown: got status %d", h.Status)
+	}
+
+	client.Write(withUnique(message(_OP_RELEASE, unsafe.Sizeof(ReleaseIn{}), nil), 5))
+	readReply(t, client)
+	if n := ms.OpenHandles(); n != 0 {
+		t.Errorf("got %d open handles after RELEASE, want 0", n)
+	}
+	if err := ms.Shutdown(time.Second); err != nil {
+		t.Errorf("Shutdown after RELEASE: %v", err)
+	}
+}
+
+func TestShutdownCountsQueuedRequests(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	fs := &slowReadFS{
+		attrFS:  attrFS{NewDefaultRawFileSystem()},
+		release: make(chan struct{}),
+	}
+	ms := NewServerStream(fs, conn, &MountOptions{MaxHandlers: 1})
+	go ms.Serve()
+
+	client.Write(initMessage(1))
+	readReply(t, client)
+	ms.WaitMount()
+
+	client.Write(withUnique(readMessage(4096), 2))
+	client.Write(withUnique(readMessage(4096), 4))
+	waitStats(t, ms, func(s HandlerStats) bool { return s.Queued == 1 })
+
+	err := ms.Shutdown(0)
+	if !errors.Is(err, ErrBusy) || !strings.Contains(err.Error(), "2 requests in flight") {
+		t.Errorf("Shutdown with a queued request: got %v, want 2 requests in flight", err)
+	}
+
+	close(fs.release)
+	readReply(t, client)
+	readReply(t, client)
+	if err := ms.Shutdown(time.Second); err != nil {
+		t.Errorf("Shutdown after the reads: %v", err)
+	}
+}
@@ -5,7 +5,13 @@ import (
 )
 
 func (s *Server) setSplice() {
-	panic("darwin has no splice.")
+	// Darwin has no splice.
+	s.canSplice = false
+	s.spliceWrites = false
+}
+
+func (ms *Server) readSplice(fd int, dest []byte) (int, *WritePipe, error) {
+	return 0, nil, fmt.Errorf("unimplemented")
 }
 
 func (ms *Server) trySplice(header []byte, req *request, fdData *ReadResultFd) error {
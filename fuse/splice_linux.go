@@ -3,12 +3,66 @@ package fuse
 import (
 	"fmt"
 	"io"
+	"log"
+	"syscall"
+	"unsafe"
 
 	"github.com/hanwen/go-fuse/splice"
 )
 
 func (s *Server) setSplice() {
-	s.canSplice = splice.Resizable()
+	s.canSplice = !s.notDevice && splice.Resizable()
+	if s.opts.EnableSpliceWrites {
+		sz := s.opts.MaxWrite + PAGESIZE
+		s.spliceWrites = s.canSplice && sz <= splice.MaxPipeSize()
+		if !s.spliceWrites {
+			log.Printf("cannot splice requests of %d bytes; copying writes", sz)
+		}
+	}
+}
+
+// readSplice splices a request from fd into a pipe. For a WRITE,
+// only the header and WriteIn are read into dest, and the payload is
+// left in the returned pipe; dest[:n] then is the full message with
+// an unfilled payload. Other requests are read into dest completely.
+func (ms *Server) readSplice(fd int, dest []byte) (n int, pipe *WritePipe, err error) {
+	pair, err := splice.Get()
+	if err == nil {
+		if err = pair.Grow(len(dest)); err != nil {
+			splice.Drop(pair)
+		}
+	}
+	if err != nil {
+		log.Printf("readSplice: %v; falling back to read", err)
+		n, err = syscall.Read(fd, dest)
+		return n, nil, err
+	}
+
+	n, err = pair.LoadFrom(uintptr(fd), len(dest))
+	if err != nil {
+		splice.Done(pair)
+		return 0, nil, err
+	}
+
+	k := int(unsafe.Sizeof(WriteIn{}))
+	if k > n {
+		k = n
+	}
+	if _, err = io.ReadFull(pair, dest[:k]); err != nil {
+		splice.Drop(pair)
+		return 0, nil, err
+	}
+	in := (*WriteIn)(unsafe.Pointer(&dest[0]))
+	if k == int(unsafe.Sizeof(WriteIn{})) && in.Opcode == _OP_WRITE && int(in.Size) == n-k {
+		return n, &WritePipe{pair: pair, size: n - k}, nil
+	}
+
+	if _, err = io.ReadFull(pair, dest[k:n]); err != nil {
+		splice.Drop(pair)
+		return 0, nil, err
+	}
+	splice.Done(pair)
+	return n, nil, nil
 }
 
 func (ms *Server) trySplice(header []byte, req *request, fdData *readResultFd) error {
@@ -60,7 +114,7 @@ func (ms *Server) trySplice(header []byte, req *request, fdData *readResultFd) e
 		return fmt.Errorf("wrote %d, want %d", n, fdData.Size())
 	}
 
-	_, err = pair.WriteTo(uintptr(ms.mountFd), total)
+	_, err = pair.WriteTo(uintptr(ms.replyFd(req)), total)
 	if err != nil {
 		return err
 	}
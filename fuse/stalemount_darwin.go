@@ -0,0 +1,17 @@
+package fuse
+
+import (
+	"fmt"
+)
+
+// IsStaleMount reports whether mountPoint is a FUSE mount whose
+// server has gone away. It is not supported on this platform.
+func IsStaleMount(mountPoint string) (bool, error) {
+	return false, fmt.Errorf("IsStaleMount is not supported")
+}
+
+// CleanupStaleMount detaches mountPoint if it is stale. It is not
+// supported on this platform.
+func CleanupStaleMount(mountPoint string) (bool, error) {
+	return false, fmt.Errorf("CleanupStaleMount is not supported")
+}
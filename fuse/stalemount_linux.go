@@ -0,0 +1,89 @@
+package fuse
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// mountType returns the file system type of the topmost mount on
+// mountPoint in a table in the format of /proc/self/mountinfo, or ""
+// if nothing is mounted there.
+func mountType(r io.Reader, mountPoint string) (string, error) {
+	fstype := ""
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || unescapeMountInfo(fields[4]) != mountPoint {
+			continue
+		}
+		for i := 5; i+1 < len(fields); i++ {
+			if fields[i] == "-" {
+				fstype = fields[i+1]
+				break
+			}
+		}
+	}
+	return fstype, scanner.Err()
+}
+
+// unescapeMountInfo decodes the octal escapes, eg. "\040" for a
+// space, that the kernel uses in mountinfo paths.
+func unescapeMountInfo(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// IsStaleMount reports whether mountPoint is a FUSE mount whose
+// server has gone away, eg. because it crashed, so that accessing it
+// fails with ENOTCONN. mountPoint must be an absolute, clean path.
+// If the server is alive but hangs, IsStaleMount hangs too.
+func IsStaleMount(mountPoint string) (bool, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	fstype, err := mountType(f, mountPoint)
+	if err != nil {
+		return false, err
+	}
+	if fstype != "fuse" && fstype != "fuseblk" && !strings.HasPrefix(fstype, "fuse.") {
+		return false, nil
+	}
+
+	var st syscall.Stat_t
+	err = syscall.Stat(mountPoint, &st)
+	return err == syscall.ENOTCONN || err == syscall.ECONNABORTED, nil
+}
+
+// CleanupStaleMount detaches mountPoint if IsStaleMount reports it
+// as stale, so it can be mounted again. It returns whether it
+// detached a mount.
+func CleanupStaleMount(mountPoint string) (bool, error) {
+	stale, err := IsStaleMount(mountPoint)
+	if err != nil || !stale {
+		return false, err
+	}
+	if err := unmountLazy(mountPoint, &MountOptions{}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
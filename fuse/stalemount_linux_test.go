@@ -0,0 +1,77 @@
+package fuse
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestMountType(t *testing.T) {
+	table := `22 1 0:21 / /proc rw,nosuid - proc proc rw
+36 22 0:40 / /mnt/my\040dir rw,nosuid,nodev shared:5 - fuse.myfs myfs rw,user_id=0
+37 22 0:41 / /mnt/other rw - tmpfs tmpfs rw
+38 36 0:42 / /mnt/other rw - fuse fuse rw,user_id=0
+`
+	for path, want := range map[string]string{
+		"/mnt/my dir": "fuse.myfs",
+		"/mnt/other":  "fuse",
+		"/mnt":        "",
+	} {
+		got, err := mountType(strings.NewReader(table), path)
+		if err != nil || got != want {
+			t.Errorf("mountType(%q): got %q, %v, want %q", path, got, err, want)
+		}
+	}
+}
+
+func TestCleanupStaleMount(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("needs root for direct mounts")
+	}
+	dir, err := ioutil.TempDir("", "TestCleanupStaleMount")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if stale, err := IsStaleMount(dir); err != nil || stale {
+		t.Errorf("IsStaleMount before mounting: %v, %v", stale, err)
+	}
+
+	opts := &MountOptions{DirectMount: true, DirectMountStrict: true}
+	ms, err := NewServer(NewDefaultRawFileSystem(), dir, opts)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	// Simulate a crash: the kernel aborts the connection once the
+	// device is closed.
+	syscall.Close(ms.mountFd)
+
+	var st syscall.Stat_t
+	if err := syscall.Stat(dir, &st); err != syscall.ENOTCONN {
+		t.Errorf("Stat of stale mount: got %v, want ENOTCONN", err)
+	}
+	if stale, err := IsStaleMount(dir); err != nil || !stale {
+		t.Fatalf("IsStaleMount: got %v, %v", stale, err)
+	}
+
+	opts.CleanupStaleMount = true
+	ms, err = NewServer(&attrFS{NewDefaultRawFileSystem()}, dir, opts)
+	if err != nil {
+		t.Fatalf("NewServer with CleanupStaleMount: %v", err)
+	}
+	go ms.Serve()
+	ms.WaitMount()
+	if err := syscall.Stat(dir, &st); err != nil {
+		t.Errorf("Stat of new mount: %v", err)
+	}
+	if err := ms.Unmount(); err != nil {
+		t.Fatalf("Unmount: %v", err)
+	}
+	if stale, err := IsStaleMount(filepath.Clean(dir)); err != nil || stale {
+		t.Errorf("IsStaleMount after Unmount: %v, %v", stale, err)
+	}
+}
@@ -0,0 +1,71 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+	"github.com/hanwen/go-fuse/fuse/pathfs"
+)
+
+// slowFS blocks in GetAttr for "slow" until it is interrupted.
+type slowFS struct {
+	pathfs.FileSystem
+	interrupted chan struct{}
+}
+
+func (fs *slowFS) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse.Status) {
+	if name == "" {
+		return &fuse.Attr{Mode: fuse.S_IFDIR | 0755}, fuse.OK
+	}
+	if name != "slow" {
+		return nil, fuse.ENOENT
+	}
+	select {
+	case <-context.Done():
+		close(fs.interrupted)
+		return nil, fuse.EINTR
+	case <-time.After(10 * time.Second):
+		return nil, fuse.EIO
+	}
+}
+
+func TestInterrupt(t *testing.T) {
+	fs := &slowFS{
+		FileSystem:  pathfs.NewDefaultFileSystem(),
+		interrupted: make(chan struct{}),
+	}
+	dir, err := ioutil.TempDir("", "go-fuse")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.Remove(dir)
+
+	state, _, err := nodefs.MountFileSystem(dir, pathfs.NewPathNodeFs(fs, nil), nil)
+	if err != nil {
+		t.Fatalf("MountFileSystem failed: %v", err)
+	}
+	state.SetDebug(VerboseTest())
+	go state.Serve()
+	defer state.Unmount()
+	state.WaitMount()
+
+	cmd := exec.Command("stat", dir+"/slow")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	cmd.Process.Signal(syscall.SIGINT)
+
+	select {
+	case <-fs.interrupted:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("GetAttr was not interrupted")
+	}
+	cmd.Wait()
+}
@@ -1,11 +1,20 @@
 package test
 
 import (
+	"bytes"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"sync"
 	"syscall"
 	"testing"
 	"time"
+	"unsafe"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+	"github.com/hanwen/go-fuse/fuse/pathfs"
 )
 
 func TestTouch(t *testing.T) {
@@ -68,3 +77,308 @@ func TestFallocate(t *testing.T) {
 			fi.Size())
 	}
 }
+
+func setupLockTest(t *testing.T) (orig, mnt string, clean func()) {
+	return setupLoopbackOptions(t, &fuse.MountOptions{
+		EnableLocks: true,
+	})
+}
+
+// setupLoopbackOptions mounts a loopback file system with the given
+// mount options.
+func setupLoopbackOptions(t *testing.T, opts *fuse.MountOptions) (orig, mnt string, clean func()) {
+	dir, err := ioutil.TempDir("", "go-fuse-opts")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	orig = dir + "/orig"
+	mnt = dir + "/mnt"
+	os.Mkdir(orig, 0700)
+	os.Mkdir(mnt, 0700)
+
+	pfs := pathfs.NewPathNodeFs(pathfs.NewLoopbackFileSystem(orig), nil)
+	conn := nodefs.NewFileSystemConnector(pfs, nil)
+	state, err := fuse.NewServer(conn.RawFS(), mnt, opts)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	state.SetDebug(VerboseTest())
+	go state.Serve()
+	state.WaitMount()
+
+	return orig, mnt, func() {
+		state.Unmount()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestFlock(t *testing.T) {
+	orig, mnt, clean := setupLockTest(t)
+	defer clean()
+
+	if err := ioutil.WriteFile(orig+"/file", []byte("hello"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	f1, err := os.Open(mnt + "/file")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f1.Close()
+	f2, err := os.Open(mnt + "/file")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f2.Close()
+
+	if err := syscall.Flock(int(f1.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		t.Fatalf("Flock failed: %v", err)
+	}
+	if err := syscall.Flock(int(f2.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != syscall.EWOULDBLOCK {
+		t.Fatalf("Flock on locked file: got %v, want EWOULDBLOCK", err)
+	}
+
+	// The lock must be visible on the backing file too.
+	o, err := os.Open(orig + "/file")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer o.Close()
+	if err := syscall.Flock(int(o.Fd()), syscall.LOCK_SH|syscall.LOCK_NB); err != syscall.EWOULDBLOCK {
+		t.Fatalf("Flock on backing file: got %v, want EWOULDBLOCK", err)
+	}
+
+	if err := syscall.Flock(int(f1.Fd()), syscall.LOCK_UN); err != nil {
+		t.Fatalf("Flock unlock failed: %v", err)
+	}
+	if err := syscall.Flock(int(f2.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		t.Fatalf("Flock after unlock failed: %v", err)
+	}
+}
+
+const _F_OFD_GETLK = 36
+const _F_OFD_SETLK = 37
+
+func TestFcntlLock(t *testing.T) {
+	orig, mnt, clean := setupLockTest(t)
+	defer clean()
+
+	if err := ioutil.WriteFile(orig+"/file", []byte("hello"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	f1, err := os.OpenFile(mnt+"/file", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f1.Close()
+	f2, err := os.OpenFile(mnt+"/file", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f2.Close()
+
+	// Use open file description locks, so the two files are
+	// different lock owners even though they live in one process.
+	lk := syscall.Flock_t{
+		Type:  syscall.F_WRLCK,
+		Start: 1,
+		Len:   2,
+	}
+	if err := syscall.FcntlFlock(f1.Fd(), _F_OFD_SETLK, &lk); err != nil {
+		t.Fatalf("F_SETLK failed: %v", err)
+	}
+
+	probe := syscall.Flock_t{
+		Type:  syscall.F_RDLCK,
+		Start: 0,
+		Len:   0,
+	}
+	if err := syscall.FcntlFlock(f2.Fd(), _F_OFD_GETLK, &probe); err != nil {
+		t.Fatalf("F_GETLK failed: %v", err)
+	}
+	if probe.Type != syscall.F_WRLCK || probe.Start != 1 || probe.Len != 2 {
+		t.Errorf("F_GETLK: got %+v, want write lock on [1,3)", probe)
+	}
+
+	probe = syscall.Flock_t{
+		Type:  syscall.F_WRLCK,
+		Start: 2,
+		Len:   1,
+	}
+	if err := syscall.FcntlFlock(f2.Fd(), _F_OFD_SETLK, &probe); err != syscall.EAGAIN {
+		t.Errorf("F_SETLK on locked range: got %v, want EAGAIN", err)
+	}
+}
+
+func TestIoctlGetFlags(t *testing.T) {
+	ts := NewTestCase(t)
+	defer ts.Cleanup()
+
+	const _FS_IOC_GETFLAGS = 0x80086601
+	if err := ioutil.WriteFile(ts.orig+"/file", []byte("hello"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	o, err := os.Open(ts.orig + "/file")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer o.Close()
+	var want int32
+	if _, errno := ioctl(int(o.Fd()), _FS_IOC_GETFLAGS, uintptr(unsafe.Pointer(&want))); errno != 0 {
+		t.Skipf("backing file system does not support FS_IOC_GETFLAGS: %v", syscall.Errno(errno))
+	}
+
+	f, err := os.Open(ts.mnt + "/file")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+	var got int32
+	if _, errno := ioctl(int(f.Fd()), _FS_IOC_GETFLAGS, uintptr(unsafe.Pointer(&got))); errno != 0 {
+		t.Fatalf("FS_IOC_GETFLAGS failed: %v", syscall.Errno(errno))
+	}
+	if got != want {
+		t.Errorf("got flags 0x%x, want 0x%x", got, want)
+	}
+}
+
+func TestWritebackCache(t *testing.T) {
+	orig, mnt, clean := setupLoopbackOptions(t, &fuse.MountOptions{
+		EnableWritebackCache: true,
+	})
+	defer clean()
+
+	if err := ioutil.WriteFile(orig+"/file", []byte("hello"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	// The kernel reads the partial page before writing to it,
+	// and computes the append offset itself.
+	f, err := os.OpenFile(mnt+"/file", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	if _, err := f.Write([]byte(" world")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	got, err := ioutil.ReadFile(orig + "/file")
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if want := "hello world"; string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	fi, err := os.Stat(mnt + "/file")
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if fi.Size() != int64(len("hello world")) {
+		t.Errorf("got size %d, want %d", fi.Size(), len("hello world"))
+	}
+}
+
+func TestClonedQueues(t *testing.T) {
+	orig, mnt, clean := setupLoopbackOptions(t, &fuse.MountOptions{Queues: 4})
+	defer clean()
+
+	const n = 50
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("%s/file%d", orig, i)
+		if err := ioutil.WriteFile(name, []byte(name), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			content, err := ioutil.ReadFile(fmt.Sprintf("%s/file%d", mnt, i))
+			if err != nil {
+				errs <- err
+			} else if want := fmt.Sprintf("%s/file%d", orig, i); string(content) != want {
+				errs <- fmt.Errorf("got %q, want %q", content, want)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestSpliceWrites(t *testing.T) {
+	orig, mnt, clean := setupLoopbackOptions(t, &fuse.MountOptions{
+		EnableSpliceWrites: true,
+		MaxWrite:           fuse.MAX_KERNEL_WRITE_MAX_PAGES,
+	})
+	defer clean()
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), 256*1024)
+	if err := ioutil.WriteFile(mnt+"/file", content, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	got, err := ioutil.ReadFile(orig + "/file")
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("backing file has %d bytes, want %d", len(got), len(content))
+	}
+}
+
+func TestLseekCopyFileRange(t *testing.T) {
+	orig, mnt, clean := setupLoopbackOptions(t, nil)
+	defer clean()
+
+	const dataOff = 1 << 20
+	f, err := os.Create(orig + "/sparse")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	f.WriteAt([]byte("data"), dataOff)
+	f.Close()
+
+	src, err := os.Open(mnt + "/sparse")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer src.Close()
+	const seekData = 3
+	off, err := src.Seek(0, seekData)
+	if err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	if off != dataOff && off != 0 {
+		t.Errorf("got data at %d, want %d", off, dataOff)
+	}
+
+	if _, err := src.Seek(0, 0); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	dst, err := os.Create(mnt + "/copy")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	// Go uses copy_file_range for copies between files.
+	if _, err := io.Copy(dst, src); err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+	dst.Close()
+
+	want, _ := ioutil.ReadFile(orig + "/sparse")
+	got, err := ioutil.ReadFile(orig + "/copy")
+	if err != nil || !bytes.Equal(got, want) {
+		t.Errorf("copy has %d bytes, %v; want %d bytes", len(got), err, len(want))
+	}
+}
@@ -1,9 +1,12 @@
 package test
 
 import (
+	"errors"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 
@@ -162,3 +165,124 @@ func TestDeletedUnmount(t *testing.T) {
 		t.Error("should succeed", code)
 	}
 }
+
+func TestDirectMount(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("direct mounts need root")
+	}
+	dir, err := ioutil.TempDir("", "TestDirectMount")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fs := pathfs.NewPathNodeFs(pathfs.NewLoopbackFileSystem(dir), nil)
+	conn := nodefs.NewFileSystemConnector(fs, nil)
+	mnt := filepath.Join(dir, "mnt")
+	os.Mkdir(mnt, 0755)
+	ioutil.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello"), 0644)
+
+	srv, err := fuse.NewServer(conn.RawFS(), mnt, &fuse.MountOptions{
+		DirectMount:       true,
+		DirectMountStrict: true,
+		Name:              "directmount",
+	})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	go srv.Serve()
+	srv.WaitMount()
+
+	mounts, err := ioutil.ReadFile("/proc/self/mounts")
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	want := "directmount " + mnt + " fuse.directmount "
+	if !strings.Contains(string(mounts), want) {
+		t.Errorf("mount %q not in /proc/self/mounts:\n%s", want, mounts)
+	}
+
+	// Read with plain syscalls: os.Open would add the file to
+	// the runtime's epoll set, which sends a POLL request that
+	// the server cannot answer if GOMAXPROCS is 1.
+	fd, err := syscall.Open(filepath.Join(mnt, "file.txt"), syscall.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	buf := make([]byte, 100)
+	n, err := syscall.Read(fd, buf)
+	syscall.Close(fd)
+	if err != nil || string(buf[:n]) != "hello" {
+		t.Errorf("Read: %q, %v", buf[:n], err)
+	}
+
+	if err := srv.Unmount(); err != nil {
+		t.Fatalf("Unmount: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(mnt, "file.txt")); !os.IsNotExist(err) {
+		t.Errorf("file still visible after Unmount: %v", err)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("needs root for direct mounts")
+	}
+	dir, err := ioutil.TempDir("", "TestShutdown")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	mnt := filepath.Join(dir, "mnt")
+	os.Mkdir(mnt, 0755)
+	ioutil.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello"), 0644)
+
+	mount := func() (*fuse.Server, chan struct{}) {
+		fs := pathfs.NewPathNodeFs(pathfs.NewLoopbackFileSystem(dir), nil)
+		conn := nodefs.NewFileSystemConnector(fs, nil)
+		srv, err := fuse.NewServer(conn.RawFS(), mnt, &fuse.MountOptions{DirectMount: true})
+		if err != nil {
+			t.Fatalf("NewServer: %v", err)
+		}
+		done := make(chan struct{})
+		go func() {
+			srv.Serve()
+			close(done)
+		}()
+		srv.WaitMount()
+		return srv, done
+	}
+
+	srv, done := mount()
+	if err := srv.Shutdown(time.Second); err != nil {
+		t.Fatalf("Shutdown of idle mount: %v", err)
+	}
+	<-done
+
+	srv, done = mount()
+	// Use plain syscalls; see TestDirectMount.
+	fd, err := syscall.Open(filepath.Join(mnt, "file.txt"), syscall.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := srv.Shutdown(50 * time.Millisecond); !errors.Is(err, fuse.ErrBusy) {
+		t.Errorf("Shutdown with open file: got %v, want ErrBusy", err)
+	}
+	mounts, _ := ioutil.ReadFile("/proc/self/mounts")
+	if strings.Contains(string(mounts), " "+mnt+" ") {
+		t.Errorf("mount not detached:\n%s", mounts)
+	}
+
+	// The open file is still served.
+	buf := make([]byte, 100)
+	n, err := syscall.Read(fd, buf)
+	if err != nil || string(buf[:n]) != "hello" {
+		t.Errorf("Read after detach: %q, %v", buf[:n], err)
+	}
+	syscall.Close(fd)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("Serve did not return after the last file was closed")
+	}
+}
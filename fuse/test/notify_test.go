@@ -175,3 +175,30 @@ func TestEntryNotify(t *testing.T) {
 		t.Fatalf("Lstat failed: %v", err)
 	}
 }
+
+func TestStoreRetrieveCache(t *testing.T) {
+	test := NewNotifyTest(t)
+	defer test.Clean()
+
+	if _, err := os.Lstat(test.dir + "/file"); err != nil {
+		t.Fatalf("Lstat failed: %v", err)
+	}
+	node := test.pathfs.Node("file")
+	if node == nil {
+		t.Fatalf("no node for file")
+	}
+
+	want := []byte("hello")
+	if code := test.connector.FileNotifyStoreCache(node, 0, want); !code.Ok() {
+		t.Fatalf("FileNotifyStoreCache failed: %v", code)
+	}
+
+	got := make([]byte, 100)
+	n, code := test.connector.FileRetrieveCache(node, 0, got, nil)
+	if !code.Ok() {
+		t.Fatalf("FileRetrieveCache failed: %v", code)
+	}
+	if string(got[:n]) != string(want) {
+		t.Errorf("got %q, want %q", got[:n], want)
+	}
+}
@@ -0,0 +1,116 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+	"github.com/hanwen/go-fuse/fuse/pathfs"
+)
+
+// pollFile becomes readable once ready is set.
+type pollFile struct {
+	nodefs.File
+
+	mu    sync.Mutex
+	ready bool
+	kh    uint64
+	khSet chan struct{}
+}
+
+func (f *pollFile) Poll(kh uint64, flags uint32, events uint32) (uint32, fuse.Status) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if flags&fuse.FUSE_POLL_SCHEDULE_NOTIFY != 0 && f.kh == 0 {
+		f.kh = kh
+		close(f.khSet)
+	}
+	if f.ready {
+		return syscall.EPOLLIN, fuse.OK
+	}
+	return 0, fuse.OK
+}
+
+type pollFS struct {
+	pathfs.FileSystem
+	file *pollFile
+}
+
+func (fs *pollFS) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse.Status) {
+	if name == "" {
+		return &fuse.Attr{Mode: fuse.S_IFDIR | 0755}, fuse.OK
+	}
+	if name == "file" {
+		return &fuse.Attr{Mode: fuse.S_IFREG | 0644}, fuse.OK
+	}
+	return nil, fuse.ENOENT
+}
+
+func (fs *pollFS) Open(name string, flags uint32, context *fuse.Context) (nodefs.File, fuse.Status) {
+	return fs.file, fuse.OK
+}
+
+func TestPoll(t *testing.T) {
+	fs := &pollFS{
+		FileSystem: pathfs.NewDefaultFileSystem(),
+		file: &pollFile{
+			File:  nodefs.NewDefaultFile(),
+			khSet: make(chan struct{}),
+		},
+	}
+	dir, err := ioutil.TempDir("", "go-fuse")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.Remove(dir)
+
+	state, conn, err := nodefs.MountFileSystem(dir, pathfs.NewPathNodeFs(fs, nil), nil)
+	if err != nil {
+		t.Fatalf("MountFileSystem failed: %v", err)
+	}
+	state.SetDebug(VerboseTest())
+	go state.Serve()
+	defer state.Unmount()
+	state.WaitMount()
+
+	f, err := os.Open(dir + "/file")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	epfd, err := syscall.EpollCreate1(0)
+	if err != nil {
+		t.Fatalf("EpollCreate1 failed: %v", err)
+	}
+	defer syscall.Close(epfd)
+	ev := syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(f.Fd())}
+	if err := syscall.EpollCtl(epfd, syscall.EPOLL_CTL_ADD, int(f.Fd()), &ev); err != nil {
+		t.Fatalf("EpollCtl failed: %v", err)
+	}
+
+	events := make([]syscall.EpollEvent, 1)
+	if n, err := syscall.EpollWait(epfd, events, 0); err != nil || n != 0 {
+		t.Fatalf("EpollWait before ready: got %d, %v, want 0 events", n, err)
+	}
+	<-fs.file.khSet
+
+	fs.file.mu.Lock()
+	fs.file.ready = true
+	kh := fs.file.kh
+	fs.file.mu.Unlock()
+	if code := conn.PollNotify(kh); !code.Ok() {
+		t.Fatalf("PollNotify failed: %v", code)
+	}
+
+	if n, err := syscall.EpollWait(epfd, events, 5000); err != nil || n != 1 {
+		t.Fatalf("EpollWait after notify: got %d, %v, want 1 event", n, err)
+	}
+	if events[0].Events&syscall.EPOLLIN == 0 {
+		t.Errorf("got events 0x%x, want EPOLLIN", events[0].Events)
+	}
+}
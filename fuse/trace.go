@@ -0,0 +1,141 @@
+package fuse
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceEvent describes a request together with its reply, or a
+// notification sent to the kernel.
+type TraceEvent struct {
+	Opcode string `json:"op"`
+	Unique uint64 `json:"unique,omitempty"`
+	NodeId uint64 `json:"nodeid,omitempty"`
+
+	// The caller, for requests.
+	Pid uint32 `json:"pid,omitempty"`
+	Uid uint32 `json:"uid,omitempty"`
+	Gid uint32 `json:"gid,omitempty"`
+
+	// Filename arguments of the request.
+	Names []string `json:"names,omitempty"`
+
+	// The decoded input and output structs, eg. *GetAttrIn and
+	// *AttrOut. They point into buffers of the Server, and are
+	// only valid during Tracer.Trace.
+	In  interface{} `json:"in,omitempty"`
+	Out interface{} `json:"out,omitempty"`
+
+	// Sizes of unstructured data, eg. for READ and WRITE.
+	InData  int `json:"in_data,omitempty"`
+	OutData int `json:"out_data,omitempty"`
+
+	// Filename in the reply, eg. for READLINK.
+	OutName string `json:"out_name,omitempty"`
+
+	// The status of the reply. For notifications, the result
+	// of sending it.
+	Status Status `json:"status"`
+
+	// When the request was read, and how long it took to answer
+	// it.
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// Tracer receives an event for each request that the Server handles,
+// and for each notification it sends. Trace is called concurrently
+// from the goroutines handling requests.
+type Tracer interface {
+	Trace(ev *TraceEvent)
+}
+
+// SetTracer switches on tracing. Passing nil switches it off. Call it
+// before Serve. There is one tracer per Server; use MultiTracer to
+// install several.
+func (ms *Server) SetTracer(t Tracer) {
+	ms.tracer = t
+}
+
+type multiTracer []Tracer
+
+// MultiTracer returns a Tracer that passes each event to all of
+// tracers, in order. Nil entries are skipped.
+func MultiTracer(tracers ...Tracer) Tracer {
+	var m multiTracer
+	for _, t := range tracers {
+		if t != nil {
+			m = append(m, t)
+		}
+	}
+	if len(m) == 1 {
+		return m[0]
+	}
+	return m
+}
+
+func (m multiTracer) Trace(ev *TraceEvent) {
+	for _, t := range m {
+		t.Trace(ev)
+	}
+}
+
+// trace sends the event for req, which was answered with status.
+func (ms *Server) trace(req *request, status Status) {
+	h := req.inHeader
+	ev := TraceEvent{
+		Opcode: operationName(h.Opcode),
+		Unique: h.Unique,
+		NodeId: h.NodeId,
+		Pid:    h.Pid,
+		Uid:    h.Uid,
+		Gid:    h.Gid,
+		Names:  req.filenames,
+		Status: status,
+		Start:  req.startTime,
+	}
+	if ev.Start.IsZero() {
+		// Notifications are not timed.
+		ev.Start = time.Now()
+	} else {
+		ev.Duration = time.Now().Sub(ev.Start)
+	}
+	if req.inData != nil && req.handler.DecodeIn != nil {
+		ev.In = req.handler.DecodeIn(req.inData)
+	}
+	if req.handler.FileNames == 0 {
+		ev.InData = len(req.arg)
+	}
+	if req.outData != nil && req.status <= OK && req.handler.DecodeOut != nil {
+		ev.Out = req.handler.DecodeOut(req.outData)
+	}
+	if req.handler.FileNameOut {
+		ev.OutName = strings.TrimRight(string(req.flatData), "\x00")
+	} else {
+		ev.OutData = req.flatDataSize()
+	}
+	ms.tracer.Trace(&ev)
+}
+
+type jsonTracer struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONTracer returns a Tracer that writes each event to w as a
+// line of JSON.
+func NewJSONTracer(w io.Writer) Tracer {
+	return &jsonTracer{enc: json.NewEncoder(w)}
+}
+
+func (t *jsonTracer) Trace(ev *TraceEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.enc.Encode(ev); err != nil {
+		log.Printf("JSON tracer: %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package fuse
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestJSONTracer(t *testing.T) {
+	client, conn := net.Pipe()
+	ms := NewServerStream(&attrFS{NewDefaultRawFileSystem()}, conn, nil)
+	var buf bytes.Buffer
+	ms.SetTracer(NewJSONTracer(&buf))
+	done := make(chan struct{})
+	go func() {
+		ms.Serve()
+		close(done)
+	}()
+
+	client.Write(initMessage(1))
+	readReply(t, client)
+	ms.WaitMount()
+	client.Write(getAttrMessage(2, FUSE_ROOT_ID))
+	readReply(t, client)
+	client.Write(getAttrMessage(3, 42))
+	readReply(t, client)
+	go ms.InodeNotify(42, 0, -1)
+	readReply(t, client)
+	client.Close()
+	<-done
+
+	type event struct {
+		Op     string
+		Unique uint64
+		NodeId uint64
+		Status int32
+		In     map[string]interface{}
+		Out    map[string]interface{}
+	}
+	var events []event
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var ev event
+		if err := dec.Decode(&ev); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		events = append(events, ev)
+	}
+	if len(events) != 4 {
+		t.Fatalf("got %d events, want 4: %+v", len(events), events)
+	}
+
+	if e := events[0]; e.Op != "INIT" || e.Status != 0 || e.In["Major"] != float64(_FUSE_KERNEL_VERSION) {
+		t.Errorf("got INIT event %+v", e)
+	}
+	if e := events[1]; e.Op != "GETATTR" || e.Unique != 2 || e.NodeId != FUSE_ROOT_ID ||
+		e.Status != 0 || e.Out["Mode"] != float64(S_IFDIR|0755) {
+		t.Errorf("got GETATTR event %+v", e)
+	}
+	if e := events[2]; e.Op != "GETATTR" || e.NodeId != 42 || Status(e.Status) != ENOENT || e.Out != nil {
+		t.Errorf("got failed GETATTR event %+v", e)
+	}
+	if e := events[3]; e.Op != "NOTIFY_INODE" || e.Status != 0 || e.Out["Ino"] != float64(42) {
+		t.Errorf("got notification event %+v", e)
+	}
+}
+
+// opTracer records the opcodes of the events it gets.
+type opTracer struct {
+	mu  sync.Mutex
+	ops []string
+}
+
+func (t *opTracer) Trace(ev *TraceEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ops = append(t.ops, ev.Opcode)
+}
+
+func TestMultiTracer(t *testing.T) {
+	a, b := &opTracer{}, &opTracer{}
+	if got := MultiTracer(nil, a); got != Tracer(a) {
+		t.Errorf("MultiTracer with one tracer: got %v, want %v", got, a)
+	}
+
+	client, conn := net.Pipe()
+	ms := NewServerStream(&attrFS{NewDefaultRawFileSystem()}, conn, nil)
+	ms.SetTracer(MultiTracer(a, nil, b))
+	done := make(chan struct{})
+	go func() {
+		ms.Serve()
+		close(done)
+	}()
+
+	client.Write(initMessage(1))
+	readReply(t, client)
+	ms.WaitMount()
+	client.Write(getAttrMessage(2, FUSE_ROOT_ID))
+	readReply(t, client)
+	client.Close()
+	<-done
+
+	want := []string{"INIT", "GETATTR"}
+	if !reflect.DeepEqual(a.ops, want) || !reflect.DeepEqual(b.ops, want) {
+		t.Errorf("got events %v and %v, want %v for both", a.ops, b.ops, want)
+	}
+}
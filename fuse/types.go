@@ -17,12 +17,14 @@ const (
 	OK      = Status(0)
 	EACCES  = Status(syscall.EACCES)
 	EBUSY   = Status(syscall.EBUSY)
+	EINTR   = Status(syscall.EINTR)
 	EINVAL  = Status(syscall.EINVAL)
 	EIO     = Status(syscall.EIO)
 	ENOENT  = Status(syscall.ENOENT)
 	ENOSYS  = Status(syscall.ENOSYS)
 	ENODATA = Status(syscall.ENODATA)
 	ENOTDIR = Status(syscall.ENOTDIR)
+	ENOTTY  = Status(syscall.ENOTTY)
 	EPERM   = Status(syscall.EPERM)
 	ERANGE  = Status(syscall.ERANGE)
 	EXDEV   = Status(syscall.EXDEV)
@@ -56,7 +58,16 @@ type MkdirIn struct {
 	Umask uint32
 }
 
+// RenameIn is the input of RENAME2. For RENAME, Flags is zero.
 type RenameIn struct {
+	InHeader
+	Newdir  uint64
+	Flags   uint32
+	Padding uint32
+}
+
+// _Rename1In is the input of the original RENAME.
+type _Rename1In struct {
 	InHeader
 	Newdir uint64
 }
@@ -90,6 +101,7 @@ const ( // SetAttrIn.Valid
 	FATTR_ATIME_NOW = (1 << 7)
 	FATTR_MTIME_NOW = (1 << 8)
 	FATTR_LOCKOWNER = (1 << 9)
+	FATTR_CTIME     = (1 << 10) // protocol version 23.
 )
 
 type SetAttrInCommon struct {
@@ -102,17 +114,20 @@ type SetAttrInCommon struct {
 	LockOwner uint64
 	Atime     uint64
 	Mtime     uint64
-	Unused2   uint64
+	Ctime     uint64
 	Atimensec uint32
 	Mtimensec uint32
-	Unused3   uint32
+	Ctimensec uint32
 	Mode      uint32
 	Unused4   uint32
 	Owner
 	Unused5 uint32
 }
 
-const RELEASE_FLUSH = (1 << 0)
+const (
+	RELEASE_FLUSH        = (1 << 0)
+	RELEASE_FLOCK_UNLOCK = (1 << 1)
+)
 
 type ReleaseIn struct {
 	InHeader
@@ -133,6 +148,7 @@ const (
 	FOPEN_DIRECT_IO   = (1 << 0)
 	FOPEN_KEEP_CACHE  = (1 << 1)
 	FOPEN_NONSEEKABLE = (1 << 2)
+	FOPEN_CACHE_DIR   = (1 << 3) // protocol version 28.
 )
 
 type OpenOut struct {
@@ -158,6 +174,18 @@ const (
 	CAP_AUTO_INVAL_DATA  = (1 << 12)
 	CAP_READDIRPLUS      = (1 << 13)
 	CAP_READDIRPLUS_AUTO = (1 << 14)
+
+	// protocol version 22 and later.
+	CAP_ASYNC_DIO          = (1 << 15)
+	CAP_WRITEBACK_CACHE    = (1 << 16)
+	CAP_NO_OPEN_SUPPORT    = (1 << 17)
+	CAP_PARALLEL_DIROPS    = (1 << 18)
+	CAP_HANDLE_KILLPRIV    = (1 << 19)
+	CAP_POSIX_ACL          = (1 << 20)
+	CAP_ABORT_ERROR        = (1 << 21)
+	CAP_MAX_PAGES          = (1 << 22)
+	CAP_CACHE_SYMLINKS     = (1 << 23)
+	CAP_NO_OPENDIR_SUPPORT = (1 << 24)
 )
 
 type InitIn struct {
@@ -177,8 +205,20 @@ type InitOut struct {
 	MaxBackground       uint16
 	CongestionThreshold uint16
 	MaxWrite            uint32
+
+	// Protocol version 23 and later.
+	TimeGran uint32
+
+	// Protocol version 28 and later.
+	MaxPages uint16
+	Padding  uint16
+	Unused   [8]uint32
 }
 
+// Kernels before protocol version 23 reject an InitOut with the
+// fields added since.
+const _COMPAT_22_INIT_OUT_SIZE = 24
+
 type _CuseInitIn struct {
 	InHeader
 	Major  uint32
@@ -219,9 +259,15 @@ const (
 	FUSE_IOCTL_COMPAT       = (1 << 0)
 	FUSE_IOCTL_UNRESTRICTED = (1 << 1)
 	FUSE_IOCTL_RETRY        = (1 << 2)
+	FUSE_IOCTL_32BIT        = (1 << 3)
+	FUSE_IOCTL_DIR          = (1 << 4)
 )
 
-type _IoctlIn struct {
+// IoctlIn is the request for an ioctl(2) on an open file. For
+// restricted ioctls, the kernel derives InSize and OutSize from the
+// direction and size encoded in Cmd, and sends InSize bytes of
+// input data after the header.
+type IoctlIn struct {
 	InHeader
 	Fh      uint64
 	Flags   uint32
@@ -231,27 +277,33 @@ type _IoctlIn struct {
 	OutSize uint32
 }
 
-type _IoctlOut struct {
+// IoctlOut carries the return value of the ioctl. Up to OutSize
+// bytes of output data follow it.
+type IoctlOut struct {
 	Result  int32
 	Flags   uint32
 	InIovs  uint32
 	OutIovs uint32
 }
 
-type _PollIn struct {
+// PollIn asks for the poll(2) events of an open file. Kh is the
+// kernel's handle for the poll waiter. If Flags has
+// FUSE_POLL_SCHEDULE_NOTIFY set, the file system should call
+// Server.PollNotify with Kh once the state of the file changes.
+type PollIn struct {
 	InHeader
-	Fh      uint64
-	Kh      uint64
-	Flags   uint32
-	Padding uint32
+	Fh     uint64
+	Kh     uint64
+	Flags  uint32
+	Events uint32
 }
 
-type _PollOut struct {
+type PollOut struct {
 	Revents uint32
 	Padding uint32
 }
 
-type _NotifyPollWakeupOut struct {
+type NotifyPollWakeupOut struct {
 	Kh uint64
 }
 
@@ -277,24 +329,29 @@ type GetXAttrOut struct {
 	Padding uint32
 }
 
-type _FileLock struct {
+// FileLock describes a byte range lock. Typ is one of
+// syscall.F_RDLCK, F_WRLCK or F_UNLCK. End is inclusive; a lock
+// extending to the end of the file has End == OFFSET_MAX. If
+// LkIn.LkFlags has FUSE_LK_FLOCK set, the lock came from flock(2)
+// and covers the whole file.
+type FileLock struct {
 	Start uint64
 	End   uint64
 	Typ   uint32
 	Pid   uint32
 }
 
-type _LkIn struct {
+type LkIn struct {
 	InHeader
 	Fh      uint64
 	Owner   uint64
-	Lk      _FileLock
+	Lk      FileLock
 	LkFlags uint32
 	Padding uint32
 }
 
-type _LkOut struct {
-	Lk _FileLock
+type LkOut struct {
+	Lk FileLock
 }
 
 // For AccessIn.Mask.
@@ -344,6 +401,33 @@ type NotifyInvalEntryOut struct {
 	Padding uint32
 }
 
+type NotifyStoreOut struct {
+	Nodeid  uint64
+	Offset  uint64
+	Size    uint32
+	Padding uint32
+}
+
+type NotifyRetrieveOut struct {
+	NotifyUnique uint64
+	Nodeid       uint64
+	Offset       uint64
+	Size         uint32
+	Padding      uint32
+}
+
+// NotifyRetrieveIn is the header of the kernel's answer to a
+// NOTIFY_RETRIEVE. It is followed by the data.
+type NotifyRetrieveIn struct {
+	InHeader
+	Dummy1 uint64
+	Offset uint64
+	Size   uint32
+	Dummy2 uint32
+	Dummy3 uint64
+	Dummy4 uint64
+}
+
 type NotifyInvalDeleteOut struct {
 	Parent  uint64
 	Child   uint64
@@ -391,7 +475,8 @@ type CreateOut struct {
 	OpenOut
 }
 
-type Context struct {
+// Caller has data on the process making the call.
+type Caller struct {
 	Owner
 	Pid uint32
 }
@@ -401,7 +486,7 @@ type InHeader struct {
 	Opcode int32
 	Unique uint64
 	NodeId uint64
-	Context
+	Caller
 	Padding uint32
 }
 
@@ -444,3 +529,28 @@ type FallocateIn struct {
 	Mode    uint32
 	Padding uint32
 }
+
+type LseekIn struct {
+	InHeader
+	Fh      uint64
+	Offset  uint64
+	Whence  uint32
+	Padding uint32
+}
+
+type LseekOut struct {
+	Offset uint64
+}
+
+// CopyFileRangeIn asks to copy Len bytes from the file Fh of NodeId
+// to the file FhOut of NodeIdOut. The reply is a WriteOut.
+type CopyFileRangeIn struct {
+	InHeader
+	FhIn      uint64
+	OffIn     uint64
+	NodeIdOut uint64
+	FhOut     uint64
+	OffOut    uint64
+	Len       uint64
+	Flags     uint64
+}
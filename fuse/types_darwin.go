@@ -61,6 +61,10 @@ func (g *GetAttrIn) Fh() uint64 {
 	return 0
 }
 
+func (g *GetAttrIn) fhField() *uint64 {
+	return nil
+}
+
 type ReadIn struct {
 	InHeader
 
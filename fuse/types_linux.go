@@ -47,6 +47,11 @@ func (g *GetAttrIn) Fh() uint64 {
 	return g.Fh_
 }
 
+// fhField returns the file handle field, or nil if there is none.
+func (g *GetAttrIn) fhField() *uint64 {
+	return &g.Fh_
+}
+
 type ReadIn struct {
 	InHeader
 	Fh        uint64
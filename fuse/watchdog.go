@@ -0,0 +1,160 @@
+package fuse
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SlowRequest describes a request that has been in flight for longer
+// than MountOptions.SlowRequestThreshold.
+type SlowRequest struct {
+	Opcode string
+	Unique uint64
+	NodeId uint64
+
+	// The process that issued the request.
+	Pid uint32
+
+	// When the request was read from the kernel, and how long
+	// it has been in flight.
+	Start    time.Time
+	Duration time.Duration
+
+	// Set if the request still waits for a handler, because of
+	// MountOptions.MaxHandlers and related limits.
+	Queued bool
+
+	// The stack of the goroutine handling the request; empty if
+	// the request is queued.
+	Stack string
+}
+
+func (r *SlowRequest) String() string {
+	state := "running"
+	if r.Queued {
+		state = "queued"
+	}
+	return fmt.Sprintf("%s (unique %d) on i%d from pid %d, %s for %v",
+		r.Opcode, r.Unique, r.NodeId, r.Pid, state, r.Duration)
+}
+
+// goroutineID returns the ID of the current goroutine, as it shows
+// in stack dumps.
+func goroutineID() uint64 {
+	var buf [64]byte
+	n := runtime.Stack(buf[:], false)
+	// The dump starts with "goroutine 123 [running]:".
+	fields := bytes.Fields(buf[:n])
+	if len(fields) < 2 {
+		return 0
+	}
+	id, _ := strconv.ParseUint(string(fields[1]), 10, 64)
+	return id
+}
+
+// allStacks returns the stacks of all goroutines, keyed by
+// goroutine ID.
+func allStacks() map[uint64]string {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	stacks := map[uint64]string{}
+	for _, s := range strings.Split(string(buf), "\n\n") {
+		fields := strings.Fields(s)
+		if len(fields) < 2 || fields[0] != "goroutine" {
+			continue
+		}
+		if id, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			stacks[id] = s
+		}
+	}
+	return stacks
+}
+
+// SlowRequests returns the requests that have been in flight for
+// longer than MountOptions.SlowRequestThreshold, oldest first. It
+// returns nil if the threshold is not set.
+func (ms *Server) SlowRequests() []SlowRequest {
+	return ms.slowRequests(false)
+}
+
+// slowRequests returns the slow requests. If onlyFresh is set, it
+// skips the requests that were returned with onlyFresh before, and
+// marks the others as returned. Goroutine stacks are only collected
+// if there is something to return.
+func (ms *Server) slowRequests(onlyFresh bool) []SlowRequest {
+	threshold := ms.opts.SlowRequestThreshold
+	if threshold <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	var result []SlowRequest
+	var goids []uint64
+	ms.inflight.Lock()
+	for _, req := range ms.inflight.byUnique {
+		if now.Sub(req.startTime) < threshold {
+			continue
+		}
+		if onlyFresh {
+			if req.slowReported {
+				continue
+			}
+			req.slowReported = true
+		}
+		result = append(result, SlowRequest{
+			Opcode:   operationName(req.inHeader.Opcode),
+			Unique:   req.inHeader.Unique,
+			NodeId:   req.inHeader.NodeId,
+			Pid:      req.inHeader.Pid,
+			Start:    req.startTime,
+			Duration: now.Sub(req.startTime),
+			Queued:   req.goroutine == 0,
+		})
+		goids = append(goids, req.goroutine)
+	}
+	ms.inflight.Unlock()
+	if len(result) == 0 {
+		return nil
+	}
+
+	stacks := allStacks()
+	for i := range result {
+		result[i].Stack = stacks[goids[i]]
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Start.Before(result[j].Start) })
+	return result
+}
+
+// watchdog reports slow requests to MountOptions.OnSlowRequest
+// until stop is closed.
+func (ms *Server) watchdog(stop <-chan struct{}) {
+	interval := ms.opts.SlowRequestThreshold / 2
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		for _, r := range ms.slowRequests(true) {
+			ms.opts.OnSlowRequest(r)
+		}
+	}
+}
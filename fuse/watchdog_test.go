@@ -0,0 +1,104 @@
+package fuse
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestSlowRequestWatchdog(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	fs := &slowReadFS{
+		attrFS:  attrFS{NewDefaultRawFileSystem()},
+		release: make(chan struct{}),
+	}
+	reports := make(chan SlowRequest, 10)
+	ms := NewServerStream(fs, conn, &MountOptions{
+		SlowRequestThreshold: 20 * time.Millisecond,
+		OnSlowRequest:        func(r SlowRequest) { reports <- r },
+	})
+	go ms.Serve()
+
+	client.Write(initMessage(1))
+	readReply(t, client)
+	ms.WaitMount()
+
+	msg := withUnique(readMessage(4096), 2)
+	(*InHeader)(unsafe.Pointer(&msg[0])).Pid = 1234
+	client.Write(msg)
+
+	select {
+	case r := <-reports:
+		if r.Opcode != "READ" || r.Unique != 2 || r.Pid != 1234 || r.Duration < 20*time.Millisecond {
+			t.Errorf("got report %v", &r)
+		}
+		if !strings.Contains(r.Stack, "slowReadFS") {
+			t.Errorf("stack does not show the handler:\n%s", r.Stack)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no report for slow request")
+	}
+	if d := ms.DebugData(); !strings.Contains(d, "slow request: READ") {
+		t.Errorf("DebugData does not list the request: %s", d)
+	}
+
+	// Each request is reported once.
+	select {
+	case r := <-reports:
+		t.Errorf("got second report %v", &r)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(fs.release)
+	readReply(t, client)
+	if rs := ms.SlowRequests(); len(rs) != 0 {
+		t.Errorf("got slow requests %v after reply", rs)
+	}
+}
+
+func TestSlowRequestQueued(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	fs := &slowReadFS{
+		attrFS:  attrFS{NewDefaultRawFileSystem()},
+		release: make(chan struct{}),
+	}
+	reports := make(chan SlowRequest, 10)
+	ms := NewServerStream(fs, conn, &MountOptions{
+		MaxDataHandlers:      1,
+		SlowRequestThreshold: 20 * time.Millisecond,
+		OnSlowRequest:        func(r SlowRequest) { reports <- r },
+	})
+	go ms.Serve()
+
+	client.Write(initMessage(1))
+	readReply(t, client)
+	ms.WaitMount()
+
+	client.Write(withUnique(readMessage(4096), 2))
+	waitStats(t, ms, func(s HandlerStats) bool { return s.ActiveData == 1 })
+	client.Write(withUnique(readMessage(4096), 4))
+
+	got := map[uint64]SlowRequest{}
+	for len(got) < 2 {
+		select {
+		case r := <-reports:
+			got[r.Unique] = r
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got reports %v, want 2", got)
+		}
+	}
+	if r := got[2]; r.Queued || r.Stack == "" {
+		t.Errorf("running request: got %v", &r)
+	}
+	if r := got[4]; !r.Queued || r.Stack != "" {
+		t.Errorf("queued request: got %v", &r)
+	}
+
+	close(fs.release)
+	readReply(t, client)
+	readReply(t, client)
+}
@@ -0,0 +1,46 @@
+package fuse
+
+import (
+	"io"
+
+	"github.com/hanwen/go-fuse/splice"
+)
+
+// WritePipe holds the payload of a WRITE request in a pipe. The
+// payload can be consumed once, either with WriteTo or with Bytes.
+type WritePipe struct {
+	pair *splice.Pair
+	size int
+}
+
+// Size returns the length of the payload.
+func (p *WritePipe) Size() int {
+	return p.size
+}
+
+// WriteTo moves the payload into fd at offset off, without copying
+// it into user space. It returns how many bytes were written; data
+// that could not be written is discarded.
+func (p *WritePipe) WriteTo(fd uintptr, off int64) (int, error) {
+	total := 0
+	for total < p.size {
+		n, err := p.pair.WriteToAt(fd, p.size-total, off+int64(total))
+		if n > 0 {
+			total += n
+		}
+		if err != nil {
+			return total, err
+		}
+		if n == 0 {
+			break
+		}
+	}
+	return total, nil
+}
+
+// Bytes reads the payload into buf, which must have room for Size
+// bytes.
+func (p *WritePipe) Bytes(buf []byte) ([]byte, error) {
+	n, err := io.ReadFull(p.pair, buf[:p.size])
+	return buf[:n], err
+}
@@ -0,0 +1,44 @@
+package fuse
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/hanwen/go-fuse/splice"
+)
+
+func TestWritePipeWriteTo(t *testing.T) {
+	pair, err := splice.Get()
+	if err != nil {
+		t.Fatalf("splice.Get: %v", err)
+	}
+	defer splice.Done(pair)
+
+	payload := bytes.Repeat([]byte("abcdefgh"), 1024)
+	if _, err := pair.Write(payload); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	f, err := ioutil.TempFile("", "go-fuse-writepipe")
+	if err != nil {
+		t.Fatalf("TempFile: %v", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	p := &WritePipe{pair: pair, size: len(payload)}
+	if n, err := p.WriteTo(f.Fd(), 10); err != nil || n != len(payload) {
+		t.Fatalf("WriteTo: got %d, %v", n, err)
+	}
+
+	content, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	want := append(make([]byte, 10), payload...)
+	if !bytes.Equal(content, want) {
+		t.Errorf("file content mismatch: got %d bytes, want %d", len(content), len(want))
+	}
+}
@@ -0,0 +1,223 @@
+// Package metrics collects statistics of a fuse.Server, and exports
+// them in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// DefaultBuckets are the upper bounds of the latency histogram
+// buckets, in seconds.
+var DefaultBuckets = []float64{
+	0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01,
+	0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10,
+}
+
+type histogram struct {
+	// counts[i] is the number of observations in bucket i, that
+	// is, larger than bucket i-1 and at most bucket i. The last
+	// entry is for observations beyond the last bucket.
+	counts []uint64
+	sum    float64
+}
+
+type errorKey struct {
+	op     string
+	status fuse.Status
+}
+
+// Collector gathers request statistics. Install it with
+// fuse.Server.SetTracer to get latencies, errors and byte counts, or
+// with fuse.Server.RecordLatencies to get latencies only; not with
+// both, as that counts requests twice. To keep another tracer, eg. a
+// JSON tracer, install fuse.MultiTracer(collector, other). It is an
+// http.Handler that serves the metrics.
+type Collector struct {
+	server  *fuse.Server
+	buckets []float64
+
+	mu            sync.Mutex
+	latencies     map[string]*histogram
+	errors        map[errorKey]uint64
+	notifications map[string]uint64
+	bytesRead     uint64
+	bytesWritten  uint64
+}
+
+// NewCollector returns a Collector for the given server. The server
+// is used to report in-flight requests and buffer pool usage, and
+// may be nil.
+func NewCollector(server *fuse.Server) *Collector {
+	return &Collector{
+		server:        server,
+		buckets:       DefaultBuckets,
+		latencies:     map[string]*histogram{},
+		errors:        map[errorKey]uint64{},
+		notifications: map[string]uint64{},
+	}
+}
+
+// Add records the latency of a request. It implements fuse.LatencyMap.
+func (c *Collector) Add(name string, dt time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.observe(name, dt)
+}
+
+func (c *Collector) observe(name string, dt time.Duration) {
+	h := c.latencies[name]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(c.buckets)+1)}
+		c.latencies[name] = h
+	}
+	secs := dt.Seconds()
+	h.counts[sort.SearchFloat64s(c.buckets, secs)]++
+	h.sum += secs
+}
+
+// Trace records a request or notification. It implements
+// fuse.Tracer.
+func (c *Collector) Trace(ev *fuse.TraceEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if strings.HasPrefix(ev.Opcode, "NOTIFY_") {
+		c.notifications[ev.Opcode]++
+		return
+	}
+
+	c.observe(ev.Opcode, ev.Duration)
+	if !ev.Status.Ok() {
+		c.errors[errorKey{ev.Opcode, ev.Status}]++
+		return
+	}
+	switch ev.Opcode {
+	case "READ":
+		c.bytesRead += uint64(ev.OutData)
+	case "WRITE":
+		// Spliced writes carry no InData, so use the size from
+		// the request.
+		if in, ok := ev.In.(*fuse.WriteIn); ok {
+			c.bytesWritten += uint64(in.Size)
+		}
+	}
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text format to w.
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	b := bufio.NewWriter(cw)
+	c.write(b)
+	err := b.Flush()
+	return cw.n, err
+}
+
+func (c *Collector) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	header(w, "fuse_request_duration_seconds", "histogram", "Time taken to answer requests, by opcode.")
+	var ops []string
+	for op := range c.latencies {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	for _, op := range ops {
+		h := c.latencies[op]
+		var cumulative uint64
+		for i, n := range h.counts {
+			cumulative += n
+			le := "+Inf"
+			if i < len(c.buckets) {
+				le = formatFloat(c.buckets[i])
+			}
+			fmt.Fprintf(w, "fuse_request_duration_seconds_bucket{op=%q,le=%q} %d\n", op, le, cumulative)
+		}
+		fmt.Fprintf(w, "fuse_request_duration_seconds_sum{op=%q} %s\n", op, formatFloat(h.sum))
+		fmt.Fprintf(w, "fuse_request_duration_seconds_count{op=%q} %d\n", op, cumulative)
+	}
+
+	header(w, "fuse_request_errors_total", "counter", "Requests answered with an error, by opcode and errno.")
+	var errKeys []errorKey
+	for k := range c.errors {
+		errKeys = append(errKeys, k)
+	}
+	sort.Slice(errKeys, func(i, j int) bool {
+		if errKeys[i].op != errKeys[j].op {
+			return errKeys[i].op < errKeys[j].op
+		}
+		return errKeys[i].status < errKeys[j].status
+	})
+	for _, k := range errKeys {
+		fmt.Fprintf(w, "fuse_request_errors_total{op=%q,errno=\"%d\"} %d\n", k.op, int32(k.status), c.errors[k])
+	}
+
+	header(w, "fuse_notifications_total", "counter", "Notifications sent to the kernel, by type.")
+	ops = ops[:0]
+	for op := range c.notifications {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	for _, op := range ops {
+		fmt.Fprintf(w, "fuse_notifications_total{op=%q} %d\n", op, c.notifications[op])
+	}
+
+	header(w, "fuse_read_bytes_total", "counter", "Bytes returned by READ requests.")
+	fmt.Fprintf(w, "fuse_read_bytes_total %d\n", c.bytesRead)
+	header(w, "fuse_written_bytes_total", "counter", "Bytes received in WRITE requests.")
+	fmt.Fprintf(w, "fuse_written_bytes_total %d\n", c.bytesWritten)
+
+	if c.server == nil {
+		return
+	}
+	hs := c.server.HandlerStats()
+	header(w, "fuse_requests_in_flight", "gauge", "Requests being handled.")
+	fmt.Fprintf(w, "fuse_requests_in_flight %d\n", hs.Active)
+	header(w, "fuse_requests_queued", "gauge", "Requests waiting for a handler.")
+	fmt.Fprintf(w, "fuse_requests_queued %d\n", hs.Queued)
+
+	if bs, ok := c.server.BufferPoolStats(); ok {
+		header(w, "fuse_buffer_pool_created_total", "counter", "Buffers allocated by the buffer pool.")
+		fmt.Fprintf(w, "fuse_buffer_pool_created_total %d\n", bs.Created)
+		header(w, "fuse_buffer_pool_outstanding_buffers", "gauge", "Buffers in use.")
+		fmt.Fprintf(w, "fuse_buffer_pool_outstanding_buffers %d\n", bs.Outstanding)
+		header(w, "fuse_buffer_pool_free_buffers", "gauge", "Buffers kept for reuse.")
+		fmt.Fprintf(w, "fuse_buffer_pool_free_buffers %d\n", bs.Free)
+		header(w, "fuse_buffer_pool_free_bytes", "gauge", "Size of the buffers kept for reuse.")
+		fmt.Fprintf(w, "fuse_buffer_pool_free_bytes %d\n", bs.FreeBytes)
+	}
+}
+
+func header(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestCollector(t *testing.T) {
+	c := NewCollector(nil)
+	c.Trace(&fuse.TraceEvent{Opcode: "GETATTR", Duration: 50 * time.Microsecond})
+	c.Trace(&fuse.TraceEvent{Opcode: "GETATTR", Duration: 2 * time.Millisecond})
+	c.Trace(&fuse.TraceEvent{Opcode: "LOOKUP", Status: fuse.ENOENT, Duration: time.Millisecond})
+	c.Trace(&fuse.TraceEvent{Opcode: "READ", OutData: 4096})
+	c.Trace(&fuse.TraceEvent{Opcode: "READ", Status: fuse.EIO})
+	c.Trace(&fuse.TraceEvent{Opcode: "WRITE", In: &fuse.WriteIn{Size: 100}})
+	c.Trace(&fuse.TraceEvent{Opcode: "NOTIFY_INODE"})
+	c.Add("GETATTR", 20*time.Second)
+
+	var b strings.Builder
+	if _, err := c.WriteTo(&b); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"# TYPE fuse_request_duration_seconds histogram\n",
+		`fuse_request_duration_seconds_bucket{op="GETATTR",le="0.0001"} 1` + "\n",
+		`fuse_request_duration_seconds_bucket{op="GETATTR",le="0.001"} 1` + "\n",
+		`fuse_request_duration_seconds_bucket{op="GETATTR",le="0.0025"} 2` + "\n",
+		`fuse_request_duration_seconds_bucket{op="GETATTR",le="10"} 2` + "\n",
+		`fuse_request_duration_seconds_bucket{op="GETATTR",le="+Inf"} 3` + "\n",
+		`fuse_request_duration_seconds_sum{op="GETATTR"} 20.00205` + "\n",
+		`fuse_request_duration_seconds_count{op="GETATTR"} 3` + "\n",
+		`fuse_request_duration_seconds_bucket{op="LOOKUP",le="0.001"} 1` + "\n",
+		`fuse_request_errors_total{op="LOOKUP",errno="2"} 1` + "\n",
+		`fuse_request_errors_total{op="READ",errno="5"} 1` + "\n",
+		`fuse_notifications_total{op="NOTIFY_INODE"} 1` + "\n",
+		"fuse_read_bytes_total 4096\n",
+		"fuse_written_bytes_total 100\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "NOTIFY_INODE\",le") {
+		t.Errorf("notifications should not have latencies:\n%s", out)
+	}
+	if strings.Contains(out, "fuse_requests_in_flight") {
+		t.Errorf("got server metrics without a server:\n%s", out)
+	}
+}
+
+func TestCollectorHandler(t *testing.T) {
+	client, conn := net.Pipe()
+	defer client.Close()
+	server := fuse.NewServerStream(fuse.NewDefaultRawFileSystem(), conn, nil)
+	c := NewCollector(server)
+	server.SetTracer(c)
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("got Content-Type %q", ct)
+	}
+	body, _ := ioutil.ReadAll(rec.Body)
+	for _, want := range []string{
+		"fuse_requests_in_flight 0\n",
+		"fuse_requests_queued 0\n",
+		"# TYPE fuse_buffer_pool_outstanding_buffers gauge\n",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("output lacks %q:\n%s", want, body)
+		}
+	}
+}
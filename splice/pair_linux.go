@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"os"
 	"syscall"
+	"unsafe"
 )
 
+const _FIONREAD = 0x541B
+
 func (p *Pair) LoadFromAt(fd uintptr, sz int, off int64) (int, error) {
 	n, err := syscall.Splice(int(fd), &off, int(p.w.Fd()), nil, sz, 0)
 	return int(n), err
@@ -24,6 +27,15 @@ func (p *Pair) LoadFrom(fd uintptr, sz int) (int, error) {
 	return int(n), err
 }
 
+// WriteToAt moves n bytes from the pipe into fd at offset off.
+func (p *Pair) WriteToAt(fd uintptr, n int, off int64) (int, error) {
+	m, err := syscall.Splice(int(p.r.Fd()), nil, int(fd), &off, n, 0)
+	if err != nil {
+		err = os.NewSyscallError("Splice write", err)
+	}
+	return int(m), err
+}
+
 func (p *Pair) WriteTo(fd uintptr, n int) (int, error) {
 	m, err := syscall.Splice(int(p.r.Fd()), nil, int(fd), nil, int(n), 0)
 	if err != nil {
@@ -31,3 +43,25 @@ func (p *Pair) WriteTo(fd uintptr, n int) (int, error) {
 	}
 	return int(m), err
 }
+
+// discard drops the data in the pipe. os.File.Fd puts the pipe in
+// blocking mode, so ask how much is there rather than reading until
+// EAGAIN.
+func (p *Pair) discard() {
+	fd := p.r.Fd()
+	for {
+		var avail int32
+		_, _, errNo := syscall.Syscall(syscall.SYS_IOCTL, fd,
+			_FIONREAD, uintptr(unsafe.Pointer(&avail)))
+		if errNo != 0 || avail <= 0 {
+			return
+		}
+		buf := discardBuffer[:]
+		if int(avail) < len(buf) {
+			buf = buf[:avail]
+		}
+		if _, err := syscall.Read(int(fd), buf); err != nil {
+			return
+		}
+	}
+}
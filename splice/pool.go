@@ -102,7 +102,7 @@ func DiscardAll(r io.Reader) {
 }
 
 func (me *pairPool) done(p *Pair) {
-	DiscardAll(p.r)
+	p.discard()
 
 	me.Lock()
 	me.usedCount--
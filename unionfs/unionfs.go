@@ -836,7 +836,7 @@ func (fs *unionFS) recursivePromote(path string, pathResult branchResult, contex
 	return names, code
 }
 
-func (fs *unionFS) renameDirectory(srcResult branchResult, srcDir string, dstDir string, context *fuse.Context) (code fuse.Status) {
+func (fs *unionFS) renameDirectory(srcResult branchResult, srcDir string, dstDir string, flags uint32, context *fuse.Context) (code fuse.Status) {
 	names := []string{}
 	if code.Ok() {
 		names, code = fs.recursivePromote(srcDir, srcResult, context)
@@ -847,7 +847,7 @@ func (fs *unionFS) renameDirectory(srcResult branchResult, srcDir string, dstDir
 
 	if code.Ok() {
 		writable := fs.fileSystems[0]
-		code = writable.Rename(srcDir, dstDir, context)
+		code = writable.Rename(srcDir, dstDir, flags, context)
 	}
 
 	if code.Ok() {
@@ -869,15 +869,53 @@ func (fs *unionFS) renameDirectory(srcResult branchResult, srcDir string, dstDir
 	return code
 }
 
-func (fs *unionFS) Rename(src string, dst string, context *fuse.Context) (code fuse.Status) {
+// renameExchange swaps two files. Both are promoted to the writable
+// branch first, so no deletion markers are needed.
+func (fs *unionFS) renameExchange(srcResult branchResult, src string, dst string, context *fuse.Context) (code fuse.Status) {
+	dstResult := fs.getBranch(dst)
+	if !dstResult.code.Ok() {
+		return dstResult.code
+	}
+	if srcResult.attr.IsDir() || dstResult.attr.IsDir() {
+		// Swapping directories would need both trees promoted.
+		return fuse.EXDEV
+	}
+
+	if srcResult.branch > 0 {
+		code = fs.Promote(src, srcResult, context)
+	}
+	if code.Ok() && dstResult.branch > 0 {
+		code = fs.Promote(dst, dstResult, context)
+	}
+	if code.Ok() {
+		code = fs.fileSystems[0].Rename(src, dst, fuse.RENAME_EXCHANGE, context)
+	}
+	fs.branchCache.DropEntry(src)
+	fs.branchCache.DropEntry(dst)
+	return code
+}
+
+func (fs *unionFS) Rename(src string, dst string, flags uint32, context *fuse.Context) (code fuse.Status) {
+	if flags&^(fuse.RENAME_NOREPLACE|fuse.RENAME_EXCHANGE) != 0 ||
+		flags == fuse.RENAME_NOREPLACE|fuse.RENAME_EXCHANGE {
+		return fuse.EINVAL
+	}
+
 	srcResult := fs.getBranch(src)
 	code = srcResult.code
-	if code.Ok() {
-		code = srcResult.code
+	if !code.Ok() {
+		return code
+	}
+
+	if flags&fuse.RENAME_EXCHANGE != 0 {
+		return fs.renameExchange(srcResult, src, dst, context)
+	}
+	if flags&fuse.RENAME_NOREPLACE != 0 && fs.getBranch(dst).code.Ok() {
+		return fuse.Status(syscall.EEXIST)
 	}
 
 	if srcResult.attr.IsDir() {
-		return fs.renameDirectory(srcResult, src, dst, context)
+		return fs.renameDirectory(srcResult, src, dst, flags, context)
 	}
 
 	if code.Ok() && srcResult.branch > 0 {
@@ -887,7 +925,7 @@ func (fs *unionFS) Rename(src string, dst string, context *fuse.Context) (code f
 		code = fs.promoteDirsTo(dst)
 	}
 	if code.Ok() {
-		code = fs.fileSystems[0].Rename(src, dst, context)
+		code = fs.fileSystems[0].Rename(src, dst, flags, context)
 	}
 
 	if code.Ok() {
@@ -16,6 +16,7 @@ import (
 	"time"
 
 	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/fakekernel"
 	"github.com/hanwen/go-fuse/fuse/nodefs"
 	"github.com/hanwen/go-fuse/fuse/pathfs"
 )
@@ -1519,3 +1520,128 @@ func TestUnionFSBarf(t *testing.T) {
 		t.Fatalf("os.Rename: %v", err)
 	}
 }
+
+// TestUnionFsFakeKernel checks deletion of a read-only file without
+// mounting.
+func TestUnionFsFakeKernel(t *testing.T) {
+	wd, err := ioutil.TempDir("", "unionfs")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(wd)
+	os.Mkdir(wd+"/rw", 0700)
+	os.Mkdir(wd+"/ro", 0700)
+	WriteFile(t, wd+"/ro/file", "ro")
+
+	fses := []pathfs.FileSystem{
+		pathfs.NewLoopbackFileSystem(wd + "/rw"),
+		pathfs.NewLoopbackFileSystem(wd + "/ro"),
+	}
+	ufs, err := NewUnionFs(fses, testOpts)
+	if err != nil {
+		t.Fatalf("NewUnionFs: %v", err)
+	}
+	conn := nodefs.NewFileSystemConnector(pathfs.NewPathNodeFs(ufs, nil), nil)
+	k := fakekernel.New(conn.RawFS())
+
+	if _, code := k.Lookup(fuse.FUSE_ROOT_ID, "file"); !code.Ok() {
+		t.Fatalf("Lookup failed: %v", code)
+	}
+	if code := k.Unlink(fuse.FUSE_ROOT_ID, "file"); !code.Ok() {
+		t.Fatalf("Unlink failed: %v", code)
+	}
+	if _, code := k.Lookup(fuse.FUSE_ROOT_ID, "file"); code != fuse.ENOENT {
+		t.Errorf("Lookup after Unlink: got %v, want ENOENT", code)
+	}
+	if _, err := os.Lstat(wd + "/ro/file"); err != nil {
+		t.Errorf("read-only file was removed: %v", err)
+	}
+}
+
+// TestUnionFsRename2 checks flagged renames across branches without
+// mounting.
+// hidingFS makes GetAttr of one name fail with ENOENT, and records
+// the flags of Rename calls.
+type hidingFS struct {
+	pathfs.FileSystem
+	hidden      string
+	renameFlags []uint32
+}
+
+func (fs *hidingFS) Rename(oldName string, newName string, flags uint32, context *fuse.Context) fuse.Status {
+	fs.renameFlags = append(fs.renameFlags, flags)
+	return fs.FileSystem.Rename(oldName, newName, flags, context)
+}
+
+func (fs *hidingFS) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse.Status) {
+	if name == fs.hidden {
+		return nil, fuse.ENOENT
+	}
+	return fs.FileSystem.GetAttr(name, context)
+}
+
+func TestUnionFsRename2(t *testing.T) {
+	wd, err := ioutil.TempDir("", "unionfs")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(wd)
+	os.Mkdir(wd+"/rw", 0700)
+	os.Mkdir(wd+"/ro", 0700)
+	WriteFile(t, wd+"/ro/a", "ro")
+	WriteFile(t, wd+"/rw/b", "rw")
+
+	rw := &hidingFS{FileSystem: pathfs.NewLoopbackFileSystem(wd + "/rw"), hidden: "newdir"}
+	fses := []pathfs.FileSystem{
+		rw,
+		pathfs.NewLoopbackFileSystem(wd + "/ro"),
+	}
+	ufs, err := NewUnionFs(fses, testOpts)
+	if err != nil {
+		t.Fatalf("NewUnionFs: %v", err)
+	}
+	conn := nodefs.NewFileSystemConnector(pathfs.NewPathNodeFs(ufs, nil), nil)
+	k := fakekernel.New(conn.RawFS())
+	for _, n := range []string{"a", "b"} {
+		if _, code := k.Lookup(fuse.FUSE_ROOT_ID, n); !code.Ok() {
+			t.Fatalf("Lookup(%q) failed: %v", n, code)
+		}
+	}
+
+	if code := k.Rename(fuse.FUSE_ROOT_ID, "a", fuse.FUSE_ROOT_ID, "b", fuse.RENAME_NOREPLACE); code != fuse.Status(syscall.EEXIST) {
+		t.Errorf("Rename NOREPLACE: got %v, want EEXIST", code)
+	}
+	if code := k.Rename(fuse.FUSE_ROOT_ID, "a", fuse.FUSE_ROOT_ID, "b", fuse.RENAME_WHITEOUT); code != fuse.EINVAL {
+		t.Errorf("Rename WHITEOUT: got %v, want EINVAL", code)
+	}
+	if code := k.Rename(fuse.FUSE_ROOT_ID, "a", fuse.FUSE_ROOT_ID, "b", fuse.RENAME_EXCHANGE); !code.Ok() {
+		t.Fatalf("Rename EXCHANGE: %v", code)
+	}
+	if got := readFromFile(t, wd+"/rw/a"); got != "rw" {
+		t.Errorf("a: got %q, want %q", got, "rw")
+	}
+	if got := readFromFile(t, wd+"/rw/b"); got != "ro" {
+		t.Errorf("b: got %q, want %q", got, "ro")
+	}
+	if got := readFromFile(t, wd+"/ro/a"); got != "ro" {
+		t.Errorf("read-only file changed: %q", got)
+	}
+
+	// A directory that appears after the union checked for it must
+	// not be replaced either. The writable branch hides newdir from
+	// GetAttr, as if it were created between check and rename.
+	os.Mkdir(wd+"/ro/dir", 0755)
+	if _, code := k.Lookup(fuse.FUSE_ROOT_ID, "dir"); !code.Ok() {
+		t.Fatalf("Lookup(dir) failed: %v", code)
+	}
+	if err := os.Mkdir(wd+"/rw/newdir", 0755); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	rw.renameFlags = nil
+	if code := k.Rename(fuse.FUSE_ROOT_ID, "dir", fuse.FUSE_ROOT_ID, "newdir", fuse.RENAME_NOREPLACE); code != fuse.Status(syscall.EEXIST) {
+		t.Errorf("Rename NOREPLACE of directory: got %v, want EEXIST", code)
+	}
+	if len(rw.renameFlags) != 1 || rw.renameFlags[0] != fuse.RENAME_NOREPLACE {
+		t.Errorf("writable branch got Rename flags %v, want RENAME_NOREPLACE", rw.renameFlags)
+	}
+}
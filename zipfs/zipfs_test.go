@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/fakekernel"
 	"github.com/hanwen/go-fuse/fuse/nodefs"
 )
 
@@ -93,3 +94,35 @@ func TestLinkCount(t *testing.T) {
 		t.Fatal("wrong link count", fuse.ToStatT(fi).Nlink)
 	}
 }
+
+// TestZipFsFakeKernel runs without mounting.
+func TestZipFsFakeKernel(t *testing.T) {
+	zfs, err := NewArchiveFileSystem(testZipFile())
+	if err != nil {
+		t.Fatalf("NewArchiveFileSystem failed: %v", err)
+	}
+	k := fakekernel.New(nodefs.NewFileSystemConnector(zfs, nil).RawFS())
+
+	entries, code := k.ReadDir(fuse.FUSE_ROOT_ID)
+	if !code.Ok() {
+		t.Fatalf("ReadDir failed: %v", code)
+	}
+	// The listing includes "." and "..".
+	if len(entries) != 4 {
+		t.Errorf("got entries %v, want 4", entries)
+	}
+
+	nodeid, code := k.LookupPath("file.txt")
+	if !code.Ok() {
+		t.Fatalf("LookupPath failed: %v", code)
+	}
+	fh, code := k.Open(nodeid, uint32(os.O_RDONLY))
+	if !code.Ok() {
+		t.Fatalf("Open failed: %v", code)
+	}
+	defer k.Release(nodeid, fh)
+	data, code := k.Read(nodeid, fh, 0, 1024)
+	if !code.Ok() || string(data) != "hello\n" {
+		t.Errorf("Read: got %q, %v", data, code)
+	}
+}